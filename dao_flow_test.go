@@ -185,4 +185,16 @@ func TestDonationsFlow(t *testing.T) {
 		WithArg("bookTitle", "Test Book"),
 	).Print()
 	color.Green("")
+	// Change the keeper of the book
+	color.Green("Change the keeper of the book to Alice")
+	o.Tx("account/add_keeper",
+		WithSigner("account"),
+		WithArg("bookTitle", "Test Book"),
+		WithArg("keeper", "alice"),
+	).AssertSuccess(t).Print()
+	color.Green("")
+	// Every book with its keeper
+	color.Green("Get every book's keeper")
+	o.Script("get_book_keepers").Print()
+	color.Green("")
 }
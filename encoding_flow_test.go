@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trickyParagraphs is text that breaks when arguments are sent as Cadence literals
+// or escaped twice.
+var trickyParagraphs = []string{
+	`"Why I am so wise," he said.`,
+	`A backslash \ alone, a pair \\ and a trailing one \`,
+	`Escaped in the source: \"quoted\" and \\ and \n`,
+	"Tab\tseparated\tcolumns",
+	"Control characters: \x01 \x1f \x7f",
+	"Emoji: 🦉📚 and a flag 🇩🇪",
+	"Combining marks: e\u0301 vs \u00e9, n\u0303",
+	`Unicode escape as text: \u{1F600} and \u{0}`,
+	"A real newline\ninside one paragraph",
+	"Markup: <b>Ecce</b> & <i>Homo</i>",
+}
+
+// TestArgumentRoundTrip sends tricky text through the tasks' argument encoding and
+// checks that get_book_paragraph returns exactly what was sent.
+// Requires: Alexandria deployed to "account" (emulator), flow.json with contracts/accounts/deployments.
+func TestArgumentRoundTrip(t *testing.T) {
+	o, err := OverflowTesting()
+	require.NoError(t, err)
+	require.NotNil(t, o)
+
+	const bookTitle, chapterTitle = "RoundTrip", "Chapter_1"
+	color.White("STARTING Argument Round-Trip TEST")
+
+	o.Tx("Admin/add_book",
+		WithSigner("account"),
+		WithArg("title", pipeline.StringArg(bookTitle)),
+		WithArg("author", pipeline.StringArg(`Friedrich "Fritz" Nietzsche`)),
+		WithArg("genre", pipeline.StringArg("Philosophy")),
+		WithArg("edition", pipeline.StringArg(`Edition \1`)),
+		WithArg("summary", pipeline.StringArg(trickyParagraphs[1])),
+	).AssertSuccess(t).Print()
+
+	o.Tx("Admin/add_chapter_name",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+	).AssertSuccess(t).Print()
+
+	// [String] argument: the whole chapter in one add_chapter
+	o.Tx("Admin/add_chapter",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+		WithArg("index", pipeline.IntArg(1)),
+		WithArg("paragraphs", pipeline.StringArrayArg(trickyParagraphs)),
+	).AssertSuccess(t).Print()
+
+	// String argument: the same text again, one paragraph at a time
+	for _, paragraph := range trickyParagraphs {
+		o.Tx("Admin/add_paragraph_to_chapter",
+			WithSigner("account"),
+			WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+			WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+			WithArg("paragraph", pipeline.StringArg(paragraph)),
+		).AssertSuccess(t)
+	}
+
+	sent := append(append([]string{}, trickyParagraphs...), trickyParagraphs...)
+	for i, want := range sent {
+		result := o.Script("get_book_paragraph",
+			WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+			WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+			WithArg("paragraphIndex", pipeline.IntArg(i)),
+		)
+		require.NoError(t, result.Err)
+		var got string
+		require.NoError(t, result.MarshalAs(&got))
+		assert.Equal(t, want, got, "paragraph %d", i)
+	}
+
+	result := o.Script("get_book_chapter",
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+	)
+	require.NoError(t, result.Err)
+	var chapter pipeline.OnChainChapter
+	require.NoError(t, result.MarshalAs(&chapter))
+	assert.Equal(t, pipeline.HashParagraphs(sent), pipeline.HashParagraphs(chapter.Paragraphs))
+}
@@ -1,6 +1,7 @@
 'use client'
 import { useState, useEffect, useRef, lazy, Suspense } from 'react'
 import { fetchChapterParagraph, fetchBookChapters } from '@/flow/actions'
+import { parseChapter } from '@/lib/paragraphs'
 
 // Lazy load Reader component - only loads when user opens a chapter
 const Reader = lazy(() => import('@/components/reader/Reader'))
@@ -108,35 +109,6 @@ function sortChapters<T extends { title: string }>(chapters: T[]): T[] {
   })
 }
 
-// Helper function to check if a string is a base64 encoded image
-function isBase64Image(str: string): boolean {
-  // Base64 images are typically very long and contain only base64 characters
-  // Check if string is long enough and matches base64 pattern
-  if (!str || str.length < 100) return false
-  const base64Pattern = /^[A-Za-z0-9+/=]+$/
-  // Images when base64 encoded are typically > 1KB (base64 is ~33% larger than binary)
-  return base64Pattern.test(str) && str.length > 1000
-}
-
-// Helper function to detect image format from base64 string
-function detectImageFormat(base64: string): 'jpeg' | 'png' | 'unknown' {
-  // Check for common base64 image signatures
-  // JPEG starts with /9j/4AAQSkZJRg
-  // PNG starts with iVBORw0KGgo
-  if (base64.startsWith('/9j/') || base64.startsWith('iVBORw0KGgo')) {
-    return base64.startsWith('/9j/') ? 'jpeg' : 'png'
-  }
-  // Fallback: try to decode and check magic bytes
-  try {
-    const binary = atob(base64.substring(0, 100))
-    if (binary.startsWith('\xFF\xD8')) return 'jpeg'
-    if (binary.startsWith('\x89PNG')) return 'png'
-  } catch {
-    // If decoding fails, default to jpeg
-  }
-  return 'jpeg' // Default to jpeg
-}
-
 type Props = {
   selectedBook: string
   selectedGenre: string | null
@@ -396,29 +368,30 @@ export default function ChaptersView({ selectedBook, selectedGenre, chapters, lo
                       return <div className="text-gray-500 text-center py-8">No content found for this chapter.</div>
                     }
                     
-                    // Check if paragraphs are base64 images
-                    const isImageChapter = chapter.paragraphs.length > 0 && isBase64Image(chapter.paragraphs[0])
+                    // Image paragraphs, enveloped or legacy base64, make an image chapter
+                    const items = parseChapter(chapter.paragraphs, chapter.title)
+                    const isImageChapter = items.some((item) => item.kind === 'image')
                     
                     if (isImageChapter) {
-                      // Render as images
+                      // Render as images, with any text between them
                       return (
                         <div className="space-y-4">
                           <h3 className="text-xl font-bold mb-4 text-center">{chapter.title}</h3>
                           <div className="flex flex-col items-center gap-4">
-                            {chapter.paragraphs.map((base64Image, idx) => {
-                              const format = detectImageFormat(base64Image)
-                              const mimeType = format === 'png' ? 'image/png' : 'image/jpeg'
-                              return (
+                            {items.map((item, idx) =>
+                              item.kind === 'image' ? (
                                 <img
                                   key={idx}
-                                  src={`data:${mimeType};base64,${base64Image}`}
-                                  alt={`${chapter.title} - Page ${idx + 1}`}
+                                  src={item.src}
+                                  alt={item.alt}
                                   className="max-w-full h-auto rounded-lg shadow-lg"
                                   loading="lazy"
                                   style={{ maxWidth: '100%', width: 'auto' }}
                                 />
+                              ) : (
+                                <p key={idx} className="text-gray-600 text-center">{item.text}</p>
                               )
-                            })}
+                            )}
                           </div>
                         </div>
                       )
@@ -426,7 +399,7 @@ export default function ChaptersView({ selectedBook, selectedGenre, chapters, lo
                       // Render as text using Reader
                       const html = [
                         `<h1>${chapter.title}</h1>`,
-                        ...chapter.paragraphs.map((p) => `<p>${p}</p>`),
+                        ...items.flatMap((item) => (item.kind === 'text' ? [`<p>${item.text}</p>`] : [])),
                       ].join('')
                       return (
                         <Suspense fallback={<div className="text-gray-600 text-center py-8">Loading reader...</div>}>
@@ -0,0 +1,76 @@
+// Chapter paragraphs as stored on-chain: text as is, images in a versioned envelope
+// (a header line "ALEXANDRIA-<KIND>/<version> ...", a newline, then base64), or, for
+// pages uploaded before the envelope, bare base64. Mirrors tasks/pipeline/paragraph.go.
+
+export type ChapterItem =
+  | { kind: 'text'; text: string }
+  | { kind: 'image'; src: string; alt: string }
+
+const PARAGRAPH_VERSION = 1
+const ENVELOPE = /^ALEXANDRIA-([A-Z][A-Z-]*)\/(\d+)(?: |$)/
+const BASE64 = /^[A-Za-z0-9+/]+={0,2}$/
+
+// Legacy images are sniffed by their first bytes, as base64: JPEG, PNG, GIF, WebP.
+function legacyImageMime(paragraph: string): string | null {
+  if (paragraph.length < 100 || paragraph.length % 4 !== 0 || !BASE64.test(paragraph)) return null
+  if (paragraph.startsWith('/9j/')) return 'image/jpeg'
+  if (paragraph.startsWith('iVBORw0KGgo')) return 'image/png'
+  if (paragraph.startsWith('R0lGOD')) return 'image/gif'
+  if (paragraph.startsWith('UklGR')) return 'image/webp'
+  return null
+}
+
+// parseChapter turns a chapter's paragraphs into text and images, joining the chunks
+// of an image too large for one paragraph. Chunk payloads are whole base64 groups, so
+// their base64 joins as is. Envelopes this reader does not know, and broken chunk
+// runs, are shown as a note rather than as text.
+export function parseChapter(paragraphs: string[], title: string): ChapterItem[] {
+  const items: ChapterItem[] = []
+  let chunks: { id: string; count: number; mime: string; alt: string; data: string[] } | null = null
+  const note = (text: string) => items.push({ kind: 'text', text: `[${text}]` })
+
+  for (const [idx, paragraph] of paragraphs.entries()) {
+    const match = ENVELOPE.exec(paragraph)
+    const newline = paragraph.indexOf('\n')
+    const fields = match ? paragraph.slice(0, newline < 0 ? undefined : newline).split(/ +/) : []
+    const payload = newline < 0 ? '' : paragraph.slice(newline + 1)
+
+    if (chunks && match?.[1] !== 'IMAGE-CHUNK') {
+      note(`image ${chunks.id} is incomplete`)
+      chunks = null
+    }
+    if (!match) {
+      const mime = legacyImageMime(paragraph)
+      items.push(mime
+        ? { kind: 'image', src: `data:${mime};base64,${paragraph}`, alt: `${title} - Page ${idx + 1}` }
+        : { kind: 'text', text: paragraph })
+      continue
+    }
+    if (Number(match[2]) > PARAGRAPH_VERSION || (match[1] !== 'IMAGE' && match[1] !== 'IMAGE-CHUNK')) {
+      note(`${match[0].trim()} needs a newer reader`)
+      continue
+    }
+    if (match[1] === 'IMAGE') {
+      const [, id, mime, ...alt] = fields
+      items.push({ kind: 'image', src: `data:${mime};base64,${payload}`, alt: alt.join(' ') || `${title} - ${id}` })
+      continue
+    }
+    const [, id, position, mime, , ...alt] = fields
+    const [index, count] = (position ?? '').split('/').map(Number)
+    if (index === 1) {
+      if (chunks) note(`image ${chunks.id} is incomplete`)
+      chunks = { id, count, mime, alt: alt.join(' ') || `${title} - ${id}`, data: [] }
+    } else if (!chunks || chunks.id !== id || chunks.data.length + 1 !== index) {
+      note(`image ${id} chunk ${position} is out of order`)
+      chunks = null
+      continue
+    }
+    chunks.data.push(payload)
+    if (chunks.data.length === chunks.count) {
+      items.push({ kind: 'image', src: `data:${chunks.mime};base64,${chunks.data.join('')}`, alt: chunks.alt })
+      chunks = null
+    }
+  }
+  if (chunks) note(`image ${chunks.id} is incomplete`)
+  return items
+}
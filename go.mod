@@ -5,8 +5,12 @@ go 1.25.0
 require (
 	github.com/bjartek/overflow/v2 v2.9.2
 	github.com/fatih/color v1.17.0
+	github.com/onflow/cadence v1.7.0
+	github.com/onflow/flow-go-sdk v1.8.3
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/crypto v0.41.0
 	golang.org/x/image v0.25.0
+	golang.org/x/term v0.34.0
 )
 
 require (
@@ -151,7 +155,6 @@ require (
 	github.com/nightlyone/lockfile v1.0.0 // indirect
 	github.com/olekukonko/tablewriter v0.0.5 // indirect
 	github.com/onflow/atree v0.10.1 // indirect
-	github.com/onflow/cadence v1.7.0 // indirect
 	github.com/onflow/crypto v0.25.3 // indirect
 	github.com/onflow/fixed-point v0.1.1 // indirect
 	github.com/onflow/flixkit-go/v2 v2.5.1 // indirect
@@ -162,7 +165,6 @@ require (
 	github.com/onflow/flow-ft/lib/go/contracts v1.0.1 // indirect
 	github.com/onflow/flow-ft/lib/go/templates v1.0.1 // indirect
 	github.com/onflow/flow-go v0.43.0 // indirect
-	github.com/onflow/flow-go-sdk v1.8.3 // indirect
 	github.com/onflow/flow-nft/lib/go/contracts v1.3.0 // indirect
 	github.com/onflow/flow-nft/lib/go/templates v1.3.0 // indirect
 	github.com/onflow/flow/protobuf/go/flow v0.4.16 // indirect
@@ -233,14 +235,12 @@ require (
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
 	go.yaml.in/yaml/v2 v2.4.2 // indirect
-	golang.org/x/crypto v0.41.0 // indirect
 	golang.org/x/exp v0.0.0-20241217172543-b2144cdd0a67 // indirect
 	golang.org/x/mod v0.27.0 // indirect
 	golang.org/x/net v0.43.0 // indirect
 	golang.org/x/oauth2 v0.30.0 // indirect
 	golang.org/x/sync v0.16.0 // indirect
 	golang.org/x/sys v0.35.0 // indirect
-	golang.org/x/term v0.34.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
 	golang.org/x/time v0.12.0 // indirect
 	golang.org/x/tools v0.36.0 // indirect
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImageChapterUpload uploads the pages of a volume to a chapter that is not on-chain
+// the way the images task does: the chapter is created with its first page, the second
+// page is appended in two chunks and the third whole. The chapter read back must hold
+// the three images, in order and unchanged.
+// Requires: Alexandria deployed to "account" (emulator), flow.json with contracts/accounts/deployments.
+func TestImageChapterUpload(t *testing.T) {
+	o, err := OverflowTesting()
+	require.NoError(t, err)
+	require.NotNil(t, o)
+
+	const bookTitle = "Image Upload"
+	color.White("STARTING Image Chapter Upload TEST")
+
+	dir := t.TempDir()
+	for page := 1; page <= 3; page++ {
+		img := image.NewGray(image.Rect(0, 0, 120, 160))
+		for y := 0; y < 160; y++ {
+			for x := 0; x < 120; x++ {
+				img.Pix[y*img.Stride+x] = uint8(x*page + y)
+			}
+		}
+		file, err := os.Create(filepath.Join(dir, fmt.Sprintf("Flow v01 c001 p%03d.png", page)))
+		require.NoError(t, err)
+		require.NoError(t, png.Encode(file, img))
+		require.NoError(t, file.Close())
+	}
+	volume, err := pipeline.OpenImageVolume(dir)
+	require.NoError(t, err)
+	chapters, err := pipeline.FileImageChapters(volume.Pages, "Chapter %s", 1)
+	require.NoError(t, err)
+	require.Len(t, chapters, 1)
+	uploads, err := pipeline.AssignPages(volume.Pages, chapters, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, uploads, 3)
+	chapterTitle := chapters[0].Title
+
+	var pages [][]string
+	var hashes []string
+	for i, upload := range uploads {
+		encoded, err := pipeline.EncodePage(upload.Page, pipeline.DefaultImageOptions)
+		require.NoError(t, err)
+		paragraphs := []string{encoded.Paragraph()}
+		if i == 1 {
+			paragraphs, err = encoded.Chunks(len(paragraphs[0])/2 + 200)
+			require.NoError(t, err)
+			require.Len(t, paragraphs, 2)
+		}
+		pages = append(pages, paragraphs)
+		hashes = append(hashes, pipeline.HashImage(encoded.Data))
+	}
+
+	o.Tx("Admin/add_book",
+		WithSigner("account"),
+		WithArg("title", pipeline.StringArg(bookTitle)),
+		WithArg("author", pipeline.StringArg("Kentaro Miura")),
+		WithArg("genre", pipeline.StringArg("Manga")),
+		WithArg("edition", pipeline.StringArg("Volume 1")),
+		WithArg("summary", pipeline.StringArg("Image upload test book")),
+	).AssertSuccess(t).Print()
+	o.Tx("Admin/add_chapter_name",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+	).AssertSuccess(t).Print()
+
+	// An empty chapter takes no paragraph, so the first page must create the chapter
+	o.Tx("Admin/add_chapter_name",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg("Empty")),
+	).AssertSuccess(t)
+	o.Tx("Admin/add_chapter",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg("Empty")),
+		WithArg("index", pipeline.IntArg(99)),
+		WithArg("paragraphs", pipeline.StringArrayArg([]string{})),
+	).AssertSuccess(t)
+	o.Tx("Admin/add_paragraph_to_chapter",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg("Empty")),
+		WithArg("paragraph", pipeline.StringArg(pages[0][0])),
+	).AssertFailure(t, "The chapter doesn't have any paragraphs")
+
+	o.Tx("Admin/add_chapter",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+		WithArg("index", pipeline.IntArg(chapters[0].Index)),
+		WithArg("paragraphs", pipeline.StringArrayArg(pages[0])),
+	).AssertSuccess(t).Print()
+	var sent []string
+	sent = append(sent, pages[0]...)
+	for _, paragraphs := range pages[1:] {
+		for _, paragraph := range paragraphs {
+			o.Tx(pipeline.PageAction,
+				WithSigner("account"),
+				WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+				WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+				WithArg("paragraph", pipeline.StringArg(paragraph)),
+			).AssertSuccess(t)
+			sent = append(sent, paragraph)
+		}
+	}
+
+	result := o.Script("get_book_chapter",
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+	)
+	require.NoError(t, result.Err)
+	var chapter pipeline.OnChainChapter
+	require.NoError(t, result.MarshalAs(&chapter))
+	assert.Equal(t, pipeline.HashParagraphs(sent), pipeline.HashParagraphs(chapter.Paragraphs))
+	images, err := pipeline.ReadChapterImages(chapter.Paragraphs)
+	require.NoError(t, err)
+	require.Len(t, images, 3)
+	for i, stored := range images {
+		assert.Equal(t, uploads[i].Page.Label(), stored.ImageID)
+		assert.Equal(t, hashes[i], pipeline.HashImage(stored.Data))
+	}
+	assert.Equal(t, 2, images[1].Paragraphs)
+}
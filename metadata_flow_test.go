@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMetadataRoundTrip sets book and chapter metadata with the admin transactions and
+// checks get_book_metadata decodes back into the typed structs.
+// Requires: Alexandria deployed to "account" (emulator), flow.json with contracts/accounts/deployments.
+func TestMetadataRoundTrip(t *testing.T) {
+	o, err := OverflowTesting()
+	require.NoError(t, err)
+	require.NotNil(t, o)
+
+	const bookTitle, chapterTitle = "Metadata", "Chapter_1"
+	color.White("STARTING Metadata Round-Trip TEST")
+
+	o.Tx("Admin/add_book",
+		WithSigner("account"),
+		WithArg("title", pipeline.StringArg(bookTitle)),
+		WithArg("author", pipeline.StringArg("Friedrich Nietzsche")),
+		WithArg("genre", pipeline.StringArg("Philosophy")),
+		WithArg("edition", pipeline.StringArg("Project Gutenberg eBook #52190")),
+		WithArg("summary", pipeline.StringArg("Metadata test book")),
+	).AssertSuccess(t).Print()
+	o.Tx("Admin/add_chapter_name",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+	).AssertSuccess(t).Print()
+	paragraphs := []string{"Why I am so wise", "Why I am so clever"}
+	o.Tx("Admin/add_chapter",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+		WithArg("index", pipeline.IntArg(1)),
+		WithArg("paragraphs", pipeline.StringArrayArg(paragraphs)),
+	).AssertSuccess(t).Print()
+
+	book := pipeline.BookMetadata{
+		Language:        "English",
+		PublicationYear: 1908,
+		Translator:      "Anthony M. Ludovici",
+		SourceURL:       "https://www.gutenberg.org/ebooks/52190",
+		License:         "Project Gutenberg License",
+		WordCount:       8,
+	}
+	o.Tx("Admin/set_book_metadata",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("metadata", pipeline.MetadataFields(book).Arg()),
+	).AssertSuccess(t).Print()
+	// Setting some keys keeps the others
+	book.Series = "The Complete Works of Friedrich Nietzsche"
+	o.Tx("Admin/set_book_metadata",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("metadata", pipeline.Metadata{"series": book.Series}.Arg()),
+	).AssertSuccess(t).Print()
+	chapter := pipeline.ChapterMetadata{WordCount: pipeline.WordCount(paragraphs)}
+	o.Tx("Admin/set_chapter_metadata",
+		WithSigner("account"),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+		WithArg("metadata", pipeline.MetadataFields(chapter).Arg()),
+	).AssertSuccess(t).Print()
+
+	result := o.Script("get_book_metadata", WithArg("bookTitle", pipeline.StringArg(bookTitle)))
+	require.NoError(t, result.Err)
+	var onChain pipeline.OnChainMetadata
+	require.NoError(t, result.MarshalAs(&onChain))
+
+	var gotBook pipeline.BookMetadata
+	require.NoError(t, pipeline.DecodeMetadata(onChain.Book, &gotBook))
+	assert.Equal(t, book, gotBook)
+	var gotChapter pipeline.ChapterMetadata
+	require.NoError(t, pipeline.DecodeMetadata(onChain.Chapters[chapterTitle], &gotChapter))
+	assert.Equal(t, chapter, gotChapter)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// runCatalog uploads every book listed in a catalog file and writes a report for the
+// whole run. Books already complete in their ledger are skipped. With -concurrency > 1
+// several books are prepared at once, but transactions for the same signer are still
+// sent one at a time. Returns the process exit code.
+func runCatalog(settings uploadSettings, args []string) int {
+	flags := flag.NewFlagSet("catalog", flag.ExitOnError)
+	concurrency := flags.Int("concurrency", 1, "number of books processed at the same time")
+	dryRun := flags.Bool("dry-run", false, "plan and estimate every book without sending transactions")
+	flags.BoolVar(&settings.CreateGenre, "create-genre", false, "create genres that do not exist yet with Admin/add_genre")
+	reportPath := flags.String("report", filepath.Join(settings.LedgerFolder, "catalog_report.json"), "where to write the final report")
+	flags.Parse(args)
+
+	catalogPath := "books/catalog.json"
+	if flags.NArg() > 0 {
+		catalogPath = flags.Arg(0)
+	}
+	catalog, err := pipeline.LoadCatalog(catalogPath)
+	if err != nil {
+		fmt.Printf("Error loading catalog: %v\n", err)
+		return 1
+	}
+	for i := range catalog.Books {
+		if catalog.Books[i].Signer == "" {
+			catalog.Books[i].Signer = settings.Profile.Signer
+		}
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+	settings.DryRun = *dryRun
+
+	o, err := newOverflow(settings)
+	if err != nil {
+		color.Red("%v", err)
+		return 1
+	}
+
+	color.Red("Alexandria Contract - Catalog Upload: %d books from %s", len(catalog.Books), catalogPath)
+
+	// One send lock per signer, shared by all of that signer's books
+	signerLocks := map[string]*sync.Mutex{}
+	for _, book := range catalog.Books {
+		if signerLocks[book.Signer] == nil {
+			signerLocks[book.Signer] = &sync.Mutex{}
+		}
+	}
+
+	report := pipeline.CatalogReport{
+		Network: settings.Network,
+		Catalog: catalogPath,
+		Started: time.Now().UTC(),
+		Books:   make([]pipeline.BookReport, len(catalog.Books)),
+	}
+	slots := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i, book := range catalog.Books {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, book pipeline.BookManifest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			report.Books[i] = catalogBook(o, settings, book, signerLocks[book.Signer])
+		}(i, book)
+	}
+	wg.Wait()
+	report.Finished = time.Now().UTC()
+
+	printCatalogReport(report)
+	if err := report.Write(*reportPath); err != nil {
+		color.Red("Could not write report %s: %v", *reportPath, err)
+	} else {
+		color.Cyan("Report written to %s", *reportPath)
+	}
+	if report.Count(pipeline.BookFailed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// catalogBook loads one catalog book's ledger and sections and uploads it.
+func catalogBook(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, sendLock sync.Locker) pipeline.BookReport {
+	failed := func(err error) pipeline.BookReport {
+		return pipeline.BookReport{Title: book.Title, Status: pipeline.BookFailed, Error: err.Error()}
+	}
+	ledger, err := pipeline.OpenLedger(pipeline.LedgerPath(settings.LedgerFolder, book.Title))
+	if err != nil {
+		return failed(fmt.Errorf("error reading upload ledger: %w", err))
+	}
+	sections, err := loadSections(settings.BooksFolder, book)
+	if err != nil {
+		return failed(fmt.Errorf("error discovering section files: %w", err))
+	}
+	if len(sections) == 0 {
+		return failed(fmt.Errorf("no section files found in %s matching %s", settings.BooksFolder, book.SectionFileRegex))
+	}
+	return uploadBook(o, settings, book, sections, ledger, sendLock)
+}
+
+// printCatalogReport prints one line per book and the run totals.
+func printCatalogReport(report pipeline.CatalogReport) {
+	color.Cyan("\nCatalog report (%s):", report.Network)
+	for _, book := range report.Books {
+		line := fmt.Sprintf("  %-9s %-40s chapters=%-4d txs=%-4d failed=%-3d storage=%dB %s",
+			book.Status, book.Title, book.Chapters, book.Transactions, book.Failed, book.StorageBytes, book.Duration.Round(time.Second))
+		switch book.Status {
+		case pipeline.BookFailed:
+			color.Red("%s %s", line, book.Error)
+		case pipeline.BookComplete:
+			color.Green("%s", line)
+		default:
+			fmt.Println(line)
+		}
+	}
+	color.Cyan("Books: %d   uploaded: %d   already complete: %d   planned: %d   failed: %d",
+		len(report.Books), report.Count(pipeline.BookUploaded), report.Count(pipeline.BookComplete),
+		report.Count(pipeline.BookPlanned), report.Count(pipeline.BookFailed))
+}
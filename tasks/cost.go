@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// plannedTx is one transaction an upload would send, with its exact arguments.
+type plannedTx struct {
+	Name         string
+	Label        string
+	Args         []pipeline.CadenceArg
+	PayloadBytes int
+	StorageBytes int
+	// Entry is the ledger entry uploadBook records for the transaction.
+	Entry pipeline.LedgerEntry
+}
+
+// uploadEstimate totals what an upload of the configured book would send and store.
+type uploadEstimate struct {
+	Transactions []plannedTx
+	PayloadBytes int
+	StorageBytes int
+	// Oversized lists transactions whose arguments exceed the Flow transaction size limit.
+	Oversized []plannedTx
+}
+
+// add counts a planned transaction whose PayloadBytes is set.
+func (e *uploadEstimate) add(tx plannedTx) {
+	e.Transactions = append(e.Transactions, tx)
+	e.PayloadBytes += tx.PayloadBytes
+	e.StorageBytes += tx.StorageBytes
+	if tx.PayloadBytes > pipeline.MaxTransactionBytes {
+		e.Oversized = append(e.Oversized, tx)
+	}
+}
+
+// uploadSteps are the book-level steps an upload takes before its chapters.
+type uploadSteps struct {
+	CreateGenre bool
+	CreateBook  bool
+	SetKeeper   bool
+	// BookMetadata holds the metadata keys to set on the book; empty for none.
+	BookMetadata pipeline.Metadata
+	// ChapterNames are the chapter names the book already has on-chain, which are not
+	// added again even when the ledger has no record of them.
+	ChapterNames map[string]bool
+}
+
+// planUpload builds the transactions an upload would send, following the same
+// steps and ledger resume rules as the upload loop in uploadBook.
+func planUpload(ledger *pipeline.Ledger, network string, book pipeline.BookManifest, sections []chapterFile, steps uploadSteps) (uploadEstimate, error) {
+	var estimate uploadEstimate
+	add := func(tx plannedTx) error {
+		size, err := pipeline.PayloadBytes(tx.Args...)
+		if err != nil {
+			return err
+		}
+		tx.PayloadBytes = size
+		tx.Entry.Network, tx.Entry.Book, tx.Entry.Action = network, book.Title, tx.Name
+		estimate.add(tx)
+		return nil
+	}
+
+	if steps.CreateGenre {
+		err := add(plannedTx{
+			Name:  "Admin/add_genre",
+			Label: book.Genre,
+			Args:  []pipeline.CadenceArg{pipeline.StringArg(book.Genre)},
+		})
+		if err != nil {
+			return estimate, err
+		}
+	}
+	if steps.CreateBook {
+		err := add(plannedTx{
+			Name:  "Admin/add_book",
+			Label: book.Title,
+			Args: []pipeline.CadenceArg{
+				pipeline.StringArg(book.Title),
+				pipeline.StringArg(book.Author),
+				pipeline.StringArg(book.Genre),
+				pipeline.StringArg(book.Edition),
+				pipeline.StringArg(book.Summary),
+			},
+			StorageBytes: pipeline.BookStorageBytes(book.Title, book.Author, book.Genre, book.Edition, book.Summary),
+		})
+		if err != nil {
+			return estimate, err
+		}
+	}
+	if steps.SetKeeper {
+		keeper, err := pipeline.AddressArg(book.Keeper)
+		if err != nil {
+			return estimate, err
+		}
+		err = add(plannedTx{
+			Name:  "account/add_keeper",
+			Label: book.Keeper,
+			Args:  []pipeline.CadenceArg{pipeline.StringArg(book.Title), keeper},
+			Entry: pipeline.LedgerEntry{Keeper: book.Keeper},
+		})
+		if err != nil {
+			return estimate, err
+		}
+	}
+
+	if len(steps.BookMetadata) > 0 {
+		err := add(plannedTx{
+			Name:  "Admin/set_book_metadata",
+			Label: metadataNote(steps.BookMetadata),
+			Args:  []pipeline.CadenceArg{pipeline.StringArg(book.Title), steps.BookMetadata.Arg()},
+			Entry: pipeline.LedgerEntry{Note: metadataNote(steps.BookMetadata)},
+		})
+		if err != nil {
+			return estimate, err
+		}
+	}
+
+	for _, section := range sections {
+		paragraphs, err := readParagraphs(section.Path)
+		if err != nil {
+			return estimate, fmt.Errorf("error reading %s: %w", section.Path, err)
+		}
+		contentHash := pipeline.HashParagraphs(paragraphs)
+		if ledger.ContentSealed(network, section.Title, contentHash) {
+			continue
+		}
+		entry := pipeline.LedgerEntry{
+			Chapter:     section.Title,
+			Index:       section.Index,
+			ContentHash: contentHash,
+			Paragraphs:  len(paragraphs),
+		}
+		label := fmt.Sprintf("%s (index %d, %d paragraphs)", section.Title, section.Index, len(paragraphs))
+		if !ledger.Sealed(network, "Admin/add_chapter_name", section.Title, "") && !steps.ChapterNames[section.Title] {
+			err := add(plannedTx{
+				Name:  "Admin/add_chapter_name",
+				Label: section.Title,
+				Args: []pipeline.CadenceArg{
+					pipeline.StringArg(book.Title),
+					pipeline.StringArg(section.Title),
+				},
+				Entry: entry,
+			})
+			if err != nil {
+				return estimate, err
+			}
+		}
+		err = add(plannedTx{
+			Name:  "Admin/add_chapter",
+			Label: label,
+			Args: []pipeline.CadenceArg{
+				pipeline.StringArg(book.Title),
+				pipeline.StringArg(section.Title),
+				pipeline.IntArg(section.Index),
+				pipeline.StringArrayArg(paragraphs),
+			},
+			StorageBytes: pipeline.ChapterStorageBytes(book.Title, section.Title, paragraphs),
+			Entry:        entry,
+		})
+		if err != nil {
+			return estimate, err
+		}
+		chapterMetadata := chapterMetadataFor(paragraphs)
+		err = add(plannedTx{
+			Name:  "Admin/set_chapter_metadata",
+			Label: section.Title,
+			Args: []pipeline.CadenceArg{
+				pipeline.StringArg(book.Title),
+				pipeline.StringArg(section.Title),
+				chapterMetadata.Arg(),
+			},
+			Entry: pipeline.LedgerEntry{
+				Chapter: section.Title,
+				Index:   section.Index,
+				Note:    metadataNote(chapterMetadata),
+			},
+		})
+		if err != nil {
+			return estimate, err
+		}
+	}
+	return estimate, nil
+}
+
+// fetchStorageInfo reads the storage use, capacity and balance of the account at
+// address, and the FLOW reservation it needs once additional bytes are saved.
+func fetchStorageInfo(o *OverflowState, address string, additional int) (pipeline.StorageInfo, error) {
+	var info pipeline.StorageInfo
+	addressArg, err := pipeline.AddressArg(address)
+	if err != nil {
+		return info, err
+	}
+	result := o.Script("get_storage_info",
+		WithArg("address", addressArg),
+		WithArg("additionalBytes", pipeline.UInt64Arg(uint64(additional))),
+	)
+	if result.Err != nil {
+		return info, result.Err
+	}
+	if err := result.MarshalAs(&info); err != nil {
+		return info, fmt.Errorf("failed to decode storage info: %w", err)
+	}
+	return info, nil
+}
+
+// checkCost prints the estimate for an upload and compares it with the signer's
+// storage, and returns the cost to confirm it with. It returns an error, and the upload
+// must not start, if a transaction is too large or the book would not fit in the
+// signer's storage capacity.
+func checkCost(o *OverflowState, settings uploadSettings, signer string, estimate uploadEstimate, verbose bool) (pipeline.CostEstimate, error) {
+	if verbose {
+		for _, tx := range estimate.Transactions {
+			fmt.Printf("  %-24s %-48s payload %10d B   storage %10d B\n", tx.Name, tx.Label, tx.PayloadBytes, tx.StorageBytes)
+		}
+	}
+	cost := pipeline.FeeEstimate(len(estimate.Transactions))
+	cost.StorageBytes = estimate.StorageBytes
+	color.Cyan("Transactions: %d   Payload: %d bytes   Storage: %d bytes (%.2f MB)",
+		cost.Transactions, estimate.PayloadBytes, estimate.StorageBytes, float64(estimate.StorageBytes)/1_000_000)
+	color.Cyan("Estimated fees: up to %.4f FLOW", cost.Fees)
+
+	for _, tx := range estimate.Oversized {
+		color.Red("%s %s: arguments are %d bytes, over the %d byte transaction limit",
+			tx.Name, tx.Label, tx.PayloadBytes, pipeline.MaxTransactionBytes)
+	}
+
+	address, err := accountAddress(settings, signer)
+	if err != nil {
+		return cost, err
+	}
+	info, err := fetchStorageInfo(o, address, estimate.StorageBytes)
+	if err != nil {
+		return cost, fmt.Errorf("could not read storage of %s: %w", signer, err)
+	}
+	cost.Reservation = info.ReservationRequired
+	color.Cyan("Signer %s (%s): balance %.8f FLOW, available %.8f FLOW", signer, info.Address, info.Balance, info.AvailableBalance)
+	color.Cyan("Storage: %d of %d bytes used, %d after upload", info.Used, info.Capacity, info.Used+uint64(estimate.StorageBytes))
+	color.Cyan("Storage reservation required: %.8f FLOW (current capacity is backed by %.8f FLOW)",
+		info.ReservationRequired, info.ReservationCurrent)
+
+	if len(estimate.Oversized) > 0 {
+		return cost, fmt.Errorf("%d transactions exceed the transaction size limit", len(estimate.Oversized))
+	}
+	if !info.Fits(uint64(estimate.StorageBytes)) {
+		return cost, fmt.Errorf("upload needs %d bytes but %s has %d bytes free; deposit at least %.8f FLOW",
+			estimate.StorageBytes, signer, info.Capacity-info.Used, info.Shortfall())
+	}
+	return cost, nil
+}
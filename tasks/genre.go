@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// fetchGenres reads every genre registered in the library with the get_genres script.
+func fetchGenres(o *OverflowState) ([]string, error) {
+	result := o.Script("get_genres")
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	var genres []string
+	if err := result.MarshalAs(&genres); err != nil {
+		return nil, fmt.Errorf("failed to decode genres: %w", err)
+	}
+	return genres, nil
+}
+
+// checkGenre makes sure a new book's genre already exists on-chain, since Admin/add_book
+// accepts any string and a typo silently opens a new genre. An unknown genre is refused,
+// with the closest existing genres as suggestions, unless createGenre is set.
+// Returns true when the genre must be created with Admin/add_genre before the book.
+func checkGenre(o *OverflowState, genre string, createGenre bool) (bool, error) {
+	genres, err := fetchGenres(o)
+	if err != nil {
+		return false, fmt.Errorf("could not read genres: %w", err)
+	}
+	match := pipeline.MatchGenre(genre, genres)
+	if match.Exact {
+		color.Green("Genre %q exists on-chain.", genre)
+		return false, nil
+	}
+	hint := ""
+	if len(match.Suggestions) > 0 {
+		hint = fmt.Sprintf(" Did you mean %s?", quoteAll(match.Suggestions))
+	}
+	if !createGenre {
+		return false, fmt.Errorf("genre %q does not exist on-chain.%s Pass --create-genre to create it", genre, hint)
+	}
+	color.Yellow("Genre %q does not exist on-chain and will be created.%s", genre, hint)
+	return true, nil
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(quoted, " or ")
+}
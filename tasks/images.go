@@ -0,0 +1,573 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// pageKey identifies a page of a chapter in an image upload.
+type pageKey struct {
+	Chapter string
+	Page    string
+}
+
+// runImages uploads the page images of a volume, a directory or a .zip/.cbz archive, to
+// chapters of an existing book, given or read from the page names: one
+// Admin/add_paragraph_to_chapter transaction per page,
+// each page an image paragraph (see pipeline.Paragraph) encoded at the best quality
+// and size that fit the byte budget, gray pages in the smallest of grayscale JPEG and
+// gray-palette or bilevel PNG. A page that cannot fit is refused, or with
+// -oversize chunk sent as image chunk paragraphs. A missing chapter is created with its
+// first page, as the contract refuses to append to an empty chapter.
+// Pages the ledger has sealed for their chapter are skipped, so an interrupted upload
+// resumes where it stopped.
+// Returns the process exit code.
+func runImages(settings uploadSettings, args []string) int {
+	flags := flag.NewFlagSet("images", flag.ExitOnError)
+	volumePath := flags.String("dir", "", "directory or .zip/.cbz archive holding the page images")
+	bookTitle := flags.String("book", "", "title of the book the pages are added to")
+	var chapterSpecs stringList
+	flags.Var(&chapterSpecs, "chapter", `chapter for the pages: "Chapter I", "Chapter I=p001-p040", "Chapter I=c001", or "Cover=cover", "Credits=credits", "Extras=extra" (repeatable, in page order); without it, one chapter per chapter number in the page names`)
+	chapterTitle := flags.String("chapter-title", "Chapter %s", "title of the chapters read from the page names; %s is the chapter number (ComicInfo.xml's title is used for its chapter)")
+	firstIndex := flags.Int("index", 1, "chapter index of the first chapter, for chapters that are created; the next ones follow")
+	start := flags.String("start", "", "first page to upload, e.g. p011")
+	end := flags.String("end", "", "last page to upload, e.g. p040")
+	signer := flags.String("signer", settings.Profile.Signer, "account that owns the book")
+	opts := pipeline.DefaultImageOptions
+	flags.IntVar(&opts.MaxWidth, "max-width", opts.MaxWidth, "scale wider pages down to this width")
+	flags.IntVar(&opts.SpreadWidth, "spread-width", opts.SpreadWidth, "scale wider double-page spreads kept whole down to this width")
+	spreads := flags.String("spreads", pipeline.SpreadsWhole, "double-page spreads (p006-007, or wider than tall): whole, or split into two pages")
+	readingOrder := flags.String("reading-order", "", "reading order of split spreads: rtl (manga) or ltr; default ComicInfo.xml's, else rtl")
+	flags.IntVar(&opts.Quality, "quality", opts.Quality, "highest JPEG quality tried, 1-100")
+	flags.IntVar(&opts.MinQuality, "min-quality", opts.MinQuality, "lowest JPEG quality accepted to fit the budget")
+	flags.Float64Var(&opts.MinScale, "min-scale", opts.MinScale, "smallest fraction of its width a page is scaled down to to fit the budget")
+	flags.IntVar(&opts.Budget, "budget", opts.Budget, "largest page paragraph in bytes, base64 encoded")
+	flags.Float64Var(&opts.MinPSNR, "min-psnr", opts.MinPSNR, "lowest fidelity, in dB, of a gray-palette or bilevel PNG for a gray page to be stored as one")
+	flags.BoolVar(&opts.KeepColor, "keep-color", false, "encode every page as color JPEG, without trying grayscale JPEG and PNG for gray pages")
+	oversize := flags.String("oversize", "refuse", "pages that do not fit the budget: refuse, or chunk to send them in several paragraphs")
+	dryRun := flags.Bool("dry-run", false, "plan and check the cost without sending transactions")
+	flags.Parse(args)
+
+	if *volumePath == "" || *bookTitle == "" {
+		color.Red("images needs -dir and -book")
+		return 2
+	}
+	if strings.Count(*chapterTitle, "%s") != 1 {
+		color.Red("-chapter-title needs one %%s for the chapter number, not %q", *chapterTitle)
+		return 2
+	}
+	if *oversize != "refuse" && *oversize != "chunk" {
+		color.Red("-oversize must be refuse or chunk, not %q", *oversize)
+		return 2
+	}
+	if opts.Budget <= 0 || opts.Budget > pipeline.MaxTransactionBytes {
+		color.Red("-budget must be between 1 and %d bytes", pipeline.MaxTransactionBytes)
+		return 2
+	}
+	var chapters []pipeline.ImageChapter
+	for i, spec := range chapterSpecs {
+		chapter, err := pipeline.ParseImageChapter(spec, *firstIndex+i)
+		if err != nil {
+			color.Red("%v", err)
+			return 2
+		}
+		chapters = append(chapters, chapter)
+	}
+	first, last := 0, 0
+	var err error
+	if *start != "" {
+		if first, err = pipeline.ParsePage(*start); err != nil {
+			color.Red("-start: %v", err)
+			return 2
+		}
+	}
+	if *end != "" {
+		if last, err = pipeline.ParsePage(*end); err != nil {
+			color.Red("-end: %v", err)
+			return 2
+		}
+	}
+
+	color.Red("Alexandria Contract - %s Image Upload (%s)", *bookTitle, settings.Network)
+	color.Red("")
+	volume, err := pipeline.OpenImageVolume(*volumePath)
+	if err != nil {
+		color.Red("Error reading images: %v", err)
+		return 1
+	}
+	if info := volume.Info; info != nil {
+		color.Cyan("ComicInfo.xml: %s #%s %q %s", info.Series, info.Number, info.Title, info.Credits())
+		if *readingOrder == "" {
+			*readingOrder = info.ReadingOrder()
+		}
+	}
+	for _, name := range volume.Unnumbered {
+		color.Yellow("Skipping %s: no page number (like p011) in its name", name)
+	}
+	for _, name := range volume.Deleted {
+		color.Yellow("Skipping %s: ComicInfo.xml marks it deleted", name)
+	}
+	for _, gap := range pipeline.PageGaps(volume.Pages) {
+		color.Yellow("Gap in the page numbering: %s is missing", gap)
+	}
+	if len(chapters) == 0 {
+		if chapters, err = pipeline.FileImageChapters(volume.Pages, *chapterTitle, *firstIndex); err != nil {
+			color.Red("%v", err)
+			return 2
+		}
+		for i, chapter := range chapters {
+			if info := volume.Info; info != nil && info.Title != "" && info.Chapter() == chapter.FileChapter {
+				chapters[i].Title = info.Title
+			}
+			color.Cyan("Chapter %s of the page names goes to %q (index %d)", chapter.FileChapter, chapters[i].Title, chapter.Index)
+		}
+	}
+	// Covers and credits with no page number are only uploaded to a chapter of their kind.
+	pages := volume.Pages
+	for _, extra := range volume.Extras {
+		if slices.ContainsFunc(chapters, func(c pipeline.ImageChapter) bool { return c.Kind == extra.Kind }) {
+			pages = append(pages, extra)
+		} else {
+			color.Yellow("Skipping %s: a %s page with no page number; add a chapter for it, like -chapter \"<title>=%s\"", extra.Name, extra.Kind, extra.Kind)
+		}
+	}
+	pages, err = pipeline.LayoutSpreads(pages, *spreads, orDefault(*readingOrder, pipeline.RightToLeft))
+	if err != nil {
+		color.Red("%v", err)
+		return 1
+	}
+	uploads, err := pipeline.AssignPages(pages, chapters, first, last)
+	if err != nil {
+		color.Red("%v", err)
+		return 1
+	}
+	if len(uploads) == 0 {
+		color.Red("No page images in %s between %s and %s.", *volumePath, orDefault(*start, "the first"), orDefault(*end, "the last"))
+		return 1
+	}
+	color.Cyan("%d pages in %s, in %d chapters", len(uploads), *volumePath, len(chapters))
+
+	ledger, err := pipeline.OpenLedger(pipeline.LedgerPath(settings.LedgerFolder, *bookTitle))
+	if err != nil {
+		color.Red("Error reading upload ledger: %v", err)
+		return 1
+	}
+	o, err := newOverflow(settings)
+	if err != nil {
+		color.Red("%v", err)
+		return 1
+	}
+	if result := o.Script("get_book", WithArg("bookTitle", pipeline.StringArg(*bookTitle))); result.Err != nil {
+		color.Red("Book %q is not in the library on %s; create it before adding pages: %v", *bookTitle, settings.Network, result.Err)
+		return 1
+	}
+
+	estimate, err := planImages(o, settings, ledger, *bookTitle, chapters, uploads, opts, *oversize == "chunk")
+	if err != nil {
+		color.Red("Refusing to start: %v", err)
+		return 1
+	}
+	if len(estimate.Transactions) == 0 {
+		color.Green("Ledger: every page is already sealed on %s. Nothing to do.", settings.Network)
+		return 0
+	}
+	color.Cyan("\nCost estimate for %s on %s:", *bookTitle, settings.Network)
+	cost, err := checkCost(o, settings, *signer, estimate, *dryRun)
+	if err != nil {
+		color.Red("Refusing to start: %v", err)
+		return 1
+	}
+	if *dryRun {
+		color.Green("\nDry run complete. No transactions were sent.")
+		return 0
+	}
+	if err := guardWrite(settings, *bookTitle, cost); err != nil {
+		color.Red("Refusing to start: %v", err)
+		return 1
+	}
+
+	byKey := map[pageKey]pipeline.ImagePage{}
+	for _, upload := range uploads {
+		byKey[pageKey{upload.Chapter.Title, upload.Page.Label()}] = upload.Page
+	}
+	pageCount := 0
+	for _, tx := range estimate.Transactions {
+		if tx.Entry.Page != "" && tx.Entry.Chunk == tx.Entry.Chunks {
+			pageCount++
+		}
+	}
+	progress := pipeline.NewProgress(pageCount, estimate.PayloadBytes, time.Now())
+	progress.Unit = "pages"
+	for _, tx := range estimate.Transactions {
+		entry := tx.Entry
+		options := []OverflowInteractionOption{
+			WithSigner(*signer),
+			WithArg("bookTitle", pipeline.StringArg(entry.Book)),
+			WithArg("chapterTitle", pipeline.StringArg(entry.Chapter)),
+		}
+		switch tx.Name {
+		case "Admin/add_chapter_name":
+			color.Yellow("Adding chapter name on-chain: %s", entry.Chapter)
+		case "Admin/set_chapter_metadata":
+			color.Yellow("Setting the spreads of %s", entry.Chapter)
+			options = append(options, WithArg("metadata", tx.Args[2]))
+		case "Admin/add_chapter", pipeline.PageAction:
+			color.Cyan("Uploading %s", tx.Label)
+			paragraphs, err := encodePage(byKey[pageKey{entry.Chapter, entry.Page}], opts, entry.Chunks > 0)
+			if err != nil {
+				color.Red("%v", err)
+				return 1
+			}
+			if pipeline.HashParagraphs(paragraphs) != entry.ContentHash || len(paragraphs) != max(entry.Chunks, 1) {
+				color.Red("%s encoded differently than when it was planned; nothing more was sent", entry.Note)
+				return 1
+			}
+			paragraph := paragraphs[max(entry.Chunk, 1)-1]
+			if tx.Name == pipeline.PageAction {
+				options = append(options, WithArg("paragraph", pipeline.StringArg(paragraph)))
+				break
+			}
+			color.Yellow("Creating chapter %s (index %d) with its first page", entry.Chapter, entry.Index)
+			options = append(options,
+				WithArg("index", pipeline.IntArg(entry.Index)),
+				WithArg("paragraphs", pipeline.StringArrayArg([]string{paragraph})),
+			)
+		}
+		result := o.Tx(tx.Name, options...)
+		err := recordTx(o, settings, ledger, entry, result)
+		result.Print()
+		progress.BytesSent += tx.PayloadBytes
+		if err != nil {
+			// Pages are stored in the order they are sent, so a failed page stops the upload.
+			color.Red("✗ %s: %v\nRun the same command again to resume from this page.", tx.Label, err)
+			return 1
+		}
+		if entry.Page != "" && entry.Chunk == entry.Chunks {
+			progress.ChaptersDone++
+			now := time.Now()
+			color.Cyan("%s", progress.Line(now))
+			settings.Log.Write(progress.Record(settings.Network, entry.Book, now))
+		}
+	}
+	color.Green("\n✓ Uploaded %d pages to %s.", pageCount, *bookTitle)
+	return 0
+}
+
+// planImages plans an image upload: append every page the ledger does not have sealed
+// for its chapter. A chapter that is not on-chain is created by an Admin/add_chapter
+// holding the first paragraph planned for it, and only the ones after it are appended;
+// it is not created when none is planned. Each page is
+// encoded to measure it; it is encoded again when it is sent. When the chapter holds
+// paragraphs the ledger did not record, its images are read back, and pages whose
+// image hash is among them are skipped too. A page over the budget
+// is an error, unless chunk is set: it is then planned as one transaction per chunk,
+// and the chunks of a partly sent page that are sealed are skipped.
+func planImages(o *OverflowState, settings uploadSettings, ledger *pipeline.Ledger, bookTitle string, chapters []pipeline.ImageChapter, uploads []pipeline.ImageUpload, opts pipeline.ImageOptions, chunk bool) (uploadEstimate, error) {
+	var estimate uploadEstimate
+	// encodings counts the pages planned in each encoding, for the summary.
+	encodings := map[string]int{}
+	encodedBytes, sourceBytes := 0, 0
+	titles, err := fetchChapterTitles(o, bookTitle)
+	if err != nil {
+		return estimate, fmt.Errorf("could not read the chapters of %s: %w", bookTitle, err)
+	}
+	named := map[string]bool{}
+	for _, title := range titles {
+		named[title] = true
+	}
+	add := func(name, label string, entry pipeline.LedgerEntry, storage int, args ...pipeline.CadenceArg) error {
+		size, err := pipeline.PayloadBytes(args...)
+		if err != nil {
+			return err
+		}
+		entry.Network, entry.Book, entry.Action = settings.Network, bookTitle, name
+		estimate.add(plannedTx{Name: name, Label: label, PayloadBytes: size, StorageBytes: storage, Entry: entry})
+		return nil
+	}
+
+	for _, chapter := range chapters {
+		entry := pipeline.LedgerEntry{Chapter: chapter.Title, Index: chapter.Index}
+		sealed := ledger.SealedPages(settings.Network, chapter.Title)
+		partial := ledger.PartialPages(settings.Network, chapter.Title)
+		// stored counts the paragraphs the ledger has sealed in the chapter: one per
+		// page sent whole, one per chunk of the others.
+		stored := 0
+		for _, sealedEntry := range sealed {
+			stored += max(sealedEntry.Chunks, 1)
+		}
+		for page, hash := range partial {
+			stored += len(ledger.SealedChunks(settings.Network, chapter.Title, page, hash))
+		}
+		length, err := fetchChapterLength(o, bookTitle, chapter.Title)
+		onChain := err == nil
+		// create is set while the chapter is to be created with the next paragraph
+		// planned, and name if its name must be added first.
+		create, name := false, false
+		// chain indexes the images the chapter holds, when the ledger does not account
+		// for all of them.
+		var chain *pipeline.StoredImages
+		switch {
+		case err != nil && !strings.Contains(err.Error(), "doesn't exist"):
+			return estimate, fmt.Errorf("could not read chapter %s: %w", chapter.Title, err)
+		case err != nil:
+			if stored > 0 {
+				return estimate, fmt.Errorf("the ledger has %d paragraphs sealed in %s, but the chapter is not on-chain", stored, chapter.Title)
+			}
+			create, name = true, !named[chapter.Title]
+			length = 0
+		case stored > length:
+			return estimate, fmt.Errorf("the ledger has %d paragraphs sealed in %s, but the chapter holds %d; check it before resuming", stored, chapter.Title, length)
+		case length > stored:
+			color.Yellow("%s already holds %d paragraphs the ledger did not record; reading them back to skip the pages among them.", chapter.Title, length-stored)
+			paragraphs, err := fetchParagraphs(o, bookTitle, chapter.Title)
+			if err != nil {
+				return estimate, fmt.Errorf("could not read chapter %s: %w", chapter.Title, err)
+			}
+			if chain, err = pipeline.NewStoredImages(paragraphs); err != nil {
+				return estimate, fmt.Errorf("%s on-chain: %w", chapter.Title, err)
+			}
+			// A chunked page the chapter stops in the middle of is finished like one the
+			// ledger knows is partly sent.
+			if chain.Partial != nil {
+				if _, ok := partial[chain.Partial.ImageID]; !ok {
+					partial[chain.Partial.ImageID] = ""
+				}
+			}
+		}
+
+		// lastSealed is the page stored last in the chapter, if any is.
+		var lastSealed *pipeline.PageRef
+		for label := range sealed {
+			page, err := pipeline.ParsePageRef(label)
+			if err != nil {
+				return estimate, fmt.Errorf("ledger, %s: %w", chapter.Title, err)
+			}
+			if lastSealed == nil || lastSealed.Before(page) {
+				lastSealed = &page
+			}
+		}
+		for label := range partial {
+			page, err := pipeline.ParsePageRef(label)
+			if err != nil {
+				return estimate, fmt.Errorf("ledger, %s: %w", chapter.Title, err)
+			}
+			// Nothing can be appended after a partly sent page but its own chunks.
+			if len(partial) > 1 || (lastSealed != nil && page.Before(*lastSealed)) {
+				return estimate, fmt.Errorf("%s of %s is only partly uploaded and other pages follow it; check the chapter before resuming", label, chapter.Title)
+			}
+			lastSealed = &page
+		}
+		resumed := len(partial) == 0
+		// position is where the next paragraph lands in the chapter; spreads are the
+		// positions of the spreads kept whole, for the chapter's metadata, which is set
+		// before its pages, or right after the chapter is created.
+		position := length
+		var spreads []int
+		metadataAt := len(estimate.Transactions)
+		// found counts the pages already on-chain that the ledger did not record, and
+		// planned is set once a page of the chapter is planned: none can be found after.
+		found, planned := 0, false
+		for _, upload := range uploads {
+			if upload.Chapter.Title != chapter.Title {
+				continue
+			}
+			page := upload.Page
+			if _, ok := sealed[page.Label()]; ok {
+				continue
+			}
+			encoded, err := pipeline.EncodePage(page, opts)
+			if err != nil {
+				return estimate, err
+			}
+			imageHash := pipeline.HashImage(encoded.Data)
+			if chain != nil && chain.Take(page.Label(), imageHash) {
+				if planned {
+					return estimate, fmt.Errorf("%s is already in %s, but pages before it are not; pages are stored in the order they are uploaded, so check the chapter before resuming", page.Label(), chapter.Title)
+				}
+				found++
+				continue
+			}
+			if lastSealed != nil && page.Before(*lastSealed) {
+				return estimate, fmt.Errorf("%s comes before %s, already in %s; pages are stored in the order they are uploaded", page.Label(), lastSealed.Label(), chapter.Title)
+			}
+			if _, ok := partial[page.Label()]; !ok && !resumed {
+				return estimate, fmt.Errorf("%s of %s is only partly uploaded; include it to finish it first", lastSealed.Label(), chapter.Title)
+			}
+			paragraphs := []string{encoded.Paragraph()}
+			if encoded.OverBudget {
+				if !chunk {
+					return estimate, fmt.Errorf("%s does not fit the %d-byte budget even at quality %d and %.0f%% of its width; lower -min-quality or -min-scale, or send it in parts with -oversize chunk",
+						page.Name, opts.Budget, opts.MinQuality, opts.MinScale*100)
+				}
+				if paragraphs, err = encoded.Chunks(opts.Budget); err != nil {
+					return estimate, fmt.Errorf("%s: %w", page.Name, err)
+				}
+			}
+			pageEntry := entry
+			pageEntry.Page = page.Label()
+			pageEntry.ContentHash = pipeline.HashParagraphs(paragraphs)
+			pageEntry.ImageHash = imageHash
+			pageEntry.Paragraphs = 1
+			pageEntry.Note = page.Name
+			fmt.Printf("  %s %s: %s\n", chapter.Title, pageEntry.Page, encoded.Stats())
+			encodings[encoded.Encoding]++
+			encodedBytes, sourceBytes = encodedBytes+len(encoded.Data), sourceBytes+encoded.SourceBytes
+			encoding := encoded.Encoding
+			if encoded.Quality > 0 {
+				encoding += fmt.Sprintf(" q%d", encoded.Quality)
+			}
+			label := fmt.Sprintf("%s %s (%dx%d, %s)", chapter.Title, pageEntry.Page, encoded.Width, encoded.Height, encoding)
+			switch {
+			case page.Spread:
+				label = strings.Replace(label, " (", " (spread, ", 1)
+			case page.Half == pipeline.LeftHalf:
+				pageEntry.Note += " (left half)"
+			case page.Half == pipeline.RightHalf:
+				pageEntry.Note += " (right half)"
+			}
+			var done map[int]bool
+			if hash, ok := partial[page.Label()]; ok {
+				onChainPart := chain != nil && chain.Partial != nil && chain.Partial.ImageID == page.Label()
+				if (hash != "" && hash != pageEntry.ContentHash) || (onChainPart && (chain.Partial.SHA256 != imageHash || chain.Partial.Count != len(paragraphs))) {
+					return estimate, fmt.Errorf("%s encodes differently than the part already uploaded; resume with the same image options", page.Name)
+				}
+				done = ledger.SealedChunks(settings.Network, chapter.Title, page.Label(), hash)
+				for i := 1; onChainPart && i <= chain.Partial.Chunks; i++ {
+					done[i] = true
+				}
+				resumed = true
+			}
+			planned = true
+			if page.Spread {
+				spreads = append(spreads, position-len(done))
+			}
+			for i, paragraph := range paragraphs {
+				if done[i+1] {
+					continue
+				}
+				position++
+				chunkEntry, chunkLabel := pageEntry, label
+				if len(paragraphs) > 1 {
+					chunkEntry.Chunk, chunkEntry.Chunks = i+1, len(paragraphs)
+					chunkLabel = fmt.Sprintf("%s part %d/%d", label, i+1, len(paragraphs))
+				}
+				if !create {
+					err = add(pipeline.PageAction, chunkLabel, chunkEntry, pipeline.ParagraphStorageBytes(paragraph),
+						pipeline.StringArg(bookTitle), pipeline.StringArg(chapter.Title), pipeline.StringArg(paragraph))
+					if err != nil {
+						return estimate, err
+					}
+					continue
+				}
+				if name {
+					err := add("Admin/add_chapter_name", chapter.Title, entry, 0,
+						pipeline.StringArg(bookTitle), pipeline.StringArg(chapter.Title))
+					if err != nil {
+						return estimate, err
+					}
+				}
+				err = add("Admin/add_chapter", fmt.Sprintf("%s, new chapter (index %d)", chunkLabel, chapter.Index), chunkEntry,
+					pipeline.ChapterStorageBytes(bookTitle, chapter.Title, []string{paragraph}),
+					pipeline.StringArg(bookTitle), pipeline.StringArg(chapter.Title), pipeline.IntArg(chapter.Index), pipeline.StringArrayArg([]string{paragraph}))
+				if err != nil {
+					return estimate, err
+				}
+				// The chapter's metadata can only be set once it exists.
+				create, metadataAt = false, len(estimate.Transactions)
+			}
+		}
+		if !resumed {
+			return estimate, fmt.Errorf("%s of %s is only partly uploaded; include it to finish it first", lastSealed.Label(), chapter.Title)
+		}
+		if len(spreads) > 0 {
+			if err := planSpreads(o, &estimate, metadataAt, settings, bookTitle, chapter, onChain, spreads); err != nil {
+				return estimate, err
+			}
+		}
+		if skipped := len(sealed); skipped > 0 {
+			color.Green("Ledger: %d pages of %s already sealed on %s. Skipping them.", skipped, chapter.Title, settings.Network)
+		}
+		if found > 0 {
+			color.Green("%d pages of %s are already on-chain by their image hash. Skipping them.", found, chapter.Title)
+		}
+	}
+	if len(encodings) > 0 {
+		var counts []string
+		for _, encoding := range slices.Sorted(maps.Keys(encodings)) {
+			counts = append(counts, fmt.Sprintf("%d %s", encodings[encoding], encoding))
+		}
+		color.Cyan("Encoded %s: %d bytes from %d bytes of source images", strings.Join(counts, ", "), encodedBytes, sourceBytes)
+	}
+	return estimate, nil
+}
+
+// planSpreads plans, at index at of the estimate, the Admin/set_chapter_metadata
+// transaction that adds the positions of a chapter's spreads kept whole to those it
+// holds on-chain, unless it already has them all. It goes before the chapter's pages, or
+// after the one that creates it: they land at the planned positions even if the upload
+// stops and resumes.
+func planSpreads(o *OverflowState, estimate *uploadEstimate, at int, settings uploadSettings, bookTitle string, chapter pipeline.ImageChapter, onChain bool, spreads []int) error {
+	var current pipeline.ChapterMetadata
+	if onChain {
+		metadata, err := fetchMetadata(o, bookTitle)
+		if err != nil {
+			return fmt.Errorf("could not read the metadata of %s: %w", bookTitle, err)
+		}
+		if err := pipeline.DecodeMetadata(metadata.Chapters[chapter.Title], &current); err != nil {
+			return fmt.Errorf("%s: %w", chapter.Title, err)
+		}
+	}
+	positions, err := pipeline.ParseSpreads(current.Spreads)
+	if err != nil {
+		return fmt.Errorf("%s: %w", chapter.Title, err)
+	}
+	want := pipeline.MetadataFields(pipeline.ChapterMetadata{Spreads: pipeline.FormatSpreads(append(positions, spreads...))})
+	changed := want.Changed(pipeline.MetadataFields(current))
+	if len(changed) == 0 {
+		return nil
+	}
+	args := []pipeline.CadenceArg{pipeline.StringArg(bookTitle), pipeline.StringArg(chapter.Title), changed.Arg()}
+	size, err := pipeline.PayloadBytes(args...)
+	if err != nil {
+		return err
+	}
+	estimate.add(plannedTx{
+		Name:         "Admin/set_chapter_metadata",
+		Label:        fmt.Sprintf("%s (spreads %v)", chapter.Title, changed["spreads"]),
+		Args:         args,
+		PayloadBytes: size,
+		Entry: pipeline.LedgerEntry{
+			Network: settings.Network,
+			Book:    bookTitle,
+			Action:  "Admin/set_chapter_metadata",
+			Chapter: chapter.Title,
+			Index:   chapter.Index,
+			Note:    metadataNote(changed),
+		},
+	})
+	last := len(estimate.Transactions) - 1
+	estimate.Transactions = slices.Insert(estimate.Transactions[:last], at, estimate.Transactions[last])
+	return nil
+}
+
+// encodePage reads and encodes a page as the paragraphs that are sent: the whole page,
+// or its image chunks when chunk is set and it is over the budget.
+func encodePage(page pipeline.ImagePage, opts pipeline.ImageOptions, chunk bool) ([]string, error) {
+	encoded, err := pipeline.EncodePage(page, opts)
+	if err != nil {
+		return nil, err
+	}
+	if chunk && encoded.OverBudget {
+		return encoded.Chunks(opts.Budget)
+	}
+	return []string{encoded.Paragraph()}, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// fetchKeeper reads a book's keeper with get_book_keeper. Returns "" if it has none.
+func fetchKeeper(o *OverflowState, bookTitle string) (string, error) {
+	result := o.Script("get_book_keeper", WithArg("bookTitle", pipeline.StringArg(bookTitle)))
+	if result.Err != nil {
+		return "", result.Err
+	}
+	var keeper string
+	if err := result.MarshalAs(&keeper); err != nil {
+		return "", fmt.Errorf("failed to decode keeper: %w", err)
+	}
+	if keeper == "" {
+		return "", nil
+	}
+	return pipeline.ParseAddress(keeper)
+}
+
+// fetchKeepers reads every book in the library with its keeper, "" for none, with get_book_keepers.
+func fetchKeepers(o *OverflowState) (map[string]string, error) {
+	result := o.Script("get_book_keepers")
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	var keepers map[string]string
+	if err := result.MarshalAs(&keepers); err != nil {
+		return nil, fmt.Errorf("failed to decode keepers: %w", err)
+	}
+	for title, keeper := range keepers {
+		if keeper == "" {
+			continue
+		}
+		address, err := pipeline.ParseAddress(keeper)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", title, err)
+		}
+		keepers[title] = address
+	}
+	return keepers, nil
+}
+
+// assignKeeper sends account/add_keeper, which attaches a Keeper to the book or changes
+// the one it has. It must be signed by the account the contract is deployed to.
+func assignKeeper(o *OverflowState, settings uploadSettings, ledger *pipeline.Ledger, signer, bookTitle, keeper string) error {
+	keeperArg, err := pipeline.AddressArg(keeper)
+	if err != nil {
+		return err
+	}
+	result := o.Tx("account/add_keeper",
+		WithSigner(signer),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("keeper", keeperArg),
+	)
+	err = recordTx(o, settings, ledger, pipeline.LedgerEntry{
+		Network: settings.Network,
+		Book:    bookTitle,
+		Action:  "account/add_keeper",
+		Keeper:  keeper,
+	}, result)
+	result.Print()
+	return err
+}
+
+// keeperAssignment is one book whose keeper a bulk assignment sets.
+type keeperAssignment struct {
+	Book    string
+	Current string
+	Keeper  string
+}
+
+// runKeepers lists every book in the library with its keeper, or with "assign" sets
+// keepers in bulk: one -keeper for the named books (or every book without one, with
+// -missing), or each book's keeper from a catalog. Returns the process exit code.
+func runKeepers(settings uploadSettings, args []string) int {
+	command := "list"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("keepers "+command, flag.ExitOnError)
+	missing := flags.Bool("missing", false, "only books without a keeper")
+	keeper := flags.String("keeper", "", "address to assign as keeper")
+	catalogPath := flags.String("catalog", "", "assign each catalog book the keeper it lists")
+	dryRun := flags.Bool("dry-run", false, "print the assignments without sending transactions")
+	flags.Parse(args)
+
+	o, err := newOverflow(settings)
+	if err != nil {
+		color.Red("%v", err)
+		return 1
+	}
+	keepers, err := fetchKeepers(o)
+	if err != nil {
+		color.Red("Could not read keepers: %v", err)
+		return 1
+	}
+	titles := make([]string, 0, len(keepers))
+	for title := range keepers {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+
+	if command == "list" {
+		without := 0
+		for _, title := range titles {
+			if keepers[title] == "" {
+				without++
+				color.Yellow("  %-48s no keeper", title)
+			} else if !*missing {
+				fmt.Printf("  %-48s %s\n", title, keepers[title])
+			}
+		}
+		color.Cyan("\n%d books, %d without a keeper.", len(titles), without)
+		return 0
+	}
+	if command != "assign" {
+		fmt.Printf("Unknown keepers command %q (expected list or assign)\n", command)
+		return 2
+	}
+
+	targets := map[string]string{}
+	switch {
+	case *catalogPath != "":
+		catalog, err := pipeline.LoadCatalog(*catalogPath)
+		if err != nil {
+			color.Red("Error reading catalog: %v", err)
+			return 1
+		}
+		for _, book := range catalog.Books {
+			if book.Keeper != "" && (!*missing || keepers[book.Title] == "") {
+				targets[book.Title] = book.Keeper
+			}
+		}
+	case *keeper != "":
+		address, err := pipeline.ParseAddress(*keeper)
+		if err != nil {
+			color.Red("%v", err)
+			return 2
+		}
+		books := flags.Args()
+		if len(books) == 0 && *missing {
+			books = titles
+		}
+		for _, title := range books {
+			if !*missing || keepers[title] == "" {
+				targets[title] = address
+			}
+		}
+	default:
+		color.Red("keepers assign needs -keeper with book titles or -missing, or -catalog")
+		return 2
+	}
+
+	var assignments []keeperAssignment
+	for _, title := range titles {
+		if target, ok := targets[title]; ok {
+			delete(targets, title)
+			if keepers[title] != target {
+				assignments = append(assignments, keeperAssignment{Book: title, Current: keepers[title], Keeper: target})
+			}
+		}
+	}
+	for title := range targets {
+		color.Red("%q is not in the library.", title)
+	}
+	if len(targets) > 0 {
+		return 1
+	}
+	if len(assignments) == 0 {
+		color.Green("Every book already has the requested keeper.")
+		return 0
+	}
+
+	color.Cyan("Keeper assignments:")
+	for _, a := range assignments {
+		current := a.Current
+		if current == "" {
+			current = "none"
+		}
+		fmt.Printf("  %-48s %s -> %s\n", a.Book, current, a.Keeper)
+	}
+	if *dryRun {
+		color.Green("\nDry run complete. No transactions were sent.")
+		return 0
+	}
+	if err := guardWrite(settings, "keepers", pipeline.FeeEstimate(len(assignments))); err != nil {
+		color.Red("Refusing to assign keepers: %v", err)
+		return 1
+	}
+
+	failed := 0
+	for _, a := range assignments {
+		ledger, err := pipeline.OpenLedger(pipeline.LedgerPath(settings.LedgerFolder, a.Book))
+		if err != nil {
+			color.Red("%s: error reading upload ledger: %v", a.Book, err)
+			failed++
+			continue
+		}
+		if err := assignKeeper(o, settings, ledger, settings.Profile.Signer, a.Book, a.Keeper); err != nil {
+			color.Red("✗ %s: %v", a.Book, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		color.Red("\n%d of %d keeper assignments failed.", failed, len(assignments))
+		return 1
+	}
+	color.Green("\nAssigned keepers to %d books.", len(assignments))
+	return 0
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+	"golang.org/x/term"
+)
+
+// newOverflow connects to the configured network. Accounts of the network that are in
+// the keystore sign with their decrypted keys, which never leave this process: each is
+// set in this process's environment as its pipeline.KeyEnv variable, and a flow.json
+// that points the accounts at those variables, and holds no key, is merged over the
+// main one. flowkit reads the keys from the environment as it loads it.
+func newOverflow(settings uploadSettings) (*OverflowState, error) {
+	keystore, err := pipeline.LoadKeystore(settings.KeystorePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading keystore: %w", err)
+	}
+	keys := map[string]pipeline.AccountKey{}
+	for _, account := range keystore.Accounts() {
+		if strings.HasPrefix(account, settings.Network+"-") {
+			keys[account] = keystore.Keys[account].Key
+		}
+	}
+	if len(keys) == 0 {
+		return Overflow(
+			WithGlobalPrintOptions(),
+			WithNetwork(settings.Network),
+		), nil
+	}
+
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	for account := range keys {
+		privateKey, err := keystore.Decrypt(account, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Setenv(pipeline.KeyEnv(account), hex.EncodeToString(privateKey)); err != nil {
+			return nil, err
+		}
+	}
+	config, err := pipeline.KeystoreFlowConfig(keys)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "alexandria-keys-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flow.keystore.json")
+	if err := os.WriteFile(path, config, 0o600); err != nil {
+		return nil, err
+	}
+	return Overflow(
+		WithGlobalPrintOptions(),
+		WithNetwork(settings.Network),
+		WithFlowConfig(settings.FlowConfig, path),
+	), nil
+}
+
+// readPassphrase returns the keystore passphrase from the environment, or asks for it
+// on the terminal without echoing it; confirm asks twice, for a new key.
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(pipeline.KeystorePassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if !isTerminal(os.Stdin) {
+		return "", fmt.Errorf("the keystore is locked: set %s or run from a terminal", pipeline.KeystorePassphraseEnv)
+	}
+	promptLock.Lock()
+	defer promptLock.Unlock()
+	fmt.Print("Keystore passphrase: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		fmt.Print("Repeat passphrase: ")
+		again, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(passphrase, again) {
+			return "", errors.New("the passphrases do not match")
+		}
+	}
+	return string(passphrase), nil
+}
+
+// checkPlaintextKeys refuses to go on if a key of the network's accounts is stored
+// unencrypted where every user can read it, unless -allow-plaintext-keys is set. The
+// emulator's keys are generated for local development and are not checked.
+func checkPlaintextKeys(settings uploadSettings) error {
+	if settings.Network == pipeline.DefaultNetwork {
+		return nil
+	}
+	accounts, err := pipeline.LoadFlowAccounts(settings.FlowConfig)
+	if err != nil {
+		return fmt.Errorf("error reading accounts: %w", err)
+	}
+	found, err := pipeline.FindPlaintextKeys(settings.FlowConfig, pipeline.NetworkAccounts(accounts, settings.Network))
+	if err != nil || len(found) == 0 {
+		return err
+	}
+	for _, key := range found {
+		color.Yellow("  %s: plaintext key in %s is readable by every user", key.Account, key.Path)
+	}
+	if settings.AllowPlaintextKeys {
+		color.Yellow("Continuing with plaintext keys (-allow-plaintext-keys).")
+		return nil
+	}
+	return fmt.Errorf("%d world-readable plaintext keys; move them to the keystore with \"keys import\" and delete the files, or pass -allow-plaintext-keys", len(found))
+}
+
+// fetchAccountKey reads the public key of an account key on the chain, "" if the key
+// does not exist or is revoked.
+func fetchAccountKey(o *OverflowState, key pipeline.AccountKey) (string, error) {
+	address, err := pipeline.AddressArg(key.Address)
+	if err != nil {
+		return "", err
+	}
+	result := o.Script("get_account_key",
+		WithArg("address", address),
+		WithArg("keyIndex", pipeline.IntArg(key.Index)),
+	)
+	if result.Err != nil {
+		return "", result.Err
+	}
+	var publicKey string
+	if err := result.MarshalAs(&publicKey); err != nil {
+		return "", fmt.Errorf("failed to decode account key: %w", err)
+	}
+	return publicKey, nil
+}
+
+// accountAddress resolves a flow.json account name, as given to -signer or -librarian,
+// or an address to the address it stands for on the settings' network.
+func accountAddress(settings uploadSettings, account string) (string, error) {
+	if address, err := pipeline.ParseAddress(account); err == nil {
+		return address, nil
+	}
+	accounts, err := pipeline.LoadFlowAccounts(settings.FlowConfig)
+	if err != nil {
+		return "", fmt.Errorf("error reading accounts: %w", err)
+	}
+	return pipeline.AccountAddress(accounts, settings.Network, account)
+}
+
+// runKeys manages the encrypted keystore: "list" shows every flow.json account and
+// where its key is kept, "import" encrypts an account's key into the keystore, and
+// "check" decrypts the network's keys, signs with each and compares its public key with
+// the one on the chain. Returns the process exit code.
+func runKeys(settings uploadSettings, args []string) int {
+	command := "list"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("keys "+command, flag.ExitOnError)
+	account := flags.String("account", "", "flow.json account name, e.g. mainnet-Librarian")
+	file := flags.String("file", "", "read the private key from this file instead of flow.json's")
+	flags.Parse(args)
+
+	keystore, err := pipeline.LoadKeystore(settings.KeystorePath)
+	if err != nil {
+		color.Red("Error reading keystore: %v", err)
+		return 1
+	}
+	accounts, err := pipeline.LoadFlowAccounts(settings.FlowConfig)
+	if err != nil {
+		color.Red("Error reading accounts: %v", err)
+		return 1
+	}
+
+	switch command {
+	case "list":
+		plaintext, err := pipeline.FindPlaintextKeys(settings.FlowConfig, accounts)
+		if err != nil {
+			color.Red("%v", err)
+			return 1
+		}
+		exposed := map[string]bool{}
+		for _, key := range plaintext {
+			exposed[key.Account] = true
+		}
+		for _, a := range accounts {
+			where := a.KeyType
+			if a.KeyType == "file" {
+				where += " " + a.Location
+			}
+			switch {
+			case keystore.Keys[a.Key.Account].Ciphertext != "":
+				color.Green("  %-28s %s  keystore", a.Key.Account, a.Key.Address)
+			case exposed[a.Key.Account]:
+				color.Yellow("  %-28s %s  %s (world-readable)", a.Key.Account, a.Key.Address, where)
+			default:
+				fmt.Printf("  %-28s %s  %s\n", a.Key.Account, a.Key.Address, where)
+			}
+		}
+		return 0
+
+	case "import":
+		if *account == "" {
+			color.Red("keys import needs -account")
+			return 2
+		}
+		var flowAccount *pipeline.FlowAccount
+		for i := range accounts {
+			if accounts[i].Key.Account == *account {
+				flowAccount = &accounts[i]
+			}
+		}
+		if flowAccount == nil {
+			color.Red("No account %q in %s.", *account, settings.FlowConfig)
+			return 1
+		}
+		keyText := flowAccount.PrivateKey
+		source := settings.FlowConfig
+		if *file == "" && flowAccount.KeyType == "file" {
+			*file = filepath.Join(filepath.Dir(settings.FlowConfig), flowAccount.Location)
+		}
+		if *file != "" {
+			data, err := os.ReadFile(*file)
+			if err != nil {
+				color.Red("%v", err)
+				return 1
+			}
+			keyText, source = string(data), *file
+		}
+		if keyText == "" {
+			color.Red("%s has a %s key; pass the private key with -file.", *account, flowAccount.KeyType)
+			return 1
+		}
+		privateKey, err := pipeline.ParsePrivateKeyHex(keyText)
+		if err != nil {
+			color.Red("%s: %v", source, err)
+			return 1
+		}
+		passphrase, err := readPassphrase(len(keystore.Keys) == 0)
+		if err != nil {
+			color.Red("%v", err)
+			return 1
+		}
+		if existing := keystore.Accounts(); len(existing) > 0 {
+			if _, err := keystore.Decrypt(existing[0], passphrase); err != nil {
+				color.Red("The keystore has other keys; use its passphrase: %v", err)
+				return 1
+			}
+		}
+		if err := keystore.Add(flowAccount.Key, privateKey, passphrase, pipeline.DefaultScrypt); err != nil {
+			color.Red("%v", err)
+			return 1
+		}
+		if err := keystore.Save(settings.KeystorePath); err != nil {
+			color.Red("Error writing keystore: %v", err)
+			return 1
+		}
+		color.Green("Encrypted the key of %s into %s.", *account, settings.KeystorePath)
+		if source != settings.FlowConfig {
+			color.Yellow("Delete %s now; the keystore replaces it.", source)
+		} else {
+			color.Yellow("Remove the key from %s now; the keystore replaces it.", settings.FlowConfig)
+		}
+		return 0
+
+	case "check":
+		passphrase, err := readPassphrase(false)
+		if err != nil {
+			color.Red("%v", err)
+			return 1
+		}
+		o := Overflow(
+			WithGlobalPrintOptions(),
+			WithNetwork(settings.Network),
+		)
+		failed, checked := 0, 0
+		for _, name := range keystore.Accounts() {
+			if !strings.HasPrefix(name, settings.Network+"-") {
+				continue
+			}
+			checked++
+			if err := checkSigner(o, keystore, name, passphrase); err != nil {
+				color.Red("  ✗ %s: %v", name, err)
+				failed++
+				continue
+			}
+			color.Green("  ✓ %s signs with the key on-chain", name)
+		}
+		if failed > 0 {
+			return 1
+		}
+		color.Cyan("%d keystore keys checked on %s.", checked, settings.Network)
+		return 0
+	}
+	fmt.Printf("Unknown keys command %q (expected list, import or check)\n", command)
+	return 2
+}
+
+// checkSigner decrypts an account's key, signs a message with it and verifies the
+// signature against the account key on the chain.
+func checkSigner(o *OverflowState, keystore *pipeline.Keystore, account, passphrase string) error {
+	signer, err := keystore.Signer(account, passphrase)
+	if err != nil {
+		return err
+	}
+	onChain, err := fetchAccountKey(o, signer.AccountKey())
+	if err != nil {
+		return err
+	}
+	if onChain == "" {
+		return fmt.Errorf("key %d of %s does not exist or is revoked", signer.AccountKey().Index, signer.AccountKey().Address)
+	}
+	publicKey, err := hex.DecodeString(onChain)
+	if err != nil {
+		return err
+	}
+	message := []byte("alexandria keystore check " + account)
+	signature, err := signer.Sign(message)
+	if err != nil {
+		return err
+	}
+	ok, err := pipeline.VerifySignature(publicKey, signer.AccountKey().HashAlgo, message, signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("the keystore key does not match the account key on-chain")
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// recordTx fills in the outcome of a transaction and appends it to the book's ledger and
+// the JSON log. A successful transaction keeps the entry's status if it has one, and is
+// sealed otherwise, but only once it has emitted the Alexandria event that confirms it
+// for this book and chapter. Returns the transaction's error, or why it is not confirmed.
+// A ledger write failure is reported but does not stop the upload.
+func recordTx(o *OverflowState, settings uploadSettings, ledger *pipeline.Ledger, entry pipeline.LedgerEntry, result *OverflowResult) error {
+	if id := result.Id.String(); strings.Trim(id, "0") != "" {
+		entry.TxID = id
+	}
+	if result.Err == nil {
+		entry.BlockHeight = blockHeight(o, result)
+	}
+	return recordEntry(settings, ledger, entry, result.Err, emittedEvents(result))
+}
+
+// recordEntry is recordTx for a transaction whose ID, block height, error and events
+// are already known, such as one submitted by the offline workflow.
+func recordEntry(settings uploadSettings, ledger *pipeline.Ledger, entry pipeline.LedgerEntry, txErr error, events []pipeline.EmittedEvent) error {
+	if entry.Status == "" {
+		entry.Status = pipeline.StatusSealed
+	}
+	err := txErr
+	if err == nil {
+		if expected, ok := pipeline.ExpectEvent(entry.Action, entry.Book, entry.Chapter); ok {
+			if entry.Keeper != "" {
+				expected.Fields["keeper"] = entry.Keeper
+			}
+			err = expected.Confirm(events)
+		}
+	}
+	if err != nil {
+		entry.Status = pipeline.StatusFailed
+		entry.Error = err.Error()
+	}
+	if err := ledger.Append(entry); err != nil {
+		color.Red("Could not write ledger %s: %v", ledger.Path, err)
+	}
+	if err := settings.Log.Write(pipeline.LogRecord{
+		Event:   "tx",
+		Network: entry.Network,
+		Book:    entry.Book,
+		Action:  entry.Action,
+		Chapter: entry.Chapter,
+		TxID:    entry.TxID,
+		Status:  entry.Status,
+		Error:   entry.Error,
+	}); err != nil {
+		color.Red("Could not write JSON log: %v", err)
+	}
+	if err != nil && txErr == nil {
+		color.Red("✗ %s %s: %v", entry.Action, entry.Chapter, err)
+	}
+	return err
+}
+
+// emittedEvents lists the events a transaction emitted.
+func emittedEvents(result *OverflowResult) []pipeline.EmittedEvent {
+	var events []pipeline.EmittedEvent
+	for name, list := range result.Events {
+		for _, event := range list {
+			events = append(events, pipeline.EmittedEvent{Name: name, Fields: event.Fields})
+		}
+	}
+	return events
+}
+
+// blockHeight looks up the block a transaction was sealed in. Returns 0 if it cannot be found.
+func blockHeight(o *OverflowState, result *OverflowResult) uint64 {
+	_, txResult, err := o.Flowkit.GetTransactionByID(context.Background(), result.Id, false)
+	if err != nil || txResult == nil {
+		return 0
+	}
+	return txResult.BlockHeight
+}
+
+// printLedger prints every transaction recorded for the book, oldest first.
+func printLedger(ledger *pipeline.Ledger) {
+	entries := ledger.Entries()
+	color.Cyan("Ledger %s: %d transactions", ledger.Path, len(entries))
+	for _, e := range entries {
+		line := fmt.Sprintf("%s  %-8s %-7s %-24s %-28s paragraphs=%-4d tx=%s block=%d",
+			e.Timestamp.Format("2006-01-02 15:04:05"), e.Network, e.Status, e.Action, e.Chapter, e.Paragraphs, e.TxID, e.BlockHeight)
+		if e.Keeper != "" {
+			line += " keeper=" + e.Keeper
+		}
+		if e.Reviewer != "" {
+			line += fmt.Sprintf(" librarian=%s reviewer=%s note=%q", e.Librarian, e.Reviewer, e.Note)
+		}
+		if e.Status == pipeline.StatusFailed {
+			color.Red("%s error=%s", line, e.Error)
+		} else {
+			fmt.Println(line)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// runSubmit submits every section of the book for review as a community librarian.
+// Librarians cannot add books or chapter names, so the book and each chapter name must
+// already be on-chain; sections without a chapter name are skipped. Sections whose last
+// submission is still pending or was approved with the same content are not resubmitted.
+func runSubmit(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, sections []chapterFile, ledger *pipeline.Ledger, signer string) error {
+	network := settings.Network
+	color.Red("Alexandria Contract - %s Librarian Submission (%s as %s)", book.Title, network, signer)
+
+	address, err := accountAddress(settings, signer)
+	if err != nil {
+		return err
+	}
+	holds, err := hasLibrarian(o, address)
+	if err != nil {
+		return fmt.Errorf("could not check Librarian resource of %s: %w", signer, err)
+	}
+	if !holds {
+		return fmt.Errorf("%s does not hold a Librarian resource at Alexandria.LibrarianStoragePath", signer)
+	}
+
+	titles, err := fetchChapterTitles(o, book.Title)
+	if err != nil {
+		return fmt.Errorf("could not read chapter names of %s (an admin must add the book first): %w", book.Title, err)
+	}
+	names := map[string]bool{}
+	for _, title := range titles {
+		names[title] = true
+	}
+
+	type queued struct {
+		section    chapterFile
+		paragraphs []string
+	}
+	var queue []queued
+	submitted := latestSubmissions(ledger, network)
+	skipped := 0
+	for _, section := range sections {
+		if !names[section.Title] {
+			color.Yellow("Skipping %s: an admin must add the chapter name first.", section.Title)
+			skipped++
+			continue
+		}
+		paragraphs, err := readParagraphs(section.Path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", section.Path, err)
+		}
+		contentHash := pipeline.HashParagraphs(paragraphs)
+
+		if previous, ok := submitted[section.Title]; ok && previous.ContentHash == contentHash {
+			state, err := submissionState(o, ledger, network, book.Title, section.Title, address, contentHash)
+			if err == nil && state != pipeline.SubmissionSuperseded {
+				color.Green("%s: already submitted with this content (%s). Skipping.", section.Title, state)
+				continue
+			}
+		}
+		queue = append(queue, queued{section, paragraphs})
+	}
+	if len(queue) == 0 {
+		color.Green("Nothing to submit.")
+		return nil
+	}
+	if err := guardWrite(settings, book.Title, pipeline.FeeEstimate(len(queue))); err != nil {
+		return err
+	}
+
+	sent, failed := 0, 0
+	for _, q := range queue {
+		section := q.section
+		paragraphs := q.paragraphs
+		color.Yellow("Submitting %s for review (index %d, %d paragraphs)", section.Title, section.Index, len(paragraphs))
+		result := o.Tx("Admin/submit_chapter",
+			WithSigner(signer),
+			WithArg("bookTitle", pipeline.StringArg(book.Title)),
+			WithArg("chapterTitle", pipeline.StringArg(section.Title)),
+			WithArg("index", pipeline.IntArg(section.Index)),
+			WithArg("paragraphs", pipeline.StringArrayArg(paragraphs)),
+		)
+		err := recordTx(o, settings, ledger, pipeline.LedgerEntry{
+			Network:     network,
+			Book:        book.Title,
+			Action:      "Admin/submit_chapter",
+			Chapter:     section.Title,
+			Index:       section.Index,
+			ContentHash: pipeline.HashParagraphs(paragraphs),
+			Paragraphs:  len(paragraphs),
+			Status:      pipeline.SubmissionPending,
+		}, result)
+		result.Print()
+		sent++
+		if err != nil {
+			failed++
+		}
+	}
+
+	color.Cyan("\nSubmitted %d chapters (%d failed), %d skipped without a chapter name.", sent, failed, skipped)
+	if failed > 0 {
+		return fmt.Errorf("%d submissions failed", failed)
+	}
+	return nil
+}
+
+// runSubmissions reports the review state of every chapter the librarian submitted for
+// the book, and records state changes in the ledger. Returns the number still pending.
+func runSubmissions(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, ledger *pipeline.Ledger, signer string) int {
+	network := settings.Network
+	color.Red("Alexandria Contract - %s Submissions (%s as %s)", book.Title, network, signer)
+	address, err := accountAddress(settings, signer)
+	if err != nil {
+		color.Red("%v", err)
+		return 0
+	}
+
+	recorded := ledger.Latest(network, "submission")
+	pending := 0
+	for title, submission := range latestSubmissions(ledger, network) {
+		state, err := submissionState(o, ledger, network, book.Title, title, address, submission.ContentHash)
+		if err != nil {
+			color.Red("%-28s could not read review state: %v", title, err)
+			continue
+		}
+		line := fmt.Sprintf("%-28s %-10s submitted %s tx=%s", title, state, submission.Timestamp.Format("2006-01-02 15:04"), submission.TxID)
+		switch state {
+		case pipeline.SubmissionApproved:
+			color.Green("%s", line)
+		case pipeline.SubmissionRejected:
+			color.Red("%s", line)
+		case pipeline.SubmissionSuperseded:
+			color.Yellow("%s", line)
+		default:
+			pending++
+			fmt.Println(line)
+		}
+
+		if last, ok := recorded[title]; !ok || last.Status != state || last.ContentHash != submission.ContentHash {
+			err := ledger.Append(pipeline.LedgerEntry{
+				Network:     network,
+				Book:        book.Title,
+				Action:      "submission",
+				Chapter:     title,
+				Index:       submission.Index,
+				ContentHash: submission.ContentHash,
+				Paragraphs:  submission.Paragraphs,
+				TxID:        submission.TxID,
+				Status:      state,
+			})
+			if err != nil {
+				color.Red("Could not write ledger %s: %v", ledger.Path, err)
+			}
+		}
+	}
+	return pending
+}
+
+// latestSubmissions returns the last successful submission of each chapter on network.
+func latestSubmissions(ledger *pipeline.Ledger, network string) map[string]pipeline.LedgerEntry {
+	latest := map[string]pipeline.LedgerEntry{}
+	for _, entry := range ledger.Entries() {
+		if entry.Network == network && entry.Action == "Admin/submit_chapter" && entry.Status != pipeline.StatusFailed {
+			latest[entry.Chapter] = entry
+		}
+	}
+	return latest
+}
+
+// submissionState reads back the librarian's pending submission and the book's current
+// chapter, and resolves whether the submission with contentHash is pending, approved,
+// rejected or superseded. A rejection is only on the chain as an event, so it is read
+// from the reviewer's decision in the ledger.
+func submissionState(o *OverflowState, ledger *pipeline.Ledger, network, bookTitle, chapterTitle, librarian, contentHash string) (string, error) {
+	pendingHash := ""
+	pending, err := fetchSubmission(o, bookTitle, chapterTitle, librarian)
+	if err != nil {
+		return "", err
+	}
+	if pending != nil {
+		pendingHash = hashOnChain(pending.Paragraphs)
+	}
+	chapterHash := ""
+	if current, err := fetchChapter(o, bookTitle, chapterTitle); err == nil {
+		chapterHash = hashOnChain(current)
+	}
+	rejected := ledger.Rejected(network, chapterTitle, contentHash)
+	return pipeline.ResolveSubmission(contentHash, pendingHash, chapterHash, rejected), nil
+}
+
+// hashOnChain hashes paragraphs read from the chain the same way the ledger hashes local ones.
+func hashOnChain(paragraphs []string) string {
+	return pipeline.HashParagraphs(paragraphs)
+}
+
+// hasLibrarian reports whether the account at address holds a Librarian resource.
+func hasLibrarian(o *OverflowState, address string) (bool, error) {
+	addressArg, err := pipeline.AddressArg(address)
+	if err != nil {
+		return false, err
+	}
+	result := o.Script("has_librarian", WithArg("address", addressArg))
+	if result.Err != nil {
+		return false, result.Err
+	}
+	var holds bool
+	if err := result.MarshalAs(&holds); err != nil {
+		return false, err
+	}
+	return holds, nil
+}
+
+// fetchChapterTitles reads a book's chapter names with the get_chapter_titles script.
+func fetchChapterTitles(o *OverflowState, bookTitle string) ([]string, error) {
+	result := o.Script("get_chapter_titles", WithArg("bookTitle", pipeline.StringArg(bookTitle)))
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	var titles []string
+	if err := result.MarshalAs(&titles); err != nil {
+		return nil, fmt.Errorf("failed to decode chapter titles: %w", err)
+	}
+	return titles, nil
+}
+
+// fetchSubmission reads the chapter the librarian at address has pending review, or nil
+// if there is none.
+func fetchSubmission(o *OverflowState, bookTitle, chapterTitle, librarian string) (*pipeline.OnChainChapter, error) {
+	librarianArg, err := pipeline.AddressArg(librarian)
+	if err != nil {
+		return nil, err
+	}
+	result := o.Script("get_book_submission",
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+		WithArg("librarian", librarianArg),
+	)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	if result.Output == nil {
+		return nil, nil
+	}
+	var chapter pipeline.OnChainChapter
+	if err := result.MarshalAs(&chapter); err != nil {
+		return nil, fmt.Errorf("failed to decode submission: %w", err)
+	}
+	return &chapter, nil
+}
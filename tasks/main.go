@@ -2,37 +2,23 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
+
+	"alexandria/overflow/tasks/pipeline"
 
-	//if you imports this with .  you do not have to repeat overflow everywhere
-	. "github.com/bjartek/overflow/v2"
 	"github.com/fatih/color"
 )
 
-// escapeForCadence escapes a string so it is valid inside a Cadence string literal.
-// Cadence uses "..." for strings; inner " must be \" and \ must be \\.
-func escapeForCadence(s string) string {
-	var b strings.Builder
-	for _, r := range s {
-		switch r {
-		case '\\':
-			b.WriteString(`\\`)
-		case '"':
-			b.WriteString(`\"`)
-		default:
-			b.WriteRune(r)
-		}
-	}
-	return b.String()
-}
-
-// ReadFile reads a text file and returns an array of paragraphs, each escaped for Cadence.
-func ReadFile(filename string) ([]string, error) {
+// readParagraphs reads a text file and returns its non-empty, trimmed lines as paragraphs,
+// exactly as they are sent and stored. Lines must be valid UTF-8.
+func readParagraphs(filename string) ([]string, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
@@ -58,9 +44,13 @@ func ReadFile(filename string) ([]string, error) {
 
 	for _, paragraph := range rawParagraphs {
 		trimmed := strings.TrimSpace(paragraph)
-		if trimmed != "" {
-			paragraphs = append(paragraphs, escapeForCadence(trimmed)) // Escaped for Cadence [String]
+		if trimmed == "" {
+			continue
+		}
+		if err := pipeline.CheckText(trimmed); err != nil {
+			return nil, fmt.Errorf("%s: paragraph %d: %w", filename, len(paragraphs)+1, err)
 		}
+		paragraphs = append(paragraphs, trimmed)
 	}
 
 	return paragraphs, nil
@@ -70,6 +60,16 @@ type chapterFile struct {
 	Path  string
 	Label string
 	Index int
+	Title string
+}
+
+// chapterTitleFor returns the on-chain chapter title for a section:
+// its entry in chapterTitles, or "Chapter <index>" by default.
+func chapterTitleFor(index int, chapterTitles map[int]string) string {
+	if t, ok := chapterTitles[index]; ok {
+		return t
+	}
+	return fmt.Sprintf("Chapter %d", index)
 }
 
 // findSections finds all section files in baseDir whose name matches sectionFileRegex
@@ -117,89 +117,180 @@ func main() {
 		summary          = "Ecce Homo by Friedrich Wilhelm Nietzsche is a philosophical autobiography written in 1888. In this provocative final work, Nietzsche offers his own interpretation of his life, philosophy, and significance through boldly titled chapters like \"Why I Am So Wise\" and \"Why I Write Such Good Books.\" He reviews his major works, presents a new image of the Dionysian philosopher, and challenges Christianity's morality. Written with characteristic hyperbole and self-conscious irony, the book puts Nietzsche himself on trial while declaring his vision for humanity's future. (This is an automatically generated summary.)"
 		sectionFileRegex = `^EcceHomo_Section_(\d+)\.txt$`
 		booksFolder      = "books"
-		signer           = "Prime-librarian"
+		ledgerFolder     = "books/ledger"
+		offlineFolder    = "books/offline"
+		signer           = ""         // empty: the network profile's admin account
+		keeper           = ""         // optional: address attached as the book's Keeper
+		source           = "niet.txt" // optional: original text in booksFolder, for its Gutenberg metadata
 		startIndex       = 1
 	)
 	// Optional chapter titles; nil means use default "Chapter <index>" titles.
 	var chapterTitles map[int]string = nil
 	// ---------------------------------------------------------------------------
 
-	o := Overflow(
-		WithGlobalPrintOptions(),
-		WithNetwork("mainnet"),
-	)
+	book := pipeline.BookManifest{
+		Title:            bookTitle,
+		Author:           author,
+		Genre:            genre,
+		Edition:          edition,
+		Summary:          summary,
+		SectionFileRegex: sectionFileRegex,
+		StartIndex:       startIndex,
+		ChapterTitles:    chapterTitles,
+		Signer:           signer,
+		Keeper:           keeper,
+		Source:           source,
+		// Metadata the source header does not provide
+		Metadata: pipeline.BookMetadata{PublicationYear: 1908},
+	}
+	settings := uploadSettings{
+		BooksFolder:   booksFolder,
+		LedgerFolder:  ledgerFolder,
+		OfflineFolder: offlineFolder,
+		FlowConfig:    "flow.json",
+	}
 
-	color.Red("Alexandria Contract - %s Upload", bookTitle)
-	color.Red("")
-
-	color.Cyan("Checking if book already exists...")
-	bookExists := false
-	bookResult := o.Script("get_book", WithArg("bookTitle", bookTitle))
-	if bookResult != nil && bookResult.Err == nil {
-		bookExists = true
-	}
-	if !bookExists {
-		color.Yellow("Book does not exist. Creating book: %s", bookTitle)
-		result := o.Tx("Admin/add_book",
-			WithSigner(signer),
-			WithArg("title", bookTitle),
-			WithArg("author", author),
-			WithArg("genre", genre),
-			WithArg("edition", edition),
-			WithArg("summary", escapeForCadence(summary)),
-		)
-		if result.Err != nil && strings.Contains(result.Err.Error(), "already in the Library") {
-			color.Green("Book already exists (detected during creation). Skipping.")
-		} else {
-			result.Print()
-			color.Green("Book created successfully!")
+	global := flag.NewFlagSet("tasks", flag.ExitOnError)
+	network := global.String("network", pipeline.DefaultNetwork, "network profile: emulator, testnet or mainnet")
+	global.BoolVar(&settings.AllowMainnet, "allow-mainnet", false, "allow transactions to mainnet (each write still asks for confirmation)")
+	global.Var((*stringList)(&settings.ConfirmTokens), "confirm", "pre-approved confirmation token for a mainnet write, e.g. mainnet:Ecce_Homo:12 (repeatable)")
+	global.StringVar(&settings.KeystorePath, "keystore", "keystore.json", "encrypted keystore holding signer keys")
+	global.BoolVar(&settings.AllowPlaintextKeys, "allow-plaintext-keys", false, "run even if a signer key is stored unencrypted and world-readable")
+	logPath := global.String("log-json", "", "append a JSON line per transaction and progress update to this file (- for stdout)")
+	global.Parse(os.Args[1:])
+	profile, err := pipeline.LookupNetwork(*network)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if profile.ContractAddress == "" {
+		if profile.ContractAddress, err = pipeline.FlowContractAddress(settings.FlowConfig, "Alexandria", profile.Name); err != nil {
+			fmt.Printf("%s: %v\n", profile.Name, err)
+			os.Exit(2)
+		}
+	}
+	// exit closes the JSON log and exits; os.Exit skips the deferred Close.
+	var logFile *os.File
+	exit := func(code int) {
+		if logFile != nil {
+			logFile.Close()
+		}
+		os.Exit(code)
+	}
+	switch *logPath {
+	case "":
+	case "-":
+		settings.Log = pipeline.NewJSONLog(os.Stdout)
+	default:
+		if logFile, err = os.OpenFile(*logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644); err != nil {
+			fmt.Printf("Error opening JSON log: %v\n", err)
+			os.Exit(1)
 		}
-	} else {
-		color.Green("Book already exists. Skipping book creation.")
+		defer logFile.Close()
+		settings.Log = pipeline.NewJSONLog(logFile)
+	}
+	settings.Network, settings.Profile = profile.Name, profile
+	if book.Signer == "" {
+		book.Signer = profile.Signer
+	}
+	if book.Keeper != "" {
+		if book.Keeper, err = pipeline.ParseAddress(book.Keeper); err != nil {
+			fmt.Printf("keeper: %v\n", err)
+			exit(2)
+		}
+	}
+
+	mode, args := "upload", []string{}
+	if global.NArg() > 0 {
+		mode, args = global.Arg(0), global.Args()[1:]
+	}
+	switch mode {
+	case "keys":
+		exit(runKeys(settings, args))
+	case "offline":
+		// The offline workflow never loads a signer key on the online host.
+		exit(runOffline(settings, book, args))
+	}
+	if err := checkPlaintextKeys(settings); err != nil {
+		color.Red("Refusing to start: %v", err)
+		exit(1)
+	}
+	switch mode {
+	case "catalog":
+		exit(runCatalog(settings, args))
+	case "keepers":
+		exit(runKeepers(settings, args))
+	case "images":
+		exit(runImages(settings, args))
 	}
 
-	sectionFiles, err := findSections(booksFolder, sectionFileRegex, startIndex)
+	ledger, err := pipeline.OpenLedger(pipeline.LedgerPath(ledgerFolder, bookTitle))
+	if err != nil {
+		fmt.Printf("Error reading upload ledger: %v\n", err)
+		exit(1)
+	}
+	if mode == "audit" {
+		printLedger(ledger)
+		return
+	}
+
+	sectionFiles, err := loadSections(booksFolder, book)
 	if err != nil {
 		fmt.Printf("Error discovering section files: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	if len(sectionFiles) == 0 {
 		fmt.Printf("No section files found in %s matching %s\n", booksFolder, sectionFileRegex)
 		return
 	}
-	fmt.Printf("\nFound %d section files:\n", len(sectionFiles))
-	for _, section := range sectionFiles {
-		fmt.Printf("  - %s (index %d)\n", section.Path, section.Index)
+
+	o, err := newOverflow(settings)
+	if err != nil {
+		color.Red("%v", err)
+		exit(1)
 	}
 
-	for _, section := range sectionFiles {
-		sectionTitle := fmt.Sprintf("Chapter %d", section.Index)
-		if chapterTitles != nil {
-			if t, ok := chapterTitles[section.Index]; ok {
-				sectionTitle = t
+	switch mode {
+	case "upload", "dry-run":
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		flags.BoolVar(&settings.CreateGenre, "create-genre", false, "create the book's genre with Admin/add_genre if it does not exist")
+		flags.Parse(args)
+		settings.DryRun = mode == "dry-run"
+		report := uploadBook(o, settings, book, sectionFiles, ledger, &sync.Mutex{})
+		if report.Status == pipeline.BookFailed {
+			color.Red("\n%s upload failed: %d failed transactions. %s", bookTitle, report.Failed, report.Error)
+			exit(1)
+		}
+	case "submit", "submissions":
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		librarian := flags.String("signer", "Librarian", "account holding the Librarian resource")
+		flags.Parse(args)
+		if mode == "submissions" {
+			if pending := runSubmissions(o, settings, book, ledger, *librarian); pending > 0 {
+				color.Cyan("\n%d submissions still pending review.", pending)
 			}
+			return
 		}
-		color.Cyan("\nProcessing %s (index %d)", sectionTitle, section.Index)
-		paragraphs, err := ReadFile(section.Path)
-		if err != nil {
-			fmt.Printf("Error reading %s: %v\n", section.Path, err)
-			os.Exit(1)
+		if err := runSubmit(o, settings, book, sectionFiles, ledger, *librarian); err != nil {
+			color.Red("\nSubmission failed: %v", err)
+			exit(1)
 		}
-		fmt.Printf("Successfully loaded %d paragraphs from %s\n", len(paragraphs), section.Path)
-		color.Yellow("Adding section name on-chain: %s", sectionTitle)
-		o.Tx("Admin/add_chapter_name",
-			WithSigner(signer),
-			WithArg("bookTitle", bookTitle),
-			WithArg("chapterTitle", sectionTitle),
-		).Print()
-		color.Yellow("Adding section content on-chain: %s (index %d)", sectionTitle, section.Index)
-		o.Tx("Admin/add_chapter",
-			WithSigner(signer),
-			WithArg("bookTitle", bookTitle),
-			WithArg("chapterTitle", sectionTitle),
-			WithArg("index", section.Index),
-			WithArg("paragraphs", paragraphs),
-		).Print()
-	}
-	color.Green("\nFinished uploading %s sections.", bookTitle)
+	case "patch":
+		exit(runPatch(o, settings, book, sectionFiles, ledger, args))
+	case "review":
+		exit(runReview(o, settings, book, sectionFiles, ledger, args))
+	case "metadata":
+		exit(runMetadata(o, settings, book, sectionFiles, ledger, args))
+	case "preflight":
+		exit(runPreflight(o, settings, book, sectionFiles, ledger, args))
+	case "verify":
+		if mismatches := runVerify(o, ledger, settings.Network, bookTitle, sectionFiles); mismatches > 0 {
+			color.Red("\nVerification failed: %d of %d chapters do not match.", mismatches, len(sectionFiles))
+			exit(1)
+		}
+		color.Green("\nVerified all %d chapters of %s.", len(sectionFiles), bookTitle)
+	default:
+		fmt.Printf("Unknown mode %q (expected upload, dry-run, verify, preflight, audit, catalog, keepers, images, keys, offline, metadata, submit, submissions, review or patch)\n", mode)
+		exit(2)
+	}
 }
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// bookMetadataFor is the metadata the book should carry on-chain: the manifest's
+// fields, then whatever its source text's header provides, and the word count of
+// every section.
+func bookMetadataFor(settings uploadSettings, book pipeline.BookManifest, sections []chapterFile) (pipeline.BookMetadata, error) {
+	metadata := book.Metadata
+	if book.Source != "" {
+		file, err := os.Open(filepath.Join(settings.BooksFolder, book.Source))
+		if err != nil {
+			return metadata, fmt.Errorf("source: %w", err)
+		}
+		defer file.Close()
+		header, err := pipeline.ParseSourceHeader(file)
+		if err != nil {
+			return metadata, fmt.Errorf("source %s: %w", book.Source, err)
+		}
+		metadata = metadata.Merge(header)
+	}
+	if metadata.WordCount == 0 {
+		for _, section := range sections {
+			paragraphs, err := readParagraphs(section.Path)
+			if err != nil {
+				return metadata, err
+			}
+			metadata.WordCount += pipeline.WordCount(paragraphs)
+		}
+	}
+	return metadata, nil
+}
+
+// chapterMetadataFor is the metadata a chapter with these paragraphs should carry.
+func chapterMetadataFor(paragraphs []string) pipeline.Metadata {
+	return pipeline.MetadataFields(pipeline.ChapterMetadata{WordCount: pipeline.WordCount(paragraphs)})
+}
+
+// fetchMetadata reads the extra metadata of a book and its chapters with get_book_metadata.
+func fetchMetadata(o *OverflowState, bookTitle string) (pipeline.OnChainMetadata, error) {
+	var metadata pipeline.OnChainMetadata
+	result := o.Script("get_book_metadata", WithArg("bookTitle", pipeline.StringArg(bookTitle)))
+	if result.Err != nil {
+		return metadata, result.Err
+	}
+	if err := result.MarshalAs(&metadata); err != nil {
+		return metadata, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// bookMetadataTx and chapterMetadataTx build the transactions that set metadata keys.
+func bookMetadataTx(o *OverflowState, signer, bookTitle string, metadata pipeline.Metadata) *OverflowResult {
+	return o.Tx("Admin/set_book_metadata",
+		WithSigner(signer),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("metadata", metadata.Arg()),
+	)
+}
+
+func chapterMetadataTx(o *OverflowState, signer, bookTitle, chapterTitle string, metadata pipeline.Metadata) *OverflowResult {
+	return o.Tx("Admin/set_chapter_metadata",
+		WithSigner(signer),
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+		WithArg("metadata", metadata.Arg()),
+	)
+}
+
+// resetChapterMetadata sets the metadata derived from a chapter's paragraphs after its
+// content changed: a patch changes its word count, and the fresh Chapter a replace or
+// an approval stores has no metadata at all.
+func resetChapterMetadata(o *OverflowState, settings uploadSettings, ledger *pipeline.Ledger, signer, bookTitle, chapterTitle string, index int, paragraphs []string) error {
+	metadata := chapterMetadataFor(paragraphs)
+	color.Yellow("Setting the metadata of %s: %s", chapterTitle, metadataNote(metadata))
+	result := chapterMetadataTx(o, signer, bookTitle, chapterTitle, metadata)
+	err := recordTx(o, settings, ledger, pipeline.LedgerEntry{
+		Network: settings.Network,
+		Book:    bookTitle,
+		Action:  "Admin/set_chapter_metadata",
+		Chapter: chapterTitle,
+		Index:   index,
+		Note:    metadataNote(metadata),
+	}, result)
+	result.Print()
+	if err != nil {
+		return fmt.Errorf("could not set the metadata of %s: %w", chapterTitle, err)
+	}
+	return nil
+}
+
+// metadataNote records which keys a metadata transaction set, for the ledger.
+func metadataNote(metadata pipeline.Metadata) string {
+	return "keys: " + strings.Join(metadata.Keys(), ", ")
+}
+
+// metadataUpdate is one set of metadata keys to send; Chapter is empty for the book's.
+type metadataUpdate struct {
+	Chapter string
+	Keys    pipeline.Metadata
+}
+
+// runMetadata prints the book's on-chain metadata next to what the manifest, source
+// header and section files say it should be, and sets the keys that differ on the
+// book and on every chapter already on-chain. Returns the process exit code.
+func runMetadata(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, sections []chapterFile, ledger *pipeline.Ledger, args []string) int {
+	flags := flag.NewFlagSet("metadata", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the changes without sending transactions")
+	flags.Parse(args)
+
+	want, err := bookMetadataFor(settings, book, sections)
+	if err != nil {
+		color.Red("%v", err)
+		return 1
+	}
+	onChain, err := fetchMetadata(o, book.Title)
+	if err != nil {
+		color.Red("Could not read the metadata of %s: %v", book.Title, err)
+		return 1
+	}
+	var current pipeline.BookMetadata
+	if err := pipeline.DecodeMetadata(onChain.Book, &current); err != nil {
+		color.Red("%s: %v", book.Title, err)
+		return 1
+	}
+	color.Cyan("%s on %s:", book.Title, settings.Network)
+	fmt.Printf("  on-chain: %+v\n  local:    %+v\n", current, want)
+
+	var updates []metadataUpdate
+	if changed := pipeline.MetadataFields(want).Changed(pipeline.MetadataFields(current)); len(changed) > 0 {
+		updates = append(updates, metadataUpdate{Keys: changed})
+	}
+	for _, section := range sections {
+		extra, ok := onChain.Chapters[section.Title]
+		if !ok {
+			continue
+		}
+		var chapter pipeline.ChapterMetadata
+		if err := pipeline.DecodeMetadata(extra, &chapter); err != nil {
+			color.Red("%s: %v", section.Title, err)
+			return 1
+		}
+		paragraphs, err := readParagraphs(section.Path)
+		if err != nil {
+			color.Red("%v", err)
+			return 1
+		}
+		if changed := chapterMetadataFor(paragraphs).Changed(pipeline.MetadataFields(chapter)); len(changed) > 0 {
+			updates = append(updates, metadataUpdate{Chapter: section.Title, Keys: changed})
+		}
+	}
+	if len(updates) == 0 {
+		color.Green("\nMetadata is up to date.")
+		return 0
+	}
+
+	color.Cyan("\nMetadata changes:")
+	for _, update := range updates {
+		name := update.Chapter
+		if name == "" {
+			name = "(book)"
+		}
+		fmt.Printf("  %-28s %v\n", name, update.Keys)
+	}
+	if *dryRun {
+		color.Green("\nDry run complete. No transactions were sent.")
+		return 0
+	}
+	if err := guardWrite(settings, book.Title, pipeline.FeeEstimate(len(updates))); err != nil {
+		color.Red("Refusing to set metadata: %v", err)
+		return 1
+	}
+
+	failed := 0
+	for _, update := range updates {
+		entry := pipeline.LedgerEntry{
+			Network: settings.Network,
+			Book:    book.Title,
+			Chapter: update.Chapter,
+			Note:    metadataNote(update.Keys),
+		}
+		var result *OverflowResult
+		if update.Chapter == "" {
+			entry.Action = "Admin/set_book_metadata"
+			result = bookMetadataTx(o, book.Signer, book.Title, update.Keys)
+		} else {
+			entry.Action = "Admin/set_chapter_metadata"
+			result = chapterMetadataTx(o, book.Signer, book.Title, update.Chapter, update.Keys)
+		}
+		if err := recordTx(o, settings, ledger, entry, result); err != nil {
+			failed++
+		}
+		result.Print()
+	}
+	if failed > 0 {
+		color.Red("\n%d of %d metadata updates failed.", failed, len(updates))
+		return 1
+	}
+	color.Green("\nSet metadata on %d items.", len(updates))
+	return 0
+}
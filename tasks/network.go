@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"alexandria/overflow/tasks/pipeline"
+)
+
+// stringList is a flag that may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// promptLock keeps concurrent catalog books from prompting at the same time.
+var promptLock sync.Mutex
+
+// guardWrite asks for confirmation before the transactions cost estimates for book are
+// sent to a permanent network; see pipeline.WriteGuard. It returns nil on other networks.
+func guardWrite(settings uploadSettings, book string, cost pipeline.CostEstimate) error {
+	promptLock.Lock()
+	defer promptLock.Unlock()
+	guard := pipeline.WriteGuard{
+		Profile: settings.Profile,
+		Allow:   settings.AllowMainnet,
+		Tokens:  settings.ConfirmTokens,
+		Out:     os.Stdout,
+	}
+	if isTerminal(os.Stdin) {
+		guard.In = os.Stdin
+	}
+	return guard.Confirm(pipeline.WriteConfirmation{
+		Network: settings.Network,
+		Book:    book,
+		Cost:    cost,
+	})
+}
+
+// isTerminal reports whether file is an interactive terminal rather than a pipe or file.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// Offline submission waits for each transaction to seal before sending the next, and
+// stops sending once the bundle's reference block is within expiryMargin blocks of
+// expiring, so a transaction is never sent that cannot be included.
+const (
+	defaultBundleSize = 20
+	expiryMargin      = 30
+	sealTimeout       = 3 * time.Minute
+	sealPoll          = 2 * time.Second
+)
+
+// runOffline builds, signs and submits a book's upload without the online host ever
+// holding the signer's key. "build" plans the upload like uploadBook and writes the
+// unsigned transactions; "sign", on an air-gapped host with the keystore, signs them;
+// "submit" sends the signed transactions in order and records each in the ledger.
+// Returns the process exit code.
+func runOffline(settings uploadSettings, book pipeline.BookManifest, args []string) int {
+	command := ""
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("offline "+command, flag.ExitOnError)
+	in := flags.String("in", "", "bundle to read (default: the book's bundle in "+settings.OfflineFolder+")")
+	out := flags.String("out", "", "bundle to write (default: the book's bundle in "+settings.OfflineFolder+")")
+	access := flags.String("access", settings.Profile.AccessAPI, "REST endpoint of a Flow access node")
+	contract := flags.String("contract", settings.Profile.ContractAddress, "address of the Alexandria contract")
+	limit := flags.Int("max", defaultBundleSize, "most transactions in one bundle; later ones go in the next")
+	flags.BoolVar(&settings.CreateGenre, "create-genre", false, "create the book's genre with Admin/add_genre if it does not exist")
+	flags.Parse(args)
+
+	var err error
+	switch command {
+	case "build":
+		err = buildBundle(settings, book, *access, *contract, *limit, orDefault(*out, pipeline.OfflinePath(settings.OfflineFolder, book.Title, pipeline.OfflineUnsigned)))
+	case "sign":
+		err = signBundle(settings,
+			orDefault(*in, pipeline.OfflinePath(settings.OfflineFolder, book.Title, pipeline.OfflineUnsigned)),
+			orDefault(*out, pipeline.OfflinePath(settings.OfflineFolder, book.Title, pipeline.OfflineSigned)))
+	case "submit":
+		err = submitBundle(settings, *access, orDefault(*in, pipeline.OfflinePath(settings.OfflineFolder, book.Title, pipeline.OfflineSigned)))
+	default:
+		fmt.Printf("Unknown offline command %q (expected build, sign or submit)\n", command)
+		return 2
+	}
+	if err != nil {
+		color.Red("%v", err)
+		return 1
+	}
+	return 0
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// buildBundle plans the book's upload and writes the transactions, up to limit of them,
+// with the signer's next sequence numbers and the latest sealed block as reference.
+func buildBundle(settings uploadSettings, book pipeline.BookManifest, access, contract string, limit int, path string) error {
+	sections, err := loadSections(settings.BooksFolder, book)
+	if err != nil {
+		return fmt.Errorf("error discovering section files: %w", err)
+	}
+	if len(sections) == 0 {
+		return fmt.Errorf("no section files found in %s matching %s", settings.BooksFolder, book.SectionFileRegex)
+	}
+	ledger, err := pipeline.OpenLedger(pipeline.LedgerPath(settings.LedgerFolder, book.Title))
+	if err != nil {
+		return fmt.Errorf("error reading upload ledger: %w", err)
+	}
+	accounts, err := pipeline.LoadFlowAccounts(settings.FlowConfig)
+	if err != nil {
+		return fmt.Errorf("error reading accounts: %w", err)
+	}
+	var key *pipeline.AccountKey
+	for _, account := range pipeline.NetworkAccounts(accounts, settings.Network) {
+		if account.Key.Account == settings.Network+"-"+book.Signer {
+			key = &account.Key
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("no account %s-%s in %s", settings.Network, book.Signer, settings.FlowConfig)
+	}
+
+	// Only scripts run here; the signer's key is never loaded.
+	o := Overflow(
+		WithGlobalPrintOptions(),
+		WithNetwork(settings.Network),
+	)
+	color.Red("Alexandria Contract - %s Offline Build", book.Title)
+	color.Red("")
+	preflight := preflightBook(o, settings, book, sections, ledger)
+	printPreflight(preflight)
+	if err := preflight.Err(); err != nil {
+		return fmt.Errorf("refusing to build: %w", err)
+	}
+	fmt.Println()
+	steps, err := planSteps(o, settings, book, sections)
+	if err != nil {
+		return fmt.Errorf("refusing to build: %w", err)
+	}
+	estimate, err := planUpload(ledger, settings.Network, book, sections, steps)
+	if err != nil {
+		return fmt.Errorf("error planning upload: %w", err)
+	}
+	if len(estimate.Transactions) == 0 {
+		color.Green("Ledger: every chapter of %s is already sealed on %s. Nothing to do.", book.Title, settings.Network)
+		return nil
+	}
+	color.Cyan("\nCost estimate for %s on %s:", book.Title, settings.Network)
+	if _, err := checkCost(o, settings, book.Signer, estimate, false); err != nil {
+		return fmt.Errorf("refusing to build: %w", err)
+	}
+
+	ctx := context.Background()
+	client := pipeline.NewAccessClient(access)
+	onChain, err := client.AccountKey(ctx, key.Address, key.Index)
+	if err != nil {
+		return fmt.Errorf("could not read key %d of %s: %w", key.Index, key.Address, err)
+	}
+	if onChain.Revoked {
+		return fmt.Errorf("key %d of %s is revoked", key.Index, key.Address)
+	}
+	if !strings.EqualFold(onChain.SigAlgo, key.SigAlgo) || !strings.EqualFold(onChain.HashAlgo, key.HashAlgo) {
+		return fmt.Errorf("%s says key %d of %s is %s/%s, but on-chain it is %s/%s",
+			settings.FlowConfig, key.Index, key.Address, key.SigAlgo, key.HashAlgo, onChain.SigAlgo, onChain.HashAlgo)
+	}
+	block, err := client.LatestSealedBlock(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read the latest sealed block: %w", err)
+	}
+
+	bundle := &pipeline.OfflineBundle{
+		Version:              pipeline.OfflineBundleVersion,
+		Stage:                pipeline.OfflineUnsigned,
+		Network:              settings.Network,
+		Book:                 book.Title,
+		Key:                  *key,
+		PublicKey:            onChain.PublicKey,
+		SequenceNumber:       onChain.SequenceNumber,
+		ReferenceBlockID:     block.ID,
+		ReferenceBlockHeight: block.Height,
+		Built:                time.Now().UTC(),
+	}
+	addresses := map[string]string{"Alexandria": contract}
+	scripts := map[string]string{}
+	planned := estimate.Transactions[:bundleCut(estimate.Transactions, limit)]
+	for _, tx := range planned {
+		script, ok := scripts[tx.Name]
+		if !ok {
+			code, err := os.ReadFile(filepath.Join(filepath.Dir(settings.FlowConfig), "transactions", tx.Name+".cdc"))
+			if err != nil {
+				return err
+			}
+			if script, err = pipeline.ResolveImports(string(code), addresses); err != nil {
+				return fmt.Errorf("%s: %w (set the contract address with -contract)", tx.Name, err)
+			}
+			scripts[tx.Name] = script
+		}
+		if err := bundle.AddTransaction(tx.Entry, tx.Label, script, tx.Args...); err != nil {
+			return err
+		}
+	}
+	if err := bundle.Save(path); err != nil {
+		return fmt.Errorf("error writing bundle: %w", err)
+	}
+
+	color.Green("\nWrote %d unsigned transactions to %s.", len(planned), path)
+	if rest := len(estimate.Transactions) - len(planned); rest > 0 {
+		color.Yellow("%d more transactions will be built once these are submitted.", rest)
+	}
+	color.Yellow("The bundle expires at block %d: sign it and submit it before then.", block.Height+pipeline.TransactionExpiry)
+	return nil
+}
+
+// bundleCut returns how many of the planned transactions go in a bundle of at most
+// limit, extended so a chapter's name and content are never separated from the
+// transactions that follow them: the ledger would skip those on the next build.
+func bundleCut(planned []plannedTx, limit int) int {
+	if limit <= 0 || limit >= len(planned) {
+		return len(planned)
+	}
+	cut := limit
+	for cut < len(planned) && (planned[cut-1].Name == "Admin/add_chapter_name" || planned[cut-1].Name == "Admin/add_chapter") {
+		cut++
+	}
+	return cut
+}
+
+// signBundle signs an unsigned bundle with the key of its account from the keystore.
+// It needs no network access.
+func signBundle(settings uploadSettings, in, out string) error {
+	bundle, err := pipeline.LoadOfflineBundle(in)
+	if err != nil {
+		return err
+	}
+	profile, err := pipeline.LookupNetwork(bundle.Network)
+	if err != nil {
+		return err
+	}
+	settings.Network, settings.Profile = profile.Name, profile
+	printBundle(bundle)
+	if err := guardWrite(settings, bundle.Book, pipeline.FeeEstimate(len(bundle.Transactions))); err != nil {
+		return fmt.Errorf("refusing to sign: %w", err)
+	}
+	keystore, err := pipeline.LoadKeystore(settings.KeystorePath)
+	if err != nil {
+		return fmt.Errorf("error reading keystore: %w", err)
+	}
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		return err
+	}
+	signer, err := keystore.Signer(bundle.Key.Account, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := bundle.Sign(signer, time.Now().UTC()); err != nil {
+		return err
+	}
+	if err := bundle.Save(out); err != nil {
+		return fmt.Errorf("error writing bundle: %w", err)
+	}
+	color.Green("Signed %d transactions into %s; submit it from the online host.", len(bundle.Transactions), out)
+	return nil
+}
+
+// printBundle describes what a bundle would do, for the operator approving it.
+func printBundle(bundle *pipeline.OfflineBundle) {
+	color.Cyan("Bundle for %q on %s, built %s", bundle.Book, bundle.Network, bundle.Built.Format(time.RFC3339))
+	color.Cyan("Signer %s (key %d of %s), reference block %d",
+		bundle.Key.Account, bundle.Key.Index, bundle.Key.Address, bundle.ReferenceBlockHeight)
+	for _, tx := range bundle.Transactions {
+		fmt.Printf("  %6d  %-28s %s\n", tx.SequenceNumber, tx.Entry.Action, tx.Label)
+	}
+}
+
+// submitBundle sends the transactions of a signed bundle in order, waiting for each to
+// seal and recording it in the book's ledger, and stops at the first that fails.
+// Transactions whose sequence number the key has already used were sent by an earlier
+// run: they are looked up, recorded if the ledger lacks them, and not sent again.
+func submitBundle(settings uploadSettings, access, in string) error {
+	bundle, err := pipeline.LoadOfflineBundle(in)
+	if err != nil {
+		return err
+	}
+	if bundle.Network != settings.Network {
+		return fmt.Errorf("%s is for %s; run with -network %s", in, bundle.Network, bundle.Network)
+	}
+	if err := bundle.Verify(); err != nil {
+		return fmt.Errorf("%s: %w", in, err)
+	}
+	ledger, err := pipeline.OpenLedger(pipeline.LedgerPath(settings.LedgerFolder, bundle.Book))
+	if err != nil {
+		return fmt.Errorf("error reading upload ledger: %w", err)
+	}
+
+	ctx := context.Background()
+	client := pipeline.NewAccessClient(access)
+	onChain, err := client.AccountKey(ctx, bundle.Key.Address, bundle.Key.Index)
+	if err != nil {
+		return fmt.Errorf("could not read key %d of %s: %w", bundle.Key.Index, bundle.Key.Address, err)
+	}
+	recorded := map[string]bool{}
+	for _, entry := range ledger.Entries() {
+		recorded[entry.TxID] = true
+	}
+	var pending []pipeline.OfflineTx
+	for _, tx := range bundle.Transactions {
+		if tx.SequenceNumber >= onChain.SequenceNumber {
+			pending = append(pending, tx)
+			continue
+		}
+		if recorded[tx.ID] {
+			continue
+		}
+		result, err := client.TransactionResult(ctx, tx.ID)
+		if err != nil {
+			return fmt.Errorf("sequence number %d is used, but %s %s (%s) is not on-chain: %w; build a new bundle",
+				tx.SequenceNumber, tx.Entry.Action, tx.Label, tx.ID, err)
+		}
+		color.Green("Already submitted: %s %s", tx.Entry.Action, tx.Label)
+		recordOffline(client, settings, ledger, tx, result)
+	}
+	if len(pending) == 0 {
+		color.Green("Every transaction of %s is already submitted.", in)
+		return nil
+	}
+	if pending[0].SequenceNumber != onChain.SequenceNumber {
+		return fmt.Errorf("the key's sequence number is %d, but the bundle continues at %d; build a new bundle",
+			onChain.SequenceNumber, pending[0].SequenceNumber)
+	}
+	block, err := client.LatestSealedBlock(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read the latest sealed block: %w", err)
+	}
+	if bundle.Expired(block.Height, expiryMargin) {
+		return fmt.Errorf("the bundle's reference block %d is too old at block %d; build a new bundle",
+			bundle.ReferenceBlockHeight, block.Height)
+	}
+	if err := guardWrite(settings, bundle.Book, pipeline.FeeEstimate(len(pending))); err != nil {
+		return fmt.Errorf("refusing to submit: %w", err)
+	}
+
+	sealed := block.Height
+	for i, tx := range pending {
+		if bundle.Expired(sealed, expiryMargin) {
+			return fmt.Errorf("the bundle expires at block %d; %d transactions were not sent, build a new bundle",
+				bundle.ReferenceBlockHeight+pipeline.TransactionExpiry, len(pending)-i)
+		}
+		color.Yellow("Sending %s %s (sequence %d)", tx.Entry.Action, tx.Label, tx.SequenceNumber)
+		id, err := client.SendTransaction(ctx, bundle, tx)
+		if err != nil {
+			return fmt.Errorf("could not send %s %s: %w; %d transactions were not sent", tx.Entry.Action, tx.Label, err, len(pending)-i)
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, sealTimeout)
+		result, err := client.WaitSealed(waitCtx, id, sealPoll)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s %s: %w; run offline submit again to resume", tx.Entry.Action, tx.Label, err)
+		}
+		if result.Status == pipeline.TxExpired {
+			recordOffline(client, settings, ledger, tx, result)
+			return fmt.Errorf("%s %s expired before it was included; build a new bundle", tx.Entry.Action, tx.Label)
+		}
+		height, err := recordOffline(client, settings, ledger, tx, result)
+		if err != nil {
+			// Later transactions build on this one, e.g. add_paragraph on a failed add_chapter.
+			color.Red("✗ %s %s: %v", tx.Entry.Action, tx.Label, err)
+			return fmt.Errorf("%s %s failed: %w; %d transactions were not sent, build a new bundle", tx.Entry.Action, tx.Label, err, len(pending)-i-1)
+		}
+		color.Green("✓ %s %s sealed in %s", tx.Entry.Action, tx.Label, tx.ID)
+		if height > sealed {
+			sealed = height
+		}
+	}
+	color.Green("\nSubmitted %d transactions of %s.", len(pending), bundle.Book)
+	return nil
+}
+
+// recordOffline records the result of a bundle's transaction in the ledger. Returns the
+// height of the block that included it, and the transaction's error.
+func recordOffline(client *pipeline.AccessClient, settings uploadSettings, ledger *pipeline.Ledger, tx pipeline.OfflineTx, result pipeline.TransactionResult) (uint64, error) {
+	entry := tx.Entry
+	entry.TxID = tx.ID
+	var txErr error
+	switch {
+	case result.Status == pipeline.TxExpired:
+		txErr = errors.New("transaction expired")
+	case result.Error != "":
+		txErr = errors.New(result.Error)
+	}
+	if result.BlockID != "" {
+		if block, err := client.BlockByID(context.Background(), result.BlockID); err == nil {
+			entry.BlockHeight = block.Height
+		}
+	}
+	return entry.BlockHeight, recordEntry(settings, ledger, entry, txErr, result.Events)
+}
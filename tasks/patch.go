@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// chapterPatch is the plan for one section whose on-chain chapter differs from it.
+type chapterPatch struct {
+	Section chapterFile
+	Plain   []string
+	Plan    pipeline.PatchPlan
+}
+
+// runPatch fixes chapters that differ from their corrected local sections. For each one it
+// diffs the stored paragraphs against the section and plans either a tail trim and
+// re-append or a full replacement, whichever is cheaper; it prints every plan, asks for
+// confirmation, sends the transactions and reads each chapter back to verify it.
+// Returns the process exit code.
+func runPatch(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, sections []chapterFile, ledger *pipeline.Ledger, args []string) int {
+	flags := flag.NewFlagSet("patch", flag.ExitOnError)
+	only := flags.String("chapter", "", "patch only this chapter title")
+	dryRun := flags.Bool("dry-run", false, "print the plan without sending transactions")
+	yes := flags.Bool("yes", false, "send without asking for confirmation")
+	flags.Parse(args)
+
+	network := settings.Network
+	color.Red("Alexandria Contract - %s Patch (%s)", book.Title, network)
+
+	var patches []chapterPatch
+	for _, section := range sections {
+		if *only != "" && section.Title != *only {
+			continue
+		}
+		plain, err := readParagraphs(section.Path)
+		if err != nil {
+			color.Red("Error reading %s: %v", section.Path, err)
+			return 1
+		}
+		stored, err := fetchChapterParagraphs(o, book.Title, section.Title, section.Path)
+		if err != nil {
+			color.Yellow("%s: not on-chain (%v). Use upload to add it.", section.Title, err)
+			continue
+		}
+		plan, err := pipeline.PlanPatch(book.Title, section.Title, section.Index, stored, plain)
+		if err != nil {
+			color.Red("%v", err)
+			return 1
+		}
+		if plan.Strategy == pipeline.PatchNone {
+			color.Green("✓ %s matches the local section", section.Title)
+			continue
+		}
+		patches = append(patches, chapterPatch{Section: section, Plain: plain, Plan: plan})
+	}
+	if len(patches) == 0 {
+		color.Green("\nNothing to patch.")
+		return 0
+	}
+
+	count := 0
+	color.Cyan("\nPatch plan:")
+	for _, patch := range patches {
+		plan := patch.Plan
+		// and Admin/set_chapter_metadata, as the chapter's word count changes
+		count += len(plan.Steps) + 1
+		switch plan.Strategy {
+		case pipeline.PatchTail:
+			fmt.Printf("  %-28s tail: keep %d, remove %d, append %d paragraphs (%d transactions, %d bytes)\n",
+				patch.Section.Title, plan.Keep, plan.Remove, plan.Append, len(plan.Steps), plan.PayloadBytes)
+		case pipeline.PatchReplace:
+			fmt.Printf("  %-28s replace: first %d paragraphs match, send all %d (1 transaction, %d bytes)\n",
+				patch.Section.Title, plan.Keep, len(patch.Plain), plan.PayloadBytes)
+		}
+	}
+	cost := pipeline.FeeEstimate(count)
+	color.Cyan("Transactions: %d   Estimated fees: up to %.4f FLOW", count, cost.Fees)
+	if *dryRun {
+		color.Green("\nDry run complete. No transactions were sent.")
+		return 0
+	}
+	if settings.Profile.Permanent {
+		if err := guardWrite(settings, book.Title, cost); err != nil {
+			color.Red("Refusing to patch: %v", err)
+			return 1
+		}
+	} else if !*yes && !confirm(fmt.Sprintf("Send %d transactions to %s as %s?", count, network, book.Signer)) {
+		color.Yellow("Patch cancelled.")
+		return 1
+	}
+
+	failed := 0
+	for _, patch := range patches {
+		if err := applyPatch(o, settings, book, ledger, patch); err != nil {
+			color.Red("✗ %s: %v", patch.Section.Title, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		color.Red("\n%d of %d chapters were not patched.", failed, len(patches))
+		return 1
+	}
+	color.Green("\nPatched and verified %d chapters.", len(patches))
+	return 0
+}
+
+// applyPatch sends a chapter's patch transactions, reads the chapter back and records the
+// outcome in the ledger as a "patch" entry, sealed only when the chapter now matches.
+// It then sets the chapter's metadata again for its new content.
+func applyPatch(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, ledger *pipeline.Ledger, patch chapterPatch) error {
+	section := patch.Section
+	color.Cyan("\nPatching %s (%s)", section.Title, patch.Plan.Strategy)
+	entry := pipeline.LedgerEntry{
+		Network:     settings.Network,
+		Book:        book.Title,
+		Action:      "patch",
+		Chapter:     section.Title,
+		Index:       section.Index,
+		ContentHash: pipeline.HashParagraphs(patch.Plain),
+		Paragraphs:  len(patch.Plain),
+		Note:        fmt.Sprintf("%s: kept %d, removed %d, appended %d", patch.Plan.Strategy, patch.Plan.Keep, patch.Plan.Remove, patch.Plan.Append),
+	}
+	fail := func(err error) error {
+		entry.Status = pipeline.StatusFailed
+		entry.Error = err.Error()
+		if err := ledger.Append(entry); err != nil {
+			color.Red("Could not write ledger %s: %v", ledger.Path, err)
+		}
+		return err
+	}
+
+	for i, step := range patch.Plan.Steps {
+		args := []OverflowInteractionOption{
+			WithSigner(book.Signer),
+			WithArg("bookTitle", pipeline.StringArg(book.Title)),
+			WithArg("chapterTitle", pipeline.StringArg(section.Title)),
+		}
+		switch step.Name {
+		case "Admin/add_paragraph_to_chapter":
+			args = append(args, WithArg("paragraph", pipeline.StringArg(step.Paragraph)))
+		case "Admin/add_chapter":
+			args = append(args, WithArg("index", pipeline.IntArg(section.Index)), WithArg("paragraphs", pipeline.StringArrayArg(step.Paragraphs)))
+		}
+		result := o.Tx(step.Name, args...)
+		err := recordTx(o, settings, ledger, pipeline.LedgerEntry{
+			Network: settings.Network,
+			Book:    book.Title,
+			Action:  step.Name,
+			Chapter: section.Title,
+			Index:   section.Index,
+		}, result)
+		result.Print()
+		if err != nil {
+			return fail(fmt.Errorf("step %d of %d (%s) failed: %w", i+1, len(patch.Plan.Steps), step.Name, err))
+		}
+	}
+
+	onChain, err := fetchChapterParagraphs(o, book.Title, section.Title, section.Path)
+	if err != nil {
+		return fail(fmt.Errorf("could not read the chapter back: %w", err))
+	}
+	diff := pipeline.CompareParagraphs(patch.Plain, onChain)
+	if !diff.Match() {
+		return fail(fmt.Errorf("chapter still differs at paragraph %d after patching", diff.FirstDiff))
+	}
+	entry.Status = pipeline.StatusSealed
+	if err := ledger.Append(entry); err != nil {
+		color.Red("Could not write ledger %s: %v", ledger.Path, err)
+	}
+	color.Green("✓ %s: %d paragraphs, sha256 %.12s", section.Title, diff.LocalParagraphs, diff.LocalHash)
+	return resetChapterMetadata(o, settings, ledger, book.Signer, book.Title, section.Title, section.Index, patch.Plain)
+}
+
+// confirm asks a yes/no question on the terminal and reports whether the answer was yes.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,316 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onflow/cadence"
+	"github.com/onflow/cadence/common"
+	jsoncdc "github.com/onflow/cadence/encoding/json"
+)
+
+// Transaction statuses reported by the access API.
+const (
+	TxPending   = "Pending"
+	TxFinalized = "Finalized"
+	TxExecuted  = "Executed"
+	TxSealed    = "Sealed"
+	TxExpired   = "Expired"
+)
+
+// AccessClient talks to a Flow access node's REST API, for the offline workflow, which
+// builds and submits transactions without Overflow holding a key.
+type AccessClient struct {
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// NewAccessClient returns a client for the REST API at baseURL.
+func NewAccessClient(baseURL string) *AccessClient {
+	return &AccessClient{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Block is a block header.
+type Block struct {
+	ID     string
+	Height uint64
+}
+
+// OnChainAccountKey is an account key as the access node reports it.
+type OnChainAccountKey struct {
+	Index          int
+	PublicKey      string
+	SigAlgo        string
+	HashAlgo       string
+	SequenceNumber uint64
+	Revoked        bool
+}
+
+// TransactionResult is the outcome of a submitted transaction.
+type TransactionResult struct {
+	BlockID string
+	Status  string
+	Error   string
+	Events  []EmittedEvent
+}
+
+type restBlock struct {
+	Header struct {
+		ID     string `json:"id"`
+		Height string `json:"height"`
+	} `json:"header"`
+}
+
+// LatestSealedBlock returns the latest sealed block.
+func (c *AccessClient) LatestSealedBlock(ctx context.Context) (Block, error) {
+	return c.block(ctx, "/v1/blocks?height=sealed")
+}
+
+// BlockByID returns the block with id.
+func (c *AccessClient) BlockByID(ctx context.Context, id string) (Block, error) {
+	return c.block(ctx, "/v1/blocks/"+id)
+}
+
+func (c *AccessClient) block(ctx context.Context, path string) (Block, error) {
+	var blocks []restBlock
+	if err := c.do(ctx, http.MethodGet, path, nil, &blocks); err != nil {
+		return Block{}, err
+	}
+	if len(blocks) == 0 {
+		return Block{}, fmt.Errorf("%s: no block", path)
+	}
+	height, err := strconv.ParseUint(blocks[0].Header.Height, 10, 64)
+	if err != nil {
+		return Block{}, fmt.Errorf("%s: height: %w", path, err)
+	}
+	return Block{ID: blocks[0].Header.ID, Height: height}, nil
+}
+
+// AccountKey returns key index of the account at address.
+func (c *AccessClient) AccountKey(ctx context.Context, address string, index int) (OnChainAccountKey, error) {
+	canonical, err := ParseAddress(address)
+	if err != nil {
+		return OnChainAccountKey{}, err
+	}
+	var account struct {
+		Keys []struct {
+			Index          string `json:"index"`
+			PublicKey      string `json:"public_key"`
+			SigAlgo        string `json:"signing_algorithm"`
+			HashAlgo       string `json:"hashing_algorithm"`
+			SequenceNumber string `json:"sequence_number"`
+			Revoked        bool   `json:"revoked"`
+		} `json:"keys"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/accounts/"+strings.TrimPrefix(canonical, "0x")+"?expand=keys", nil, &account); err != nil {
+		return OnChainAccountKey{}, err
+	}
+	for _, key := range account.Keys {
+		if key.Index != strconv.Itoa(index) {
+			continue
+		}
+		sequence, err := strconv.ParseUint(key.SequenceNumber, 10, 64)
+		if err != nil {
+			return OnChainAccountKey{}, fmt.Errorf("key %d of %s: sequence number: %w", index, canonical, err)
+		}
+		return OnChainAccountKey{
+			Index:          index,
+			PublicKey:      strings.TrimPrefix(key.PublicKey, "0x"),
+			SigAlgo:        key.SigAlgo,
+			HashAlgo:       key.HashAlgo,
+			SequenceNumber: sequence,
+			Revoked:        key.Revoked,
+		}, nil
+	}
+	return OnChainAccountKey{}, fmt.Errorf("%s has no key %d", canonical, index)
+}
+
+type restSignature struct {
+	Address   string `json:"address"`
+	KeyIndex  string `json:"key_index"`
+	Signature string `json:"signature"`
+}
+
+// SendTransaction submits a signed transaction of bundle and returns the ID the access
+// node gives it, which must be the one the bundle computed.
+func (c *AccessClient) SendTransaction(ctx context.Context, bundle *OfflineBundle, tx OfflineTx) (string, error) {
+	flowTx, err := bundle.Transaction(tx)
+	if err != nil {
+		return "", err
+	}
+	arguments := make([]string, len(flowTx.Arguments))
+	for i, arg := range flowTx.Arguments {
+		arguments[i] = base64.StdEncoding.EncodeToString(arg)
+	}
+	authorizers := make([]string, len(flowTx.Authorizers))
+	for i, authorizer := range flowTx.Authorizers {
+		authorizers[i] = authorizer.Hex()
+	}
+	signatures := make([]restSignature, len(flowTx.EnvelopeSignatures))
+	for i, signature := range flowTx.EnvelopeSignatures {
+		signatures[i] = restSignature{
+			Address:   signature.Address.Hex(),
+			KeyIndex:  strconv.FormatUint(uint64(signature.KeyIndex), 10),
+			Signature: base64.StdEncoding.EncodeToString(signature.Signature),
+		}
+	}
+	body := map[string]interface{}{
+		"script":             base64.StdEncoding.EncodeToString(flowTx.Script),
+		"arguments":          arguments,
+		"reference_block_id": flowTx.ReferenceBlockID.Hex(),
+		"gas_limit":          strconv.FormatUint(flowTx.GasLimit, 10),
+		"payer":              flowTx.Payer.Hex(),
+		"proposal_key": map[string]string{
+			"address":         flowTx.ProposalKey.Address.Hex(),
+			"key_index":       strconv.FormatUint(uint64(flowTx.ProposalKey.KeyIndex), 10),
+			"sequence_number": strconv.FormatUint(flowTx.ProposalKey.SequenceNumber, 10),
+		},
+		"authorizers":         authorizers,
+		"payload_signatures":  []restSignature{},
+		"envelope_signatures": signatures,
+	}
+	var sent struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/v1/transactions", body, &sent); err != nil {
+		return "", err
+	}
+	if tx.ID != "" && sent.ID != tx.ID {
+		return sent.ID, fmt.Errorf("the access node accepted the transaction as %s, not %s", sent.ID, tx.ID)
+	}
+	return sent.ID, nil
+}
+
+// TransactionResult returns the current result of the transaction with id.
+func (c *AccessClient) TransactionResult(ctx context.Context, id string) (TransactionResult, error) {
+	var raw struct {
+		BlockID      string `json:"block_id"`
+		Status       string `json:"status"`
+		ErrorMessage string `json:"error_message"`
+		Events       []struct {
+			Type    string `json:"type"`
+			Payload string `json:"payload"`
+		} `json:"events"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/transaction_results/"+id, nil, &raw); err != nil {
+		return TransactionResult{}, err
+	}
+	result := TransactionResult{BlockID: raw.BlockID, Status: raw.Status, Error: raw.ErrorMessage}
+	for _, event := range raw.Events {
+		fields, err := decodeEventPayload(event.Payload)
+		if err != nil {
+			return result, fmt.Errorf("event %s: %w", event.Type, err)
+		}
+		result.Events = append(result.Events, EmittedEvent{Name: event.Type, Fields: fields})
+	}
+	return result, nil
+}
+
+// WaitSealed polls the transaction's result until it is sealed or expired, or ctx ends.
+func (c *AccessClient) WaitSealed(ctx context.Context, id string, poll time.Duration) (TransactionResult, error) {
+	for {
+		result, err := c.TransactionResult(ctx, id)
+		if err == nil && (result.Status == TxSealed || result.Status == TxExpired) {
+			return result, nil
+		}
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = fmt.Errorf("transaction %s still %s: %w", id, result.Status, ctx.Err())
+			}
+			return result, err
+		case <-time.After(poll):
+		}
+	}
+}
+
+// AccessError is a non-2xx response from the access node.
+type AccessError struct {
+	Status  int
+	Message string
+}
+
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("access node: %d %s", e.Status, e.Message)
+}
+
+func (c *AccessClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var problem struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &problem) != nil || problem.Message == "" {
+			problem.Message = strings.TrimSpace(string(data))
+		}
+		return &AccessError{Status: resp.StatusCode, Message: problem.Message}
+	}
+	return json.Unmarshal(data, out)
+}
+
+// decodeEventPayload decodes a base64 JSON-Cadence event into its fields: strings,
+// addresses (0x-prefixed) and nil as Go values, anything else in its Cadence form.
+func decodeEventPayload(payload string) (map[string]interface{}, error) {
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+	value, err := jsoncdc.Decode(nil, data)
+	if err != nil {
+		return nil, err
+	}
+	event, ok := value.(cadence.Event)
+	if !ok {
+		return nil, fmt.Errorf("payload is a %T, not an event", value)
+	}
+	fields := map[string]interface{}{}
+	for name, field := range cadence.FieldsMappedByName(event) {
+		fields[name] = eventValue(field)
+	}
+	return fields, nil
+}
+
+func eventValue(value cadence.Value) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case cadence.Optional:
+		return eventValue(v.Value)
+	case cadence.String:
+		return string(v)
+	case cadence.Address:
+		return common.Address(v).HexWithPrefix()
+	}
+	return value.String()
+}
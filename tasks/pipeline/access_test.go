@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chapterNameEvent = `{"type":"Event","value":{"id":"A.fed1adffd14ea9d0.Alexandria.ChapterNameAdded","fields":[
+	{"name":"bookTitle","value":{"type":"String","value":"Ecce Homo"}},
+	{"name":"chapterTitle","value":{"type":"String","value":"Preface"}},
+	{"name":"keeper","value":{"type":"Optional","value":{"type":"Address","value":"0x6d96bf7d95a8b595"}}}]}}`
+
+// testAccessNode serves the REST endpoints the offline workflow uses. The transaction
+// it is sent is reported pending once, then sealed.
+func testAccessNode(t *testing.T, sent *map[string]interface{}) *httptest.Server {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/blocks", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "sealed", r.URL.Query().Get("height"))
+		io.WriteString(w, `[{"header":{"id":"`+strings.Repeat("ab", 32)+`","height":"1000"}}]`)
+	})
+	mux.HandleFunc("GET /v1/blocks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"header":{"id":"`+r.PathValue("id")+`","height":"1007"}}]`)
+	})
+	mux.HandleFunc("GET /v1/accounts/6d96bf7d95a8b595", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"address":"0x6d96bf7d95a8b595","keys":[
+			{"index":"0","public_key":"0xabcd","signing_algorithm":"ECDSA_P256","hashing_algorithm":"SHA3_256","sequence_number":"41","revoked":false},
+			{"index":"1","public_key":"0xef01","signing_algorithm":"ECDSA_P256","hashing_algorithm":"SHA3_256","sequence_number":"0","revoked":true}]}`)
+	})
+	mux.HandleFunc("POST /v1/transactions", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(sent))
+		io.WriteString(w, `{"id":"`+strings.Repeat("01", 32)+`"}`)
+	})
+	mux.HandleFunc("GET /v1/transaction_results/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != strings.Repeat("01", 32) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"code":404,"message":"transaction not found"}`)
+			return
+		}
+		polls++
+		if polls == 1 {
+			io.WriteString(w, `{"block_id":"","status":"Pending","error_message":"","events":[]}`)
+			return
+		}
+		payload := base64.StdEncoding.EncodeToString([]byte(chapterNameEvent))
+		io.WriteString(w, `{"block_id":"`+strings.Repeat("cd", 32)+`","status":"Sealed","error_message":"","events":[
+			{"type":"A.fed1adffd14ea9d0.Alexandria.ChapterNameAdded","payload":"`+payload+`"}]}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAccessClientReads(t *testing.T) {
+	var sent map[string]interface{}
+	client := NewAccessClient(testAccessNode(t, &sent).URL + "/")
+	ctx := context.Background()
+
+	block, err := client.LatestSealedBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Block{ID: strings.Repeat("ab", 32), Height: 1000}, block)
+
+	key, err := client.AccountKey(ctx, "6d96bf7d95a8b595", 0)
+	require.NoError(t, err)
+	assert.Equal(t, OnChainAccountKey{Index: 0, PublicKey: "abcd", SigAlgo: "ECDSA_P256", HashAlgo: "SHA3_256", SequenceNumber: 41}, key)
+	key, err = client.AccountKey(ctx, "0x6d96bf7d95a8b595", 1)
+	require.NoError(t, err)
+	assert.True(t, key.Revoked)
+	_, err = client.AccountKey(ctx, "0x6d96bf7d95a8b595", 2)
+	assert.ErrorContains(t, err, "has no key 2")
+
+	_, err = client.TransactionResult(ctx, strings.Repeat("99", 32))
+	var accessErr *AccessError
+	require.ErrorAs(t, err, &accessErr)
+	assert.Equal(t, http.StatusNotFound, accessErr.Status)
+	assert.Equal(t, "transaction not found", accessErr.Message)
+}
+
+func TestAccessClientSendsAndWaits(t *testing.T) {
+	var sent map[string]interface{}
+	client := NewAccessClient(testAccessNode(t, &sent).URL)
+	ctx := context.Background()
+	bundle, signer := testBundle(t)
+	require.NoError(t, bundle.Sign(signer, time.Now()))
+
+	tx := bundle.Transactions[0]
+	_, err := client.SendTransaction(ctx, bundle, tx)
+	assert.ErrorContains(t, err, "accepted the transaction as", "the test node's ID is not the bundle's")
+	tx.ID = ""
+	id, err := client.SendTransaction(ctx, bundle, tx)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("01", 32), id)
+
+	assert.Equal(t, "6d96bf7d95a8b595", sent["payer"])
+	assert.Equal(t, []interface{}{"6d96bf7d95a8b595"}, sent["authorizers"])
+	assert.Equal(t, "41", sent["proposal_key"].(map[string]interface{})["sequence_number"])
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte(tx.Script)), sent["script"])
+	arguments := sent["arguments"].([]interface{})
+	require.Len(t, arguments, 2)
+	argument, err := base64.StdEncoding.DecodeString(arguments[0].(string))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"String","value":"Ecce Homo"}`, string(argument))
+	envelope := sent["envelope_signatures"].([]interface{})
+	require.Len(t, envelope, 1)
+
+	result, err := client.WaitSealed(ctx, id, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, TxSealed, result.Status)
+	assert.Equal(t, strings.Repeat("cd", 32), result.BlockID)
+	require.Len(t, result.Events, 1)
+	assert.Equal(t, "Ecce Homo", result.Events[0].Fields["bookTitle"])
+	assert.Equal(t, "0x6d96bf7d95a8b595", result.Events[0].Fields["keeper"])
+
+	expected, ok := ExpectEvent("Admin/add_chapter_name", "Ecce Homo", "Preface")
+	require.True(t, ok)
+	assert.NoError(t, expected.Confirm(result.Events))
+
+	block, err := client.BlockByID(ctx, result.BlockID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1007), block.Height)
+}
@@ -0,0 +1,149 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/onflow/cadence"
+	"github.com/onflow/cadence/common"
+	jsoncdc "github.com/onflow/cadence/encoding/json"
+)
+
+// CadenceArg is a transaction or script argument as a Cadence value. Every task
+// builds its arguments with the helpers below and passes them to WithArg as-is:
+// Overflow hands Cadence values to the access node unchanged, so text arrives
+// exactly as given. A Go string passed to WithArg is parsed as a Cadence literal
+// instead, where \" \\ \t and \u{...} are escape sequences; a []string is not.
+type CadenceArg = cadence.Value
+
+// StringArg encodes a Cadence String argument.
+func StringArg(s string) CadenceArg {
+	return cadence.String(s)
+}
+
+// IntArg encodes a Cadence Int argument.
+func IntArg(i int) CadenceArg {
+	return cadence.NewInt(i)
+}
+
+// UInt64Arg encodes a Cadence UInt64 argument.
+func UInt64Arg(i uint64) CadenceArg {
+	return cadence.UInt64(i)
+}
+
+// StringArrayArg encodes a Cadence [String] argument.
+func StringArrayArg(values []string) CadenceArg {
+	elements := make([]cadence.Value, len(values))
+	for i, v := range values {
+		elements[i] = cadence.String(v)
+	}
+	return cadence.NewArray(elements).WithType(cadence.NewVariableSizedArrayType(cadence.StringType))
+}
+
+// ParseAddress reads a Flow address written in hex, with or without the 0x prefix,
+// and returns it in its canonical 0x-prefixed 16-digit form.
+func ParseAddress(hex string) (string, error) {
+	address, err := parseAddress(hex)
+	if err != nil {
+		return "", err
+	}
+	return address.HexWithPrefix(), nil
+}
+
+// AddressArg encodes a Cadence Address argument from a hex address.
+func AddressArg(hex string) (CadenceArg, error) {
+	address, err := parseAddress(hex)
+	if err != nil {
+		return nil, err
+	}
+	return cadence.Address(address), nil
+}
+
+func parseAddress(hex string) (common.Address, error) {
+	hex = strings.TrimSpace(hex)
+	address, err := common.HexToAddress(hex)
+	if hex == "" || err != nil {
+		return common.Address{}, fmt.Errorf("invalid Flow address %q", hex)
+	}
+	return address, nil
+}
+
+// EncodeArg returns the exact JSON-Cadence bytes sent to the access node for the argument.
+func EncodeArg(arg CadenceArg) ([]byte, error) {
+	encoded, err := jsoncdc.Encode(arg)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(encoded, []byte("\n")), nil
+}
+
+// PayloadBytes returns the total encoded size of a transaction's arguments.
+func PayloadBytes(args ...CadenceArg) (int, error) {
+	total := 0
+	for _, arg := range args {
+		encoded, err := EncodeArg(arg)
+		if err != nil {
+			return 0, err
+		}
+		total += len(encoded)
+	}
+	return total, nil
+}
+
+// CheckText reports text that cannot be stored as a Cadence String: Cadence strings
+// must be valid UTF-8.
+func CheckText(text string) error {
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("invalid UTF-8 at byte %d", invalidUTF8At(text))
+	}
+	return nil
+}
+
+func invalidUTF8At(text string) int {
+	for i, r := range text {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(text[i:]); size == 1 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// LegacyUnescape reverses the escaping early uploads applied before sending paragraphs
+// in a [String] argument, which stored them with \\ for \ and \" for ". It is only used
+// to recognise chapters stored that way.
+func LegacyUnescape(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if escaped {
+			if r != '\\' && r != '"' {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if escaped {
+		b.WriteRune('\\')
+	}
+	return b.String()
+}
+
+// LegacyUnescapeAll applies LegacyUnescape to every paragraph.
+func LegacyUnescapeAll(paragraphs []string) []string {
+	plain := make([]string, len(paragraphs))
+	for i, paragraph := range paragraphs {
+		plain[i] = LegacyUnescape(paragraph)
+	}
+	return plain
+}
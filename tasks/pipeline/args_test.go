@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCadenceArgEncoding(t *testing.T) {
+	encoded, err := EncodeArg(StringArrayArg([]string{`He said "Ecce"`, `C:\Homo`}))
+	require.NoError(t, err)
+	assert.Equal(t, `{"value":[{"value":"He said \"Ecce\"","type":"String"},{"value":"C:\\Homo","type":"String"}],"type":"Array"}`, string(encoded))
+
+	encoded, err = EncodeArg(IntArg(7))
+	require.NoError(t, err)
+	assert.Equal(t, `{"value":"7","type":"Int"}`, string(encoded))
+
+	size, err := PayloadBytes(StringArg("Ecce Homo"), IntArg(7))
+	require.NoError(t, err)
+	assert.Equal(t, len(`{"value":"Ecce Homo","type":"String"}`)+len(`{"value":"7","type":"Int"}`), size)
+}
+
+func TestStringArgIsExact(t *testing.T) {
+	// Text is carried as a value, never as a literal, so escape sequences stay text.
+	for _, text := range []string{`\u{1F600}`, `\"`, "tab\there", "é vs e\u0301", "🦉"} {
+		assert.EqualValues(t, text, StringArg(text))
+	}
+}
+
+func TestAddressArg(t *testing.T) {
+	address, err := ParseAddress("f8d6e0586b0a20c7")
+	require.NoError(t, err)
+	assert.Equal(t, "0xf8d6e0586b0a20c7", address)
+	address, err = ParseAddress("0x1")
+	require.NoError(t, err)
+	assert.Equal(t, "0x0000000000000001", address)
+
+	arg, err := AddressArg("0xf8d6e0586b0a20c7")
+	require.NoError(t, err)
+	encoded, err := EncodeArg(arg)
+	require.NoError(t, err)
+	assert.Equal(t, `{"value":"0xf8d6e0586b0a20c7","type":"Address"}`, string(encoded))
+
+	for _, invalid := range []string{"", "bob", "0x0102030405060708090a"} {
+		_, err := AddressArg(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCheckText(t *testing.T) {
+	assert.NoError(t, CheckText("Ecce Homo \u0000 🦉"))
+	assert.ErrorContains(t, CheckText("Ecce\xffHomo"), "byte 4")
+}
+
+func TestLegacyUnescape(t *testing.T) {
+	assert.Equal(t, `He said "Ecce" C:\Homo`, LegacyUnescape(`He said \"Ecce\" C:\\Homo`))
+	assert.Equal(t, `a\nb\`, LegacyUnescape(`a\nb\`))
+	assert.Equal(t, []string{`"x"`}, LegacyUnescapeAll([]string{`\"x\"`}))
+}
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// BookManifest describes one book to upload: its catalog metadata, where
+// its section files are, and how its chapters are titled.
+type BookManifest struct {
+	Title   string `json:"title"`
+	Author  string `json:"author"`
+	Genre   string `json:"genre"`
+	Edition string `json:"edition"`
+	Summary string `json:"summary"`
+	// SectionFileRegex matches the book's section files and has one submatch
+	// for the numeric index, e.g. `^Crime_Section_(\d+)\.txt$`
+	SectionFileRegex string `json:"sectionFileRegex"`
+	StartIndex       int    `json:"startIndex,omitempty"`
+	// ChapterTitles maps section index to chapter title; missing indexes
+	// use "Chapter <index>".
+	ChapterTitles map[int]string `json:"chapterTitles,omitempty"`
+	// Signer overrides the catalog's default signer for this book.
+	Signer string `json:"signer,omitempty"`
+	// Keeper is the address attached to the book as its Keeper after it is created.
+	Keeper string `json:"keeper,omitempty"`
+	// Source is the original text the section files were split from, relative to the
+	// books folder. Its Project Gutenberg or Faded Page header fills in the metadata
+	// fields Metadata leaves empty.
+	Source   string       `json:"source,omitempty"`
+	Metadata BookMetadata `json:"metadata"`
+}
+
+// Validate checks that the manifest has everything an upload needs.
+func (m BookManifest) Validate() error {
+	if m.Title == "" {
+		return fmt.Errorf("book has no title")
+	}
+	for field, value := range map[string]string{"author": m.Author, "genre": m.Genre, "sectionFileRegex": m.SectionFileRegex} {
+		if value == "" {
+			return fmt.Errorf("%s: %s is required", m.Title, field)
+		}
+	}
+	re, err := regexp.Compile(m.SectionFileRegex)
+	if err != nil {
+		return fmt.Errorf("%s: invalid sectionFileRegex: %w", m.Title, err)
+	}
+	if re.NumSubexp() != 1 {
+		return fmt.Errorf("%s: sectionFileRegex must have exactly one submatch for the section index", m.Title)
+	}
+	if m.Keeper != "" {
+		if _, err := ParseAddress(m.Keeper); err != nil {
+			return fmt.Errorf("%s: keeper: %w", m.Title, err)
+		}
+	}
+	return nil
+}
+
+// Catalog is a list of books uploaded together in one run.
+type Catalog struct {
+	// Signer is the default signer for every book that does not set its own.
+	Signer string         `json:"signer"`
+	Books  []BookManifest `json:"books"`
+}
+
+// LoadCatalog reads and validates a catalog file.
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i, book := range catalog.Books {
+		if err := book.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: book %d: %w", path, i+1, err)
+		}
+		if seen[book.Title] {
+			return nil, fmt.Errorf("%s: %q is listed more than once", path, book.Title)
+		}
+		seen[book.Title] = true
+		if book.StartIndex == 0 {
+			catalog.Books[i].StartIndex = 1
+		}
+		if book.Signer == "" {
+			catalog.Books[i].Signer = catalog.Signer
+		}
+		if book.Keeper != "" {
+			catalog.Books[i].Keeper, _ = ParseAddress(book.Keeper)
+		}
+	}
+	return &catalog, nil
+}
+
+// Book upload outcomes in a catalog report
+const (
+	BookComplete = "complete"
+	BookPlanned  = "planned"
+	BookUploaded = "uploaded"
+	BookFailed   = "failed"
+)
+
+// BookReport is the outcome of one book in a catalog run.
+type BookReport struct {
+	Title        string        `json:"title"`
+	Status       string        `json:"status"`
+	Chapters     int           `json:"chapters"`
+	Transactions int           `json:"transactions"`
+	Failed       int           `json:"failed"`
+	StorageBytes int           `json:"storageBytes"`
+	Error        string        `json:"error,omitempty"`
+	Duration     time.Duration `json:"duration"`
+}
+
+// CatalogReport is the final report of a catalog run.
+type CatalogReport struct {
+	Network  string       `json:"network"`
+	Catalog  string       `json:"catalog"`
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Books    []BookReport `json:"books"`
+}
+
+// Count returns how many books finished with status.
+func (r CatalogReport) Count(status string) int {
+	n := 0
+	for _, book := range r.Books {
+		if book.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Write saves the report as indented JSON, creating its directory if needed.
+func (r CatalogReport) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
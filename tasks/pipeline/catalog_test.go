@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCatalog(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadCatalog(t *testing.T) {
+	catalog, err := LoadCatalog(writeCatalog(t, `{
+		"signer": "Prime-librarian",
+		"books": [
+			{"title": "Casino Royale", "author": "Ian Fleming", "genre": "Thriller", "sectionFileRegex": "^Casino_Section_(\\d+)\\.txt$", "keeper": "f3fcd2c1a78f5eee"},
+			{"title": "The Lion, the Witch and the Wardrobe", "author": "C. S. Lewis", "genre": "Fantasy",
+			 "sectionFileRegex": "^Narnia2_Section_(\\d+)\\.txt$", "startIndex": 2, "signer": "Librarian",
+			 "chapterTitles": {"2": "Lucy Looks into a Wardrobe"}}
+		]
+	}`))
+	require.NoError(t, err)
+	require.Len(t, catalog.Books, 2)
+	assert.Equal(t, 1, catalog.Books[0].StartIndex)
+	assert.Equal(t, "Prime-librarian", catalog.Books[0].Signer)
+	assert.Equal(t, "Librarian", catalog.Books[1].Signer)
+	assert.Equal(t, "Lucy Looks into a Wardrobe", catalog.Books[1].ChapterTitles[2])
+	assert.Equal(t, "0xf3fcd2c1a78f5eee", catalog.Books[0].Keeper)
+	assert.Empty(t, catalog.Books[1].Keeper)
+}
+
+func TestLoadCatalogRejectsInvalidBooks(t *testing.T) {
+	_, err := LoadCatalog(writeCatalog(t, `{"books": [{"title": "Dr. No", "author": "Ian Fleming", "genre": "Thriller", "sectionFileRegex": "^DrNo_Section_\\d+\\.txt$"}]}`))
+	assert.ErrorContains(t, err, "exactly one submatch")
+
+	_, err = LoadCatalog(writeCatalog(t, `{"books": [
+		{"title": "Dr. No", "author": "Ian Fleming", "genre": "Thriller", "sectionFileRegex": "^DrNo_Section_(\\d+)\\.txt$"},
+		{"title": "Dr. No", "author": "Ian Fleming", "genre": "Thriller", "sectionFileRegex": "^DrNo_Section_(\\d+)\\.txt$"}
+	]}`))
+	assert.ErrorContains(t, err, "listed more than once")
+
+	_, err = LoadCatalog(writeCatalog(t, `{"books": [{"title": "Dr. No", "author": "Ian Fleming", "genre": "Thriller", "sectionFileRegex": "^DrNo_Section_(\\d+)\\.txt$", "keeper": "bob"}]}`))
+	assert.ErrorContains(t, err, `keeper: invalid Flow address "bob"`)
+}
+
+func TestCatalogReportWriteCreatesDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", "catalog.json")
+	report := CatalogReport{Network: "emulator", Books: []BookReport{{Title: "Dr. No", Status: BookUploaded}}}
+	require.NoError(t, report.Write(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"title": "Dr. No"`)
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ComicInfoName is the metadata file of a comic archive, in the ComicRack schema.
+const ComicInfoName = "ComicInfo.xml"
+
+// ComicInfo is a volume's ComicInfo.xml, as far as the uploader uses it.
+type ComicInfo struct {
+	Title  string `xml:"Title"`
+	Series string `xml:"Series"`
+	// Number is the issue or chapter number, as written.
+	Number     string `xml:"Number"`
+	Volume     int    `xml:"Volume"`
+	Writer     string `xml:"Writer"`
+	Penciller  string `xml:"Penciller"`
+	Inker      string `xml:"Inker"`
+	Translator string `xml:"Translator"`
+	// Manga is Yes, No, Unknown or YesAndRightToLeft.
+	Manga string          `xml:"Manga"`
+	Pages []ComicPageInfo `xml:"Pages>Page"`
+}
+
+// ComicPageInfo describes one image of the volume, by its position among the volume's
+// images in name order.
+type ComicPageInfo struct {
+	Image int `xml:"Image,attr"`
+	// Type is FrontCover, InnerCover, Roundup, Story, Advertisement, Editorial,
+	// Letters, Preview, BackCover, Other or Deleted.
+	Type       string `xml:"Type,attr"`
+	DoublePage bool   `xml:"DoublePage,attr"`
+}
+
+// ParseComicInfo parses a ComicInfo.xml.
+func ParseComicInfo(data []byte) (*ComicInfo, error) {
+	var info ComicInfo
+	if err := xml.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("%s: %w", ComicInfoName, err)
+	}
+	info.Number = strings.TrimSpace(info.Number)
+	return &info, nil
+}
+
+// Chapter is Number as a chapter number of the page names, without leading zeros.
+func (c *ComicInfo) Chapter() string {
+	if c.Number == "" {
+		return ""
+	}
+	return chapterNumber(c.Number)
+}
+
+// ReadingOrder is the volume's reading order, RightToLeft or LeftToRight, or "" when
+// ComicInfo does not say.
+func (c *ComicInfo) ReadingOrder() string {
+	switch c.Manga {
+	case "YesAndRightToLeft":
+		return RightToLeft
+	case "No":
+		return LeftToRight
+	}
+	return ""
+}
+
+// Credits lists the people ComicInfo credits, e.g. "Writer: Kentaro Miura".
+func (c *ComicInfo) Credits() string {
+	var credits []string
+	for _, credit := range []struct{ role, names string }{
+		{"Writer", c.Writer}, {"Penciller", c.Penciller}, {"Inker", c.Inker}, {"Translator", c.Translator},
+	} {
+		if names := strings.TrimSpace(credit.names); names != "" {
+			credits = append(credits, credit.role+": "+names)
+		}
+	}
+	return strings.Join(credits, ", ")
+}
+
+// Page kinds, as in ImagePage.Kind; story pages have none.
+const (
+	PageCover   = "cover"
+	PageCredits = "credits"
+	// PageExtra is any other page that is not part of the story: adverts, editorials,
+	// letters, previews.
+	PageExtra = "extra"
+	// pageDeleted is a page ComicInfo marks deleted; it is not uploaded.
+	pageDeleted = "deleted"
+)
+
+// PageKinds are the page kinds a chapter can take (see ParseImageChapter).
+var PageKinds = []string{PageCover, PageCredits, PageExtra}
+
+// classifyPage returns the kind of a page image from its ComicInfo type, if it has one,
+// or else from its name: a name saying credits or cover, or page p000, the front cover
+// of digital releases.
+func classifyPage(name string, numbered bool, number int, comicType string) string {
+	switch comicType {
+	case "FrontCover", "InnerCover", "BackCover":
+		return PageCover
+	case "Story":
+		return ""
+	case "Deleted":
+		return pageDeleted
+	case "Advertisement", "Editorial", "Letters", "Preview", "Roundup":
+		return PageExtra
+	}
+	base := strings.ToLower(path.Base(name))
+	switch {
+	case strings.Contains(base, "credit"):
+		return PageCredits
+	case comicType == "Other":
+		return PageExtra
+	case strings.Contains(base, "cover"), numbered && number == 0:
+		return PageCover
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const comicInfo = `<?xml version="1.0" encoding="utf-8"?>
+<ComicInfo xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <Title>The Black Swordsman</Title>
+  <Series>Berserk</Series>
+  <Number>012</Number>
+  <Volume>2</Volume>
+  <Writer>Kentaro Miura</Writer>
+  <Translator>Jason DeAngelis</Translator>
+  <Manga>No</Manga>
+  <Pages>
+    <Page Image="0" Type="FrontCover" />
+    <Page Image="1" DoublePage="True" />
+    <Page Image="2" Type="Deleted" />
+    <Page Image="3" Type="Advertisement" />
+    <Page Image="4" Type="Other" />
+  </Pages>
+</ComicInfo>`
+
+func TestOpenImageVolumeComicInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Berserk 012.cbz")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	archive := zip.NewWriter(file)
+	for name, data := range map[string][]byte{
+		"ComicInfo.xml":   []byte(comicInfo),
+		"a.png":           testPNG(t, 4, 6),
+		"p001.png":        testPNG(t, 4, 6),
+		"p002.png":        testPNG(t, 4, 6),
+		"p003.png":        testPNG(t, 4, 6),
+		"zz - thanks.png": testPNG(t, 4, 6),
+		"zz - p004.png":   testPNG(t, 4, 6),
+	} {
+		w, err := archive.Create(name)
+		require.NoError(t, err)
+		w.Write(data)
+	}
+	require.NoError(t, archive.Close())
+	require.NoError(t, file.Close())
+
+	volume, err := OpenImageVolume(path)
+	require.NoError(t, err)
+	require.NotNil(t, volume.Info)
+	assert.Equal(t, "The Black Swordsman", volume.Info.Title)
+	assert.Equal(t, "12", volume.Info.Chapter())
+	assert.Equal(t, LeftToRight, volume.Info.ReadingOrder())
+	assert.Equal(t, "Writer: Kentaro Miura, Translator: Jason DeAngelis", volume.Info.Credits())
+
+	// In name order the images are a.png, p001, p002, p003, "zz - p004", "zz - thanks".
+	assert.Equal(t, []string{"p002.png"}, volume.Deleted)
+	var pages []string
+	for _, page := range volume.Pages {
+		assert.Equal(t, "12", page.Chapter, "the chapter comes from ComicInfo.xml")
+		pages = append(pages, page.Label()+":"+page.Kind)
+	}
+	assert.Equal(t, []string{"p001:", "p003:extra", "p004:extra"}, pages)
+	assert.True(t, volume.Pages[0].DoublePage)
+	require.Len(t, volume.Extras, 1)
+	assert.Equal(t, "a.png", volume.Extras[0].Name)
+	assert.Equal(t, PageCover, volume.Extras[0].Kind)
+	assert.Equal(t, "p005", volume.Extras[0].Label())
+	assert.Equal(t, []string{"zz - thanks.png"}, volume.Unnumbered)
+
+	_, err = ParseComicInfo([]byte("<ComicInfo><Volume>two</Volume></ComicInfo>"))
+	assert.Error(t, err)
+}
+
+func TestClassifyPage(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		numbered  bool
+		number    int
+		comicType string
+		want      string
+	}{
+		{"Berserk - 001 (v01) - p000 [Digital].png", true, 0, "", PageCover},
+		{"Berserk v01 - Cover.jpg", false, 0, "", PageCover},
+		{"Berserk v01 - credits.png", false, 0, "", PageCredits},
+		{"Berserk v01 - credits.png", false, 0, "Other", PageCredits},
+		{"Berserk - 001 (v01) - p001 [Digital].png", true, 1, "", ""},
+		{"Berserk - 001 (v01) - p000 [Digital].png", true, 0, "Story", ""},
+		{"p050.png", true, 50, "BackCover", PageCover},
+		{"p051.png", true, 51, "Letters", PageExtra},
+		{"p052.png", true, 52, "Other", PageExtra},
+		{"p053.png", true, 53, "Deleted", pageDeleted},
+	} {
+		assert.Equal(t, c.want, classifyPage(c.name, c.numbered, c.number, c.comicType), c.name+" "+c.comicType)
+	}
+}
@@ -0,0 +1,94 @@
+package pipeline
+
+import "fmt"
+
+// Flow rejects transactions larger than this, arguments included.
+const MaxTransactionBytes = 1_500_000
+
+// Rough storage layout costs used by the estimator. Stored strings carry an
+// encoding header, and every Chapter struct carries its titles, index and
+// extra dictionary plus the dictionary slots that hold it in the Book.
+const (
+	storageBytesPerString  = 9
+	storageBytesPerChapter = 240
+	storageBytesPerBook    = 600
+)
+
+// Estimated fee per transaction in FLOW. Upload transactions are cheap to
+// execute; this errs on the high side so the estimate is an upper bound.
+const EstimatedFeePerTx = 0.0001
+
+// CostEstimate is what a set of transactions is expected to cost the signer.
+type CostEstimate struct {
+	Transactions int
+	// Fees is the upper bound of the transaction fees, in FLOW.
+	Fees float64
+	// StorageBytes is the account storage the transactions add, and Reservation the
+	// FLOW the signer must then hold for its storage; both are 0 when not estimated.
+	StorageBytes int
+	Reservation  float64
+}
+
+// FeeEstimate is the estimate of transactions whose storage is not estimated.
+func FeeEstimate(transactions int) CostEstimate {
+	return CostEstimate{Transactions: transactions, Fees: float64(transactions) * EstimatedFeePerTx}
+}
+
+// String describes the estimate for a confirmation prompt.
+func (c CostEstimate) String() string {
+	s := fmt.Sprintf("estimated fees up to %.4f FLOW", c.Fees)
+	if c.StorageBytes > 0 {
+		s += fmt.Sprintf(", %d bytes of storage needing a %.8f FLOW reservation", c.StorageBytes, c.Reservation)
+	}
+	return s
+}
+
+// ChapterStorageBytes estimates the account storage a chapter will take
+// once saved in its Book, from the paragraphs exactly as they are sent.
+func ChapterStorageBytes(bookTitle, chapterTitle string, paragraphs []string) int {
+	total := storageBytesPerChapter + len(bookTitle) + 3*len(chapterTitle)
+	for _, p := range paragraphs {
+		total += len(p) + storageBytesPerString
+	}
+	return total
+}
+
+// ParagraphStorageBytes estimates the account storage a paragraph appended to a
+// chapter takes.
+func ParagraphStorageBytes(paragraph string) int {
+	return len(paragraph) + storageBytesPerString
+}
+
+// BookStorageBytes estimates the account storage an empty Book resource
+// takes, including its entries in the library's title, author and genre indexes.
+func BookStorageBytes(title, author, genre, edition, summary string) int {
+	return storageBytesPerBook + 4*len(title) + 2*len(author) + len(genre) + len(edition) + len(summary)
+}
+
+// StorageInfo mirrors the struct returned by the get_storage_info script.
+type StorageInfo struct {
+	Address          string  `json:"address"`
+	Used             uint64  `json:"used"`
+	Capacity         uint64  `json:"capacity"`
+	Balance          float64 `json:"balance"`
+	AvailableBalance float64 `json:"availableBalance"`
+	// ReservationRequired is the FLOW the account must hold for storage
+	// once the additional bytes are saved.
+	ReservationRequired float64 `json:"reservationRequired"`
+	// ReservationCurrent is the FLOW that backs the current capacity.
+	ReservationCurrent float64 `json:"reservationCurrent"`
+}
+
+// Fits reports whether additional bytes fit in the account's current capacity.
+func (s StorageInfo) Fits(additional uint64) bool {
+	return s.Used+additional <= s.Capacity
+}
+
+// Shortfall returns the FLOW that must be deposited before the additional
+// bytes fit, or 0 if they already do.
+func (s StorageInfo) Shortfall() float64 {
+	if s.ReservationRequired <= s.ReservationCurrent {
+		return 0
+	}
+	return s.ReservationRequired - s.ReservationCurrent
+}
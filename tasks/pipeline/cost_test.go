@@ -0,0 +1,26 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageInfoFits(t *testing.T) {
+	info := StorageInfo{Used: 900, Capacity: 1000, ReservationRequired: 0.002, ReservationCurrent: 0.001}
+	assert.True(t, info.Fits(100))
+	assert.False(t, info.Fits(101))
+	assert.InDelta(t, 0.001, info.Shortfall(), 1e-12)
+
+	info.ReservationRequired = 0.001
+	assert.Equal(t, 0.0, info.Shortfall())
+}
+
+func TestCostEstimate(t *testing.T) {
+	fees := FeeEstimate(12)
+	assert.InDelta(t, 0.0012, fees.Fees, 1e-12)
+	assert.Equal(t, "estimated fees up to 0.0012 FLOW", fees.String())
+
+	fees.StorageBytes, fees.Reservation = 250_000, 0.025
+	assert.Equal(t, "estimated fees up to 0.0012 FLOW, 250000 bytes of storage needing a 0.02500000 FLOW reservation", fees.String())
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+// Paragraph diff operations
+const (
+	DiffEqual  = "="
+	DiffDelete = "-"
+	DiffInsert = "+"
+)
+
+// ParagraphEdit is one step of a paragraph-level diff. OldIndex and NewIndex are the
+// paragraph's position in the old and new chapter, or -1 where it has none.
+type ParagraphEdit struct {
+	Op       string
+	OldIndex int
+	NewIndex int
+	Text     string
+}
+
+// DiffParagraphs returns the edits that turn old into new, paragraph by paragraph, as
+// a longest-common-subsequence diff. The common head and tail are matched first, so a
+// revision of a few paragraphs in a long chapter stays cheap.
+func DiffParagraphs(old, new []string) []ParagraphEdit {
+	head := 0
+	for head < len(old) && head < len(new) && old[head] == new[head] {
+		head++
+	}
+	tail := 0
+	for tail < len(old)-head && tail < len(new)-head && old[len(old)-1-tail] == new[len(new)-1-tail] {
+		tail++
+	}
+
+	var edits []ParagraphEdit
+	for i := 0; i < head; i++ {
+		edits = append(edits, ParagraphEdit{DiffEqual, i, i, old[i]})
+	}
+
+	a, b := old[head:len(old)-tail], new[head:len(new)-tail]
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, ParagraphEdit{DiffEqual, head + i, head + j, a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			// deletions come before insertions, so a revised paragraph reads old then new
+			edits = append(edits, ParagraphEdit{DiffDelete, head + i, -1, a[i]})
+			i++
+		default:
+			edits = append(edits, ParagraphEdit{DiffInsert, -1, head + j, b[j]})
+			j++
+		}
+	}
+
+	for k := tail; k > 0; k-- {
+		edits = append(edits, ParagraphEdit{DiffEqual, len(old) - k, len(new) - k, old[len(old)-k]})
+	}
+	return edits
+}
+
+// DiffStats counts the unchanged, deleted and inserted paragraphs in edits.
+func DiffStats(edits []ParagraphEdit) (equal, deleted, inserted int) {
+	for _, edit := range edits {
+		switch edit.Op {
+		case DiffEqual:
+			equal++
+		case DiffDelete:
+			deleted++
+		case DiffInsert:
+			inserted++
+		}
+	}
+	return equal, deleted, inserted
+}
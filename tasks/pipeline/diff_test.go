@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// apply rebuilds both sides of a diff, so every edit list can be checked against its inputs.
+func apply(edits []ParagraphEdit) (old, new []string) {
+	for _, edit := range edits {
+		if edit.Op != DiffInsert {
+			old = append(old, edit.Text)
+		}
+		if edit.Op != DiffDelete {
+			new = append(new, edit.Text)
+		}
+	}
+	return old, new
+}
+
+func TestDiffParagraphs(t *testing.T) {
+	old := []string{"Chapter I", "Call me Ishmael.", "Some years ago.", "Never mind how long."}
+	new := []string{"Chapter I", "Call me Ishmael!", "Some years ago.", "Never mind how long.", "The end."}
+
+	edits := DiffParagraphs(old, new)
+	gotOld, gotNew := apply(edits)
+	assert.Equal(t, old, gotOld)
+	assert.Equal(t, new, gotNew)
+
+	equal, deleted, inserted := DiffStats(edits)
+	assert.Equal(t, 3, equal)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, 2, inserted)
+	assert.Equal(t, ParagraphEdit{DiffDelete, 1, -1, "Call me Ishmael."}, edits[1])
+	assert.Equal(t, ParagraphEdit{DiffInsert, -1, 4, "The end."}, edits[len(edits)-1])
+}
+
+func TestDiffParagraphsEdges(t *testing.T) {
+	same := []string{"a", "b"}
+	_, deleted, inserted := DiffStats(DiffParagraphs(same, same))
+	assert.Zero(t, deleted+inserted)
+
+	edits := DiffParagraphs(nil, same)
+	assert.Len(t, edits, 2)
+	assert.Equal(t, DiffInsert, edits[0].Op)
+
+	edits = DiffParagraphs(same, nil)
+	assert.Len(t, edits, 2)
+	assert.Equal(t, DiffDelete, edits[1].Op)
+
+	old := []string{"a", "x", "b", "y", "c"}
+	new := []string{"a", "b", "z", "c"}
+	gotOld, gotNew := apply(DiffParagraphs(old, new))
+	assert.Equal(t, old, gotOld)
+	assert.Equal(t, new, gotNew)
+}
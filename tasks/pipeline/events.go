@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EmittedEvent is an event from a sealed transaction: its type ID, with or without the
+// address prefix (A.fed1adffd14ea9d0.Alexandria.ChapterAdded), and its payload.
+type EmittedEvent struct {
+	Name   string
+	Fields map[string]interface{}
+}
+
+// ExpectedEvent is the Alexandria event a transaction must emit, and the payload
+// fields it must carry.
+type ExpectedEvent struct {
+	Name   string
+	Fields map[string]string
+}
+
+// actionEvents maps each transaction to the Alexandria event that confirms it.
+var actionEvents = map[string]string{
+	"Admin/add_book":                 "BookAdded",
+	"Admin/add_chapter_name":         "ChapterNameAdded",
+	"Admin/add_chapter":              "ChapterAdded",
+	"Admin/add_paragraph_to_chapter": "ParagraphAdded",
+	"Admin/remove_last_paragraph":    "ParagraphRemoved",
+	"Admin/remove_chapter":           "ChapterRemoved",
+	"Admin/submit_chapter":           "ChapterSubmitted",
+	"Admin/approve_chapter":          "ChapterApproved",
+	"Admin/reject_chapter":           "ChapterRejected",
+	"account/add_keeper":             "KeeperAssigned",
+	"Admin/set_book_metadata":        "BookMetadataSet",
+	"Admin/set_chapter_metadata":     "ChapterMetadataSet",
+}
+
+// ExpectEvent returns the event that confirms action for the book and chapter, and
+// false for transactions that emit none (Admin/add_genre). Book-level events carry
+// no chapter title; callers add fields such as the keeper address themselves.
+func ExpectEvent(action, book, chapter string) (ExpectedEvent, bool) {
+	name, ok := actionEvents[action]
+	if !ok {
+		return ExpectedEvent{}, false
+	}
+	switch action {
+	case "Admin/add_book":
+		return ExpectedEvent{Name: name, Fields: map[string]string{"title": book}}, true
+	case "account/add_keeper", "Admin/set_book_metadata":
+		return ExpectedEvent{Name: name, Fields: map[string]string{"bookTitle": book}}, true
+	}
+	return ExpectedEvent{Name: name, Fields: map[string]string{"bookTitle": book, "chapterTitle": chapter}}, true
+}
+
+// String describes the event as Alexandria.Name(field: value, ...).
+func (e ExpectedEvent) String() string {
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		fields[i] = fmt.Sprintf("%s: %q", key, e.Fields[key])
+	}
+	return fmt.Sprintf("Alexandria.%s(%s)", e.Name, strings.Join(fields, ", "))
+}
+
+// Confirm returns nil if events include the expected event with a matching payload,
+// and otherwise an error that says what was emitted instead.
+func (e ExpectedEvent) Confirm(events []EmittedEvent) error {
+	var mismatched, names []string
+	for _, event := range events {
+		names = append(names, event.Name)
+		if !strings.HasSuffix("."+event.Name, ".Alexandria."+e.Name) {
+			continue
+		}
+		matches := true
+		for key, want := range e.Fields {
+			if got, ok := event.Fields[key]; !ok || fmt.Sprint(got) != want {
+				matches = false
+				mismatched = append(mismatched, fmt.Sprintf("%s=%q", key, fmt.Sprint(got)))
+			}
+		}
+		if matches {
+			return nil
+		}
+	}
+	if len(mismatched) > 0 {
+		return fmt.Errorf("expected event %s, but it was emitted with %s", e, strings.Join(mismatched, ", "))
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("expected event %s was not emitted; the transaction emitted no events", e)
+	}
+	return fmt.Errorf("expected event %s was not emitted; got %s", e, strings.Join(names, ", "))
+}
@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectEvent(t *testing.T) {
+	expected, ok := ExpectEvent("Admin/add_chapter", "Ecce Homo", "Chapter 1")
+	require.True(t, ok)
+	assert.Equal(t, `Alexandria.ChapterAdded(bookTitle: "Ecce Homo", chapterTitle: "Chapter 1")`, expected.String())
+
+	expected, ok = ExpectEvent("Admin/add_book", "Ecce Homo", "")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"title": "Ecce Homo"}, expected.Fields)
+
+	expected, ok = ExpectEvent("account/add_keeper", "Ecce Homo", "")
+	require.True(t, ok)
+	assert.Equal(t, `Alexandria.KeeperAssigned(bookTitle: "Ecce Homo")`, expected.String())
+
+	_, ok = ExpectEvent("Admin/add_genre", "Ecce Homo", "")
+	assert.False(t, ok)
+}
+
+func TestConfirmEvent(t *testing.T) {
+	expected, _ := ExpectEvent("Admin/add_chapter", "Ecce Homo", "Chapter 1")
+	fees := EmittedEvent{Name: "A.f919ee77447b7497.FlowFees.FeesDeducted", Fields: map[string]interface{}{"amount": 0.00001}}
+	added := func(chapter string) EmittedEvent {
+		return EmittedEvent{
+			Name:   "A.fed1adffd14ea9d0.Alexandria.ChapterAdded",
+			Fields: map[string]interface{}{"bookTitle": "Ecce Homo", "chapterTitle": chapter},
+		}
+	}
+
+	assert.NoError(t, expected.Confirm([]EmittedEvent{fees, added("Chapter 1")}))
+	assert.NoError(t, expected.Confirm([]EmittedEvent{{Name: "Alexandria.ChapterAdded", Fields: added("Chapter 1").Fields}}))
+	assert.ErrorContains(t, expected.Confirm([]EmittedEvent{added("Chapter 2")}), `chapterTitle="Chapter 2"`)
+	assert.ErrorContains(t, expected.Confirm([]EmittedEvent{fees}), "got A.f919ee77447b7497.FlowFees.FeesDeducted")
+	assert.ErrorContains(t, expected.Confirm(nil), "emitted no events")
+}
@@ -0,0 +1,233 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Default key algorithms of a flow.json account that does not name them.
+const (
+	DefaultSigAlgo  = "ECDSA_P256"
+	DefaultHashAlgo = "SHA3_256"
+)
+
+// FlowAccount is an account in flow.json and where its private key is kept.
+type FlowAccount struct {
+	Key AccountKey
+	// KeyType is "hex" for a key written in flow.json, "file" for a key file, "env" for
+	// a $VARIABLE reference, or another flowkit type such as "google-kms".
+	KeyType string
+	// Location is a file key's path, relative to flow.json's directory.
+	Location string
+	// PrivateKey is a hex key written in flow.json.
+	PrivateKey string
+}
+
+type flowConfigAccount struct {
+	Address string          `json:"address"`
+	Key     json.RawMessage `json:"key"`
+}
+
+type flowConfigKey struct {
+	Type       string `json:"type"`
+	Index      int    `json:"index"`
+	SigAlgo    string `json:"signatureAlgorithm"`
+	HashAlgo   string `json:"hashAlgorithm"`
+	PrivateKey string `json:"privateKey"`
+	Location   string `json:"location"`
+}
+
+// LoadFlowAccounts reads the accounts of the flow.json at path, sorted by name.
+func LoadFlowAccounts(path string) ([]FlowAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Accounts map[string]flowConfigAccount `json:"accounts"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var accounts []FlowAccount
+	for name, a := range config.Accounts {
+		account := FlowAccount{Key: AccountKey{
+			Account:  name,
+			Address:  a.Address,
+			SigAlgo:  DefaultSigAlgo,
+			HashAlgo: DefaultHashAlgo,
+		}}
+		var simple string
+		if err := json.Unmarshal(a.Key, &simple); err == nil {
+			account.KeyType, account.PrivateKey = "hex", simple
+		} else {
+			var key flowConfigKey
+			if err := json.Unmarshal(a.Key, &key); err != nil {
+				return nil, fmt.Errorf("%s: account %s: %w", path, name, err)
+			}
+			account.KeyType, account.Location, account.PrivateKey = key.Type, key.Location, key.PrivateKey
+			account.Key.Index = key.Index
+			if key.SigAlgo != "" {
+				account.Key.SigAlgo = key.SigAlgo
+			}
+			if key.HashAlgo != "" {
+				account.Key.HashAlgo = key.HashAlgo
+			}
+		}
+		if account.KeyType == "hex" && strings.HasPrefix(account.PrivateKey, "$") {
+			account.KeyType, account.PrivateKey = "env", ""
+		}
+		if address, err := ParseAddress(account.Key.Address); err == nil {
+			account.Key.Address = address
+		}
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Key.Account < accounts[j].Key.Account })
+	return accounts, nil
+}
+
+// NetworkAccounts returns the accounts flowkit uses on network: those named
+// "<network>-<name>".
+func NetworkAccounts(accounts []FlowAccount, network string) []FlowAccount {
+	var matched []FlowAccount
+	for _, account := range accounts {
+		if strings.HasPrefix(account.Key.Account, network+"-") {
+			matched = append(matched, account)
+		}
+	}
+	return matched
+}
+
+// AccountAddress returns the address of account on network: account itself when it is
+// a hex address, else the address of the flow.json account "<network>-<account>".
+func AccountAddress(accounts []FlowAccount, network, account string) (string, error) {
+	if address, err := ParseAddress(account); err == nil {
+		return address, nil
+	}
+	for _, a := range NetworkAccounts(accounts, network) {
+		if a.Key.Account == network+"-"+account {
+			return ParseAddress(a.Key.Address)
+		}
+	}
+	return "", fmt.Errorf("%q is neither an address nor a flow.json account on %s", account, network)
+}
+
+// FlowContractAddress returns where the flow.json at path puts contract on network: its
+// alias for the network, else the address of the account the network deploys it to.
+func FlowContractAddress(path, contract, network string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var config struct {
+		Contracts map[string]struct {
+			Aliases map[string]string `json:"aliases"`
+		} `json:"contracts"`
+		Accounts    map[string]flowConfigAccount            `json:"accounts"`
+		Deployments map[string]map[string][]json.RawMessage `json:"deployments"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	if alias, ok := config.Contracts[contract].Aliases[network]; ok {
+		return ParseAddress(alias)
+	}
+	for account, deployed := range config.Deployments[network] {
+		for _, raw := range deployed {
+			// A deployment is the contract name, or an object naming it with its arguments.
+			var name string
+			if json.Unmarshal(raw, &name) != nil {
+				var withArgs struct {
+					Name string `json:"name"`
+				}
+				json.Unmarshal(raw, &withArgs)
+				name = withArgs.Name
+			}
+			if name == contract {
+				return ParseAddress(config.Accounts[account].Address)
+			}
+		}
+	}
+	return "", fmt.Errorf("%s has no %s alias or deployment for %s", path, contract, network)
+}
+
+// PlaintextKey is an unencrypted private key that every user on the machine can read.
+type PlaintextKey struct {
+	Account string
+	Path    string
+}
+
+// FindPlaintextKeys returns the keys among accounts that are stored unencrypted and
+// world-readable: key files with the "other" read bit set, and keys written into a
+// world-readable flow.json at flowPath. Key files that do not exist are not reported;
+// keys moved to the keystore leave none behind. Always empty on Windows, where file
+// modes do not describe who can read a file.
+func FindPlaintextKeys(flowPath string, accounts []FlowAccount) ([]PlaintextKey, error) {
+	if runtime.GOOS == "windows" {
+		return nil, nil
+	}
+	var found []PlaintextKey
+	for _, account := range accounts {
+		var path string
+		switch account.KeyType {
+		case "file":
+			path = account.Location
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(flowPath), path)
+			}
+		case "hex":
+			path = flowPath
+		default:
+			continue
+		}
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().Perm()&0o004 != 0 {
+			found = append(found, PlaintextKey{Account: account.Key.Account, Path: path})
+		}
+	}
+	return found, nil
+}
+
+// KeyEnv is the environment variable a keystore account's decrypted key is handed to
+// flowkit in, e.g. ALEXANDRIA_KEY_MAINNET_PRIME_LIBRARIAN for mainnet-Prime-librarian.
+func KeyEnv(account string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, account)
+	return "ALEXANDRIA_KEY_" + strings.ToUpper(name)
+}
+
+// KeystoreFlowConfig is a flow.json that only holds accounts whose keys are read from
+// their KeyEnv variable, to be merged over the main flow.json so flowkit signs with
+// keys from the keystore. It holds no key: flowkit fills in "$VARIABLE" from the
+// environment of the process loading it.
+func KeystoreFlowConfig(keys map[string]AccountKey) ([]byte, error) {
+	accounts := map[string]interface{}{}
+	for name, key := range keys {
+		accounts[name] = map[string]interface{}{
+			"address": strings.TrimPrefix(key.Address, "0x"),
+			"key": map[string]interface{}{
+				"type":               "hex",
+				"index":              key.Index,
+				"signatureAlgorithm": key.SigAlgo,
+				"hashAlgorithm":      key.HashAlgo,
+				"privateKey":         "$" + KeyEnv(name),
+			},
+		}
+	}
+	return json.MarshalIndent(map[string]interface{}{"accounts": accounts}, "", "\t")
+}
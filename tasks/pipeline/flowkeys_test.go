@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFlowJSON = `{
+	"accounts": {
+		"emulator-alice": {"address": "179b6b1cb6755e31", "key": "7d83b4ce78fe1366e9a3"},
+		"mainnet-Librarian": {"address": "6d96bf7d95a8b595", "key": {"type": "file", "location": "librarian.pkey"}},
+		"mainnet-Prime-librarian": {"address": "fed1adffd14ea9d0", "key": {"type": "file", "location": "Prime-librarian.pkey"}},
+		"testnet-Prime-librarian": {"address": "0x0ae53cb6e3f42a79", "key": "$TESTNET_KEY"},
+		"mainnet-Kms": {"address": "fed1adffd14ea9d0", "key": {"type": "google-kms", "index": 1, "hashAlgorithm": "SHA2_256", "resourceID": "projects/x"}}
+	},
+	"contracts": {
+		"Alexandria": {"source": "./contracts/Alexandria.cdc", "aliases": {"mainnet": "fed1adffd14ea9d0"}},
+		"Librarian": {"source": "./contracts/Librarian.cdc"}
+	},
+	"deployments": {
+		"testnet": {"testnet-Prime-librarian": [{"name": "Librarian", "args": []}, "Alexandria"]}
+	}
+}`
+
+func TestLoadFlowAccounts(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "flow.json")
+	require.NoError(t, os.WriteFile(path, []byte(testFlowJSON), 0o644))
+
+	accounts, err := LoadFlowAccounts(path)
+	require.NoError(t, err)
+	require.Len(t, accounts, 5)
+	assert.Equal(t, "emulator-alice", accounts[0].Key.Account)
+	assert.Equal(t, "hex", accounts[0].KeyType)
+	assert.Equal(t, AccountKey{Account: "mainnet-Kms", Address: "0xfed1adffd14ea9d0", Index: 1, SigAlgo: DefaultSigAlgo, HashAlgo: "SHA2_256"}, accounts[1].Key)
+	assert.Equal(t, "google-kms", accounts[1].KeyType)
+	assert.Equal(t, "librarian.pkey", accounts[2].Location)
+	assert.Equal(t, "env", accounts[4].KeyType)
+	assert.Empty(t, accounts[4].PrivateKey)
+
+	mainnet := NetworkAccounts(accounts, "mainnet")
+	assert.Len(t, mainnet, 3)
+
+	address, err := AccountAddress(accounts, "mainnet", "Librarian")
+	require.NoError(t, err)
+	assert.Equal(t, "0x6d96bf7d95a8b595", address)
+	address, err = AccountAddress(accounts, "mainnet", "6d96bf7d95a8b595")
+	require.NoError(t, err)
+	assert.Equal(t, "0x6d96bf7d95a8b595", address, "an address is used as is")
+	_, err = AccountAddress(accounts, "emulator", "Librarian")
+	assert.ErrorContains(t, err, "neither an address nor a flow.json account on emulator")
+}
+
+func TestFlowContractAddress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flow.json")
+	require.NoError(t, os.WriteFile(path, []byte(testFlowJSON), 0o644))
+
+	address, err := FlowContractAddress(path, "Alexandria", "mainnet")
+	require.NoError(t, err)
+	assert.Equal(t, "0xfed1adffd14ea9d0", address, "alias")
+	address, err = FlowContractAddress(path, "Alexandria", "testnet")
+	require.NoError(t, err)
+	assert.Equal(t, "0x0ae53cb6e3f42a79", address, "deployment account")
+	address, err = FlowContractAddress(path, "Librarian", "testnet")
+	require.NoError(t, err)
+	assert.Equal(t, "0x0ae53cb6e3f42a79", address, "deployment with arguments")
+	_, err = FlowContractAddress(path, "Alexandria", "emulator")
+	assert.ErrorContains(t, err, "no Alexandria alias or deployment for emulator")
+}
+
+func TestFindPlaintextKeys(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes do not describe readers on Windows")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "flow.json")
+	require.NoError(t, os.WriteFile(path, []byte(testFlowJSON), 0o644))
+	require.NoError(t, os.Chmod(path, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "librarian.pkey"), []byte("abcd"), 0o600))
+	require.NoError(t, os.Chmod(filepath.Join(dir, "librarian.pkey"), 0o664))
+	accounts, err := LoadFlowAccounts(path)
+	require.NoError(t, err)
+
+	found, err := FindPlaintextKeys(path, accounts)
+	require.NoError(t, err)
+	assert.Equal(t, []PlaintextKey{
+		{Account: "emulator-alice", Path: path},
+		{Account: "mainnet-Librarian", Path: filepath.Join(dir, "librarian.pkey")},
+	}, found)
+
+	require.NoError(t, os.Chmod(filepath.Join(dir, "librarian.pkey"), 0o600))
+	found, err = FindPlaintextKeys(path, NetworkAccounts(accounts, "mainnet"))
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestKeystoreFlowConfig(t *testing.T) {
+	assert.Equal(t, "ALEXANDRIA_KEY_MAINNET_PRIME_LIBRARIAN", KeyEnv("mainnet-Prime-librarian"))
+
+	config, err := KeystoreFlowConfig(map[string]AccountKey{"mainnet-Librarian": librarianKey})
+	require.NoError(t, err)
+	assert.Contains(t, string(config), `"privateKey": "$ALEXANDRIA_KEY_MAINNET_LIBRARIAN"`)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "flow.keystore.json")
+	require.NoError(t, os.WriteFile(path, config, 0o600))
+	accounts, err := LoadFlowAccounts(path)
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, librarianKey, accounts[0].Key)
+	assert.Equal(t, "env", accounts[0].KeyType, "the file holds no key")
+	assert.Empty(t, accounts[0].PrivateKey)
+}
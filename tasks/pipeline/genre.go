@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"sort"
+	"strings"
+)
+
+// GenreMatch is the result of matching a requested genre against the genres on-chain.
+type GenreMatch struct {
+	// Exact is true when the requested genre exists exactly as written.
+	Exact bool
+	// Suggestions are the closest existing genres, best first.
+	Suggestions []string
+}
+
+// MatchGenre looks the requested genre up in the existing genres. Genres are
+// dictionary keys on-chain, so anything but an exact match creates a new
+// bucket; near misses (case, spacing, typos) are returned as suggestions.
+func MatchGenre(requested string, genres []string) GenreMatch {
+	type candidate struct {
+		genre    string
+		distance int
+	}
+	want := normalizeGenre(requested)
+	var candidates []candidate
+	for _, genre := range genres {
+		if genre == requested {
+			return GenreMatch{Exact: true}
+		}
+		have := normalizeGenre(genre)
+		distance := levenshtein(want, have)
+		limit := len(want) / 3
+		if limit < 2 {
+			limit = 2
+		}
+		if distance <= limit || strings.Contains(have, want) || strings.Contains(want, have) {
+			candidates = append(candidates, candidate{genre, distance})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].genre < candidates[j].genre
+	})
+	match := GenreMatch{}
+	for _, c := range candidates {
+		match.Suggestions = append(match.Suggestions, c.genre)
+	}
+	return match
+}
+
+func normalizeGenre(genre string) string {
+	return strings.Join(strings.Fields(strings.ToLower(genre)), " ")
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
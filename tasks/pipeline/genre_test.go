@@ -0,0 +1,30 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The genres seeded by the Alexandria contract
+var seededGenres = []string{
+	"Adventure", "Biography", "Realism", "Dystopian", "Fantasy", "Horror", "Mistery", "History", "Romance",
+	"Thriller", "Fiction", "Science Fiction", "Western", "Philosophy", "Psychology", "Literature", "Feminist Literature",
+}
+
+func TestMatchGenre(t *testing.T) {
+	assert.True(t, MatchGenre("Philosophy", seededGenres).Exact)
+
+	lower := MatchGenre("philosophy", seededGenres)
+	assert.False(t, lower.Exact)
+	assert.Equal(t, []string{"Philosophy"}, lower.Suggestions)
+
+	mystery := MatchGenre("Mystery", seededGenres)
+	assert.False(t, mystery.Exact)
+	assert.Equal(t, "Mistery", mystery.Suggestions[0])
+
+	typo := MatchGenre("Sciense  Fiction", seededGenres)
+	assert.Equal(t, "Science Fiction", typo.Suggestions[0])
+
+	assert.Empty(t, MatchGenre("Cookbooks", seededGenres).Suggestions)
+}
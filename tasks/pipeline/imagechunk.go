@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+)
+
+// ImageChunk is one paragraph of an image too large for a single paragraph, in the
+// paragraph envelope (see Paragraph). Its header line is
+//
+//	ALEXANDRIA-IMAGE-CHUNK/1 <image ID> <index>/<count> <MIME type> <SHA-256> <alt text>
+//
+// then, after a newline, the base64 of its part of the image. Index counts from 1, and
+// the SHA-256 is the hex hash of the whole image, which the reader checks once the
+// chunks are joined.
+type ImageChunk struct {
+	ImageID      string
+	Index, Count int
+	MIME         string
+	SHA256       string
+	Alt          string
+	Data         []byte
+}
+
+// Paragraph writes the chunk as it is stored on-chain.
+func (c ImageChunk) Paragraph() string {
+	return imageHeader("IMAGE-CHUNK", c.Alt, c.ImageID, fmt.Sprintf("%d/%d", c.Index, c.Count), c.MIME, c.SHA256) + "\n" +
+		base64.StdEncoding.EncodeToString(c.Data)
+}
+
+// ChunkImage splits an image into chunk paragraphs of at most size bytes each, header
+// included. The image ID names the image within its chapter, e.g. its page label; it
+// cannot contain spaces.
+func ChunkImage(imageID, mime, alt string, data []byte, size int) ([]string, error) {
+	if err := checkImageID(imageID); err != nil {
+		return nil, err
+	}
+	header := ImageChunk{ImageID: imageID, Index: len(data), Count: len(data), MIME: mime, SHA256: HashImage(data), Alt: alt}
+	// The longest header is the one with the most digits, which len(data) bounds.
+	room := size - len(header.Paragraph())
+	perChunk := room / 4 * 3
+	if perChunk <= 0 {
+		return nil, fmt.Errorf("%d bytes is too small for an image chunk", size)
+	}
+	count := max(1, (len(data)+perChunk-1)/perChunk)
+	paragraphs := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := header
+		chunk.Index, chunk.Count = i+1, count
+		chunk.Data = data[i*perChunk : min(len(data), (i+1)*perChunk)]
+		paragraphs = append(paragraphs, chunk.Paragraph())
+	}
+	return paragraphs, nil
+}
+
+// ChapterImage is an image read back from a chapter's paragraphs.
+type ChapterImage struct {
+	// ImageID and Alt are empty for a legacy image (see Paragraph.Legacy).
+	ImageID string
+	MIME    string
+	Alt     string
+	Data    []byte
+	// Paragraph is the position, from 0, of the image's first paragraph; Paragraphs
+	// how many it takes.
+	Paragraph, Paragraphs int
+}
+
+// Hash is the image's content hash (see HashImage).
+func (c ChapterImage) Hash() string {
+	return HashImage(c.Data)
+}
+
+// HashImage returns the hex SHA-256 of an image's bytes as encoded for upload: the
+// hash image chunks carry, and upload ledgers record for each page.
+func HashImage(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// PartialImage is a chunked image a chapter stops in the middle of, as an interrupted
+// upload leaves it.
+type PartialImage struct {
+	ImageID string
+	// SHA256 is the hash of the whole image, from its chunks' header.
+	SHA256 string
+	// Chunks of its Count chunks are stored, from Paragraph on.
+	Chunks, Count int
+	Paragraph     int
+}
+
+// ReadChapterImages rebuilds the images of a chapter from its paragraphs, in order: a
+// paragraph holding a whole image, or the consecutive chunk paragraphs of one image,
+// which are joined and checked against their SHA-256. Text paragraphs are skipped. A
+// chunk out of order, missing or from another image, or an image whose bytes do not
+// match its hash, is an error.
+func ReadChapterImages(paragraphs []string) ([]ChapterImage, error) {
+	images, partial, err := ScanChapterImages(paragraphs)
+	if err == nil && partial != nil {
+		err = fmt.Errorf("image %s stops after chunk %d of %d", partial.ImageID, partial.Chunks, partial.Count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// ScanChapterImages reads a chapter's images like ReadChapterImages, but the chapter
+// may end in the middle of a chunked image, which it returns as partial.
+func ScanChapterImages(paragraphs []string) (images []ChapterImage, partial *PartialImage, err error) {
+	var pending *ChapterImage
+	var first ImageChunk
+	for i, paragraph := range paragraphs {
+		p, err := ParseParagraph(paragraph)
+		if err != nil {
+			return nil, nil, fmt.Errorf("paragraph %d: %w", i, err)
+		}
+		if p.Kind != ParagraphImageChunk {
+			if pending != nil {
+				return nil, nil, fmt.Errorf("paragraph %d: image %s stops after chunk %d of %d", i, first.ImageID, pending.Paragraphs, first.Count)
+			}
+			if p.Kind == ParagraphImage {
+				images = append(images, ChapterImage{ImageID: p.ImageID, MIME: p.MIME, Alt: p.Alt, Data: p.Data, Paragraph: i, Paragraphs: 1})
+			}
+			continue
+		}
+		chunk := *p.Chunk
+		if pending == nil {
+			if chunk.Index != 1 {
+				return nil, nil, fmt.Errorf("paragraph %d: image %s starts at chunk %d of %d", i, chunk.ImageID, chunk.Index, chunk.Count)
+			}
+			first = chunk
+			pending = &ChapterImage{ImageID: chunk.ImageID, MIME: chunk.MIME, Alt: chunk.Alt, Paragraph: i}
+		} else if chunk.ImageID != first.ImageID || chunk.SHA256 != first.SHA256 || chunk.Count != first.Count || chunk.Index != pending.Paragraphs+1 {
+			return nil, nil, fmt.Errorf("paragraph %d: expected chunk %d of %d of image %s, found chunk %d of %d of image %s",
+				i, pending.Paragraphs+1, first.Count, first.ImageID, chunk.Index, chunk.Count, chunk.ImageID)
+		}
+		pending.Data = append(pending.Data, chunk.Data...)
+		pending.Paragraphs++
+		if pending.Paragraphs < first.Count {
+			continue
+		}
+		if HashImage(pending.Data) != first.SHA256 {
+			return nil, nil, fmt.Errorf("image %s at paragraph %d: its chunks do not match their SHA-256", first.ImageID, pending.Paragraph)
+		}
+		images = append(images, *pending)
+		pending = nil
+	}
+	if pending != nil {
+		partial = &PartialImage{ImageID: first.ImageID, SHA256: first.SHA256, Chunks: pending.Paragraphs, Count: first.Count, Paragraph: pending.Paragraph}
+	}
+	return images, partial, nil
+}
+
+// StoredImages indexes the images a chapter holds on-chain by content hash, to find the
+// pages of an upload that are already stored.
+type StoredImages struct {
+	// ids are, for each hash, the IDs of the images not taken yet; "" for a legacy image.
+	ids map[string][]string
+	// Partial is the chunked image the chapter stops in the middle of, if any.
+	Partial *PartialImage
+}
+
+// NewStoredImages reads a chapter's paragraphs with ScanChapterImages.
+func NewStoredImages(paragraphs []string) (*StoredImages, error) {
+	images, partial, err := ScanChapterImages(paragraphs)
+	if err != nil {
+		return nil, err
+	}
+	stored := &StoredImages{ids: map[string][]string{}, Partial: partial}
+	for _, image := range images {
+		stored.ids[image.Hash()] = append(stored.ids[image.Hash()], image.ImageID)
+	}
+	return stored, nil
+}
+
+// Take reports whether the chapter holds an image with the hash and ID, or a legacy
+// image with the hash, not taken yet, and takes it: pages with the same bytes, like
+// blank pages, each need an image of their own.
+func (s *StoredImages) Take(imageID, hash string) bool {
+	ids := s.ids[hash]
+	i := slices.Index(ids, imageID)
+	if i < 0 {
+		i = slices.Index(ids, "")
+	}
+	if i < 0 {
+		return false
+	}
+	s.ids[hash] = slices.Delete(ids, i, i+1)
+	return true
+}
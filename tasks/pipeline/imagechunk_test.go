@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkImage(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	paragraphs, err := ChunkImage("p096-097", "image/jpeg", "pages 96-97", data, 400)
+	require.NoError(t, err)
+	require.Greater(t, len(paragraphs), 3)
+	for i, paragraph := range paragraphs {
+		assert.LessOrEqual(t, len(paragraph), 400)
+		p, err := ParseParagraph(paragraph)
+		require.NoError(t, err)
+		require.Equal(t, ParagraphImageChunk, p.Kind)
+		assert.Equal(t, "p096-097", p.Chunk.ImageID)
+		assert.Equal(t, []int{i + 1, len(paragraphs)}, []int{p.Chunk.Index, p.Chunk.Count})
+		assert.Equal(t, "image/jpeg", p.Chunk.MIME)
+		assert.Equal(t, "pages 96-97", p.Chunk.Alt)
+	}
+	assert.True(t, strings.HasPrefix(paragraphs[0], "ALEXANDRIA-IMAGE-CHUNK/1 p096-097 1/"))
+
+	again, err := ChunkImage("p096-097", "image/jpeg", "pages 96-97", data, 400)
+	require.NoError(t, err)
+	assert.Equal(t, paragraphs, again, "chunking is deterministic")
+
+	_, err = ChunkImage("p096 097", "image/jpeg", "", data, 400)
+	assert.Error(t, err)
+	_, err = ChunkImage("p096", "image/jpeg", "", data, 50)
+	assert.ErrorContains(t, err, "too small")
+}
+
+func TestReadChapterImages(t *testing.T) {
+	whole := testPNG(t, 4, 6)
+	large := bytes.Repeat([]byte("page"), 300)
+	chunks, err := ChunkImage("p011", "image/jpeg", "", large, 300)
+	require.NoError(t, err)
+	paragraphs := append([]string{base64.StdEncoding.EncodeToString(whole), "Translated by Jason DeAngelis."}, chunks...)
+	paragraphs = append(paragraphs, imageParagraph("p012", "image/png", "page 12", whole))
+
+	images, err := ReadChapterImages(paragraphs)
+	require.NoError(t, err)
+	require.Len(t, images, 3)
+	assert.Equal(t, ChapterImage{MIME: "image/png", Data: whole, Paragraph: 0, Paragraphs: 1}, images[0], "a legacy image")
+	assert.Equal(t, ChapterImage{ImageID: "p011", MIME: "image/jpeg", Data: large, Paragraph: 2, Paragraphs: len(chunks)}, images[1])
+	assert.Equal(t, ChapterImage{ImageID: "p012", MIME: "image/png", Alt: "page 12", Data: whole, Paragraph: 2 + len(chunks), Paragraphs: 1}, images[2])
+
+	broken := func(edit func([]string) []string) error {
+		_, err := ReadChapterImages(edit(append([]string{}, chunks...)))
+		return err
+	}
+	assert.ErrorContains(t, broken(func(p []string) []string { return p[:len(p)-1] }), "stops after chunk")
+	assert.ErrorContains(t, broken(func(p []string) []string { return p[1:] }), "starts at chunk 2")
+	assert.ErrorContains(t, broken(func(p []string) []string { p[1], p[2] = p[2], p[1]; return p }), "expected chunk 2")
+	assert.ErrorContains(t, broken(func(p []string) []string {
+		return append(p[:1], append([]string{"a caption"}, p[1:]...)...)
+	}), "stops after chunk 1")
+	assert.ErrorContains(t, broken(func(p []string) []string {
+		parsed, err := ParseParagraph(p[1])
+		require.NoError(t, err)
+		parsed.Chunk.Data[0] ^= 0xff
+		p[1] = parsed.Chunk.Paragraph()
+		return p
+	}), "do not match their SHA-256")
+	_, err = ReadChapterImages([]string{"ALEXANDRIA-IMAGE-CHUNK/1 p011 1/x image/jpeg 00\nAAAA"})
+	assert.ErrorContains(t, err, "invalid chunk number")
+}
+
+func TestScanChapterImages(t *testing.T) {
+	large := bytes.Repeat([]byte("page"), 300)
+	chunks, err := ChunkImage("p012", "image/jpeg", "", large, 300)
+	require.NoError(t, err)
+	whole := imageParagraph("p011", "image/png", "", []byte("p011"))
+	paragraphs := append([]string{whole}, chunks[:2]...)
+
+	images, partial, err := ScanChapterImages(paragraphs)
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	assert.Equal(t, HashImage([]byte("p011")), images[0].Hash())
+	assert.Equal(t, &PartialImage{ImageID: "p012", SHA256: HashImage(large), Chunks: 2, Count: len(chunks), Paragraph: 1}, partial)
+	_, err = ReadChapterImages(paragraphs)
+	assert.ErrorContains(t, err, "image p012 stops after chunk 2")
+
+	_, partial, err = ScanChapterImages(append(paragraphs, chunks[2:]...))
+	require.NoError(t, err)
+	assert.Nil(t, partial)
+}
+
+func TestStoredImages(t *testing.T) {
+	blank, page := []byte("blank"), []byte("p002")
+	stored, err := NewStoredImages([]string{
+		imageParagraph("p001", "image/png", "", blank),
+		base64.StdEncoding.EncodeToString(testPNG(t, 4, 6)),
+		imageParagraph("p002", "image/png", "", page),
+		"A caption",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, stored.Partial)
+
+	assert.False(t, stored.Take("p003", HashImage(page)), "the same bytes under another page")
+	assert.True(t, stored.Take("p002", HashImage(page)))
+	assert.False(t, stored.Take("p002", HashImage(page)), "each image is taken once")
+	// A blank page repeated later in the chapter is a page of its own.
+	assert.True(t, stored.Take("p001", HashImage(blank)))
+	assert.False(t, stored.Take("p009", HashImage(blank)))
+	// A legacy image has no ID, so its hash alone matches.
+	assert.True(t, stored.Take("p000", HashImage(testPNG(t, 4, 6))))
+
+	_, err = NewStoredImages([]string{"ALEXANDRIA-IMAGE/9 p001 image/png\nAAAA"})
+	assert.ErrorContains(t, err, "newer than version 1")
+}
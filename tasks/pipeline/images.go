@@ -0,0 +1,726 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png" // register the PNG decoder
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// imageExts are the page image formats a volume may hold.
+var imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true}
+
+// ImagePage is one page image of a volume.
+type ImagePage struct {
+	// Name is the file name, or the path inside the archive.
+	Name string
+	PageName
+	// Kind is PageCover, PageCredits or PageExtra for pages that are not part of the
+	// story, by their ComicInfo.xml type or their name.
+	Kind string
+	// DoublePage is set when ComicInfo.xml says the image is a double-page spread.
+	DoublePage bool
+	// Spread is set on a double-page spread kept whole; Half on each half of one that is
+	// split (see LayoutSpreads).
+	Spread bool
+	Half   int
+	source string
+	inZip  bool
+}
+
+// Alt describes the page for readers that cannot show it, e.g. "Berserk, volume 1,
+// chapter 2, pages 96-97"; it is the alt text of its paragraph.
+func (p ImagePage) Alt() string {
+	var parts []string
+	if p.Series != "" {
+		parts = append(parts, p.Series)
+	}
+	if p.Volume > 0 {
+		parts = append(parts, fmt.Sprintf("volume %d", p.Volume))
+	}
+	if p.Chapter != "" {
+		parts = append(parts, "chapter "+p.Chapter)
+	}
+	switch {
+	case p.Kind != "":
+		parts = append(parts, p.Kind)
+	case p.Last > p.Number:
+		parts = append(parts, fmt.Sprintf("pages %d-%d", p.Number, p.Last))
+	default:
+		parts = append(parts, fmt.Sprintf("page %d", p.Number))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Read returns the page's image file.
+func (p ImagePage) Read() ([]byte, error) {
+	return readVolumeFile(p.source, p.Name, p.inZip)
+}
+
+// readVolumeFile reads the file name of the directory, or archive, at source.
+func readVolumeFile(source, name string, inZip bool) ([]byte, error) {
+	if !inZip {
+		return os.ReadFile(filepath.Join(source, name))
+	}
+	archive, err := zip.OpenReader(source)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// ImageVolume is the page images of a directory or a zip archive (.zip or .cbz).
+type ImageVolume struct {
+	Path string
+	// Pages are sorted by the chapter their names carry, then in page order (see
+	// PageRef.Before).
+	Pages []ImagePage
+	// Extras are covers, credits and other pages that are not part of the story and
+	// have no page number in their name. They are numbered after the volume's last
+	// page, and only uploaded to a chapter that takes their kind.
+	Extras []ImagePage
+	// Unnumbered are the other image files with no page number in their name, and
+	// Deleted the images ComicInfo.xml marks deleted; they are not uploaded.
+	Unnumbered []string
+	Deleted    []string
+	// Info is the volume's ComicInfo.xml; nil if it has none.
+	Info *ComicInfo
+}
+
+// OpenImageVolume lists the page images of the directory or archive at path, reading
+// their series, chapter, volume and page from their names (see ParsePageName) and
+// classifying covers and credits (see ImagePage.Kind). A ComicInfo.xml is read for the
+// page types, double pages, and the chapter number of pages whose names carry none. Two
+// images with the same page in the same chapter are an error, since their order would
+// be a guess.
+func OpenImageVolume(volumePath string) (*ImageVolume, error) {
+	info, err := os.Stat(volumePath)
+	if err != nil {
+		return nil, err
+	}
+	volume := &ImageVolume{Path: volumePath}
+	var names []string
+	inZip := false
+	if info.IsDir() {
+		entries, err := os.ReadDir(volumePath)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	} else {
+		switch strings.ToLower(filepath.Ext(volumePath)) {
+		case ".zip", ".cbz":
+		default:
+			return nil, fmt.Errorf("%s is not a directory, .zip or .cbz archive", volumePath)
+		}
+		archive, err := zip.OpenReader(volumePath)
+		if err != nil {
+			return nil, err
+		}
+		defer archive.Close()
+		for _, file := range archive.File {
+			if file.FileInfo().IsDir() || strings.HasPrefix(file.Name, "__MACOSX/") {
+				continue
+			}
+			names = append(names, file.Name)
+		}
+		inZip = true
+	}
+
+	var images []string
+	for _, name := range names {
+		base := path.Base(name)
+		switch {
+		case strings.HasPrefix(base, "."):
+		case strings.EqualFold(base, ComicInfoName):
+			data, err := readVolumeFile(volumePath, name, inZip)
+			if err != nil {
+				return nil, err
+			}
+			if volume.Info, err = ParseComicInfo(data); err != nil {
+				return nil, fmt.Errorf("%s: %w", volumePath, err)
+			}
+		case imageExts[strings.ToLower(path.Ext(base))]:
+			images = append(images, name)
+		}
+	}
+	// ComicInfo.xml refers to images by their position in name order.
+	sort.Strings(images)
+	pageInfo := map[int]ComicPageInfo{}
+	var fileChapter string
+	if volume.Info != nil {
+		for _, page := range volume.Info.Pages {
+			pageInfo[page.Image] = page
+		}
+		fileChapter = volume.Info.Chapter()
+	}
+
+	seen := map[string]string{}
+	last := -1
+	for i, name := range images {
+		parsed, numbered := ParsePageName(path.Base(name))
+		kind := classifyPage(name, numbered, parsed.Number, pageInfo[i].Type)
+		if parsed.Chapter == "" {
+			parsed.Chapter = fileChapter
+		}
+		page := ImagePage{Name: name, PageName: parsed, Kind: kind, DoublePage: pageInfo[i].DoublePage, source: volumePath, inZip: inZip}
+		switch {
+		case kind == pageDeleted:
+			volume.Deleted = append(volume.Deleted, name)
+			continue
+		case !numbered && kind != "":
+			volume.Extras = append(volume.Extras, page)
+			continue
+		case !numbered:
+			volume.Unnumbered = append(volume.Unnumbered, name)
+			continue
+		}
+		last = max(last, parsed.Last)
+		key := parsed.Chapter + "/" + parsed.Label()
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%s: page %s is both %q and %q", volumePath, parsed.Label(), other, name)
+		}
+		seen[key] = name
+		volume.Pages = append(volume.Pages, page)
+	}
+	for i := range volume.Extras {
+		number := last + 1 + i
+		volume.Extras[i].PageRef = PageRef{Number: number, Last: number}
+	}
+	sort.Slice(volume.Pages, func(i, j int) bool {
+		a, b := volume.Pages[i], volume.Pages[j]
+		if a.Chapter != b.Chapter {
+			return chapterLess(a.Chapter, b.Chapter)
+		}
+		return a.Before(b.PageRef)
+	})
+	return volume, nil
+}
+
+// PageLabel writes a page number as in file names, e.g. "p011".
+func PageLabel(number int) string {
+	return fmt.Sprintf("p%03d", number)
+}
+
+// ParsePage parses a page number written as in file names ("p011") or plain ("11").
+func ParsePage(s string) (int, error) {
+	digits := strings.TrimPrefix(strings.TrimSpace(s), "p")
+	number, err := strconv.Atoi(digits)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid page %q (expected a page like p011)", s)
+	}
+	return number, nil
+}
+
+// ImageChapter is a chapter that image pages are appended to, and the pages it takes.
+type ImageChapter struct {
+	Title string
+	Index int
+	// First and Last bound the chapter's pages; Last 0 means no upper bound.
+	First, Last int
+	// Ranged is set when the chapter was given a page range.
+	Ranged bool
+	// FileChapter, when set, is the chapter number the names of the pages it takes
+	// carry; it is set instead of a range.
+	FileChapter string
+	// Kind, when set, is the kind of page the chapter takes (see ImagePage.Kind),
+	// wherever it is in the volume.
+	Kind string
+}
+
+// Contains reports whether the chapter takes page.
+func (c ImageChapter) Contains(page ImagePage) bool {
+	switch {
+	case c.Kind != "":
+		return page.Kind == c.Kind
+	case c.FileChapter != "":
+		return page.Chapter == c.FileChapter
+	}
+	return page.Number >= c.First && (c.Last == 0 || page.Number <= c.Last)
+}
+
+// ParseImageChapter parses a chapter mapping: "Chapter I" takes every page,
+// "Chapter I=p001-p040", "Chapter II=p041-" or "Cover=p000" take a range of pages,
+// "Chapter II=c002" takes the pages whose names say they are of chapter 2, and
+// "Cover=cover", "Credits=credits" or "Extras=extra" take the pages of a kind.
+func ParseImageChapter(spec string, index int) (ImageChapter, error) {
+	chapter := ImageChapter{Index: index}
+	title, pages, ranged := strings.Cut(spec, "=")
+	chapter.Title = strings.TrimSpace(title)
+	if chapter.Title == "" {
+		return chapter, fmt.Errorf("chapter %q has no title", spec)
+	}
+	if !ranged {
+		return chapter, nil
+	}
+	if kind := strings.TrimSpace(pages); slices.Contains(PageKinds, kind) {
+		chapter.Kind = kind
+		return chapter, nil
+	}
+	if number, ok := strings.CutPrefix(strings.TrimSpace(pages), "c"); ok {
+		if _, err := strconv.ParseFloat(number, 64); err != nil {
+			return chapter, fmt.Errorf("chapter %q: invalid file chapter %q (expected one like c002)", chapter.Title, pages)
+		}
+		chapter.FileChapter = chapterNumber(number)
+		return chapter, nil
+	}
+	chapter.Ranged = true
+	first, last, isRange := strings.Cut(pages, "-")
+	var err error
+	if chapter.First, err = ParsePage(first); err != nil {
+		return chapter, fmt.Errorf("chapter %q: %w", chapter.Title, err)
+	}
+	switch {
+	case !isRange:
+		chapter.Last = chapter.First
+	case strings.TrimSpace(last) != "":
+		if chapter.Last, err = ParsePage(last); err != nil {
+			return chapter, fmt.Errorf("chapter %q: %w", chapter.Title, err)
+		}
+		if chapter.Last < chapter.First {
+			return chapter, fmt.Errorf("chapter %q: page range %s ends before it starts", chapter.Title, pages)
+		}
+	}
+	return chapter, nil
+}
+
+// ImageUpload is a page and the chapter it is appended to.
+type ImageUpload struct {
+	Chapter ImageChapter
+	Page    ImagePage
+}
+
+// FileImageChapters maps each chapter the pages' names carry to a chapter of its own,
+// titled by format with the chapter number (e.g. "Chapter %s"), with indexes from
+// firstIndex in chapter order.
+func FileImageChapters(pages []ImagePage, format string, firstIndex int) ([]ImageChapter, error) {
+	numbers := FileChapters(pages)
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("the page names carry no chapter number; give the chapters")
+	}
+	chapters := make([]ImageChapter, len(numbers))
+	for i, number := range numbers {
+		chapters[i] = ImageChapter{Title: fmt.Sprintf(format, number), Index: firstIndex + i, FileChapter: number}
+	}
+	return chapters, nil
+}
+
+// AssignPages gives each page from first to last (0 for no bound) to its chapter, in
+// page order. A chapter that takes a kind of page takes it wherever it is, before the
+// others. Several other chapters must each have a page range or a file chapter; ranges
+// must be in increasing order and without overlap, since pages are appended in the
+// order they are uploaded. A page in range that no chapter takes is an error rather
+// than being silently dropped, and so are two pages with the same label in one chapter,
+// which happens when page numbers restart in each chapter of the names.
+func AssignPages(pages []ImagePage, chapters []ImageChapter, first, last int) ([]ImageUpload, error) {
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("no chapter to upload pages to")
+	}
+	kinds := map[string]ImageChapter{}
+	var story []ImageChapter
+	for _, chapter := range chapters {
+		if chapter.Kind == "" {
+			story = append(story, chapter)
+			continue
+		}
+		if other, ok := kinds[chapter.Kind]; ok {
+			return nil, fmt.Errorf("chapters %q and %q both take the %s pages", other.Title, chapter.Title, chapter.Kind)
+		}
+		kinds[chapter.Kind] = chapter
+	}
+	if len(story) > 1 {
+		var previous *ImageChapter
+		fileChapters := map[string]string{}
+		for i, chapter := range story {
+			switch {
+			case chapter.FileChapter != "":
+				if other, ok := fileChapters[chapter.FileChapter]; ok {
+					return nil, fmt.Errorf("chapters %q and %q both take chapter %s of the page names", other, chapter.Title, chapter.FileChapter)
+				}
+				fileChapters[chapter.FileChapter] = chapter.Title
+			case !chapter.Ranged:
+				return nil, fmt.Errorf("chapter %q needs a page range, e.g. %q, when there are several chapters", chapter.Title, chapter.Title+"=p001-p040")
+			default:
+				if previous != nil && (previous.Last == 0 || chapter.First <= previous.Last) {
+					return nil, fmt.Errorf("chapters %q and %q overlap or are out of order", previous.Title, chapter.Title)
+				}
+				previous = &story[i]
+			}
+		}
+	}
+	var uploads []ImageUpload
+	var orphans []string
+	labels := map[string]string{}
+	for _, page := range pages {
+		candidates := story
+		if chapter, ok := kinds[page.Kind]; ok && page.Kind != "" {
+			candidates = []ImageChapter{chapter}
+		} else if page.Number < first || (last > 0 && page.Number > last) {
+			continue
+		}
+		assigned := false
+		for _, chapter := range candidates {
+			if !chapter.Contains(page) {
+				continue
+			}
+			key := chapter.Title + "/" + page.Label()
+			if other, ok := labels[key]; ok {
+				err := fmt.Errorf("%q and %q would both be %s of %s", other, page.Name, page.Label(), chapter.Title)
+				if page.Chapter != "" {
+					err = fmt.Errorf("%w; map the chapters of the names instead, e.g. %q", err, chapter.Title+"=c"+page.Chapter)
+				}
+				return nil, err
+			}
+			labels[key] = page.Name
+			uploads = append(uploads, ImageUpload{Chapter: chapter, Page: page})
+			assigned = true
+			break
+		}
+		if !assigned {
+			orphans = append(orphans, pageOf(page))
+		}
+	}
+	if len(orphans) > 0 {
+		return nil, fmt.Errorf("pages %s are in range but in no chapter", strings.Join(orphans, ", "))
+	}
+	return uploads, nil
+}
+
+// pageOf names a page by its label, and its chapter if its name carries one.
+func pageOf(page ImagePage) string {
+	if page.Chapter == "" {
+		return page.Label()
+	}
+	return fmt.Sprintf("c%s %s", page.Chapter, page.Label())
+}
+
+// DefaultImageBudget is the largest page paragraph, in bytes, uploaded by default. It
+// leaves room under MaxTransactionBytes for the script, the book and chapter titles
+// and the signatures.
+const DefaultImageBudget = MaxTransactionBytes - 100_000
+
+// ImageOptions control how a page is encoded for upload.
+type ImageOptions struct {
+	// MaxWidth scales wider pages down, keeping their aspect ratio; SpreadWidth does
+	// for double-page spreads kept whole.
+	MaxWidth    int
+	SpreadWidth int
+	// Quality is the JPEG quality tried first; MinQuality the lowest accepted.
+	Quality    int
+	MinQuality int
+	// MinScale is the smallest fraction of its width a page is scaled down to, after
+	// MaxWidth, to fit the budget.
+	MinScale float64
+	// Budget is the largest paragraph, in bytes and envelope included, a page may take;
+	// 0 for no limit.
+	Budget int
+	// MinPSNR is the lowest fidelity, in dB, of a gray-palette or bilevel PNG to the
+	// page it encodes for it to be kept.
+	MinPSNR float64
+	// KeepColor encodes every page as color JPEG, gray ones included.
+	KeepColor bool
+}
+
+// DefaultImageOptions keep a typical manga page under the transaction limit at the
+// best quality that fits.
+var DefaultImageOptions = ImageOptions{MaxWidth: 2000, SpreadWidth: 4000, Quality: 85, MinQuality: 40, MinScale: 0.5, Budget: DefaultImageBudget, MinPSNR: 30}
+
+// imageScales are the fractions of its width a page is tried at, largest first.
+var imageScales = []float64{1, 0.9, 0.8, 0.7, 0.6, 0.5, 0.4, 0.3, 0.25}
+
+// EncodedImage is a page re-encoded for upload.
+type EncodedImage struct {
+	// ImageID and Alt are written in the page's paragraph envelope.
+	ImageID string
+	Alt     string
+	// Data is the page in Encoding, of type MIME.
+	Data     []byte
+	MIME     string
+	Encoding string
+	// Tone is ToneColor, ToneGray or ToneBilevel.
+	Tone string
+	// Format is the source's format; SourceBytes its file size.
+	Format        string
+	SourceBytes   int
+	SourceWidth   int
+	SourceHeight  int
+	Width, Height int
+	// Quality is the JPEG quality; 0 for a PNG.
+	Quality int
+	// PSNR is the fidelity of Data to the page at its size, in dB (see EncodingTrial).
+	PSNR float64
+	// Trials are the encodings tried at the page's size, the one kept included.
+	Trials []EncodingTrial
+	// OverBudget is set when no encoding within the options fits the budget; the page
+	// is then encoded as JPEG at MaxWidth and Quality, for the caller to refuse or
+	// chunk.
+	OverBudget bool
+}
+
+// Stats describes how the page was encoded, for the upload log: its tone, the encoding
+// kept and its size against the source's, and the other encodings tried.
+func (e EncodedImage) Stats() string {
+	kept := EncodingTrial{Encoding: e.Encoding, Bytes: len(e.Data), Quality: e.Quality, PSNR: e.PSNR}
+	stats := fmt.Sprintf("%s page %dx%d, %s (%.0f%% of the %d-byte %s)", e.Tone, e.Width, e.Height, kept,
+		100*float64(len(e.Data))/float64(max(e.SourceBytes, 1)), e.SourceBytes, e.Format)
+	var others []string
+	for _, trial := range e.Trials {
+		if trial.Encoding == e.Encoding {
+			continue
+		}
+		if trial.Fits {
+			others = append(others, trial.String())
+		} else {
+			others = append(others, trial.String()+" (rejected)")
+		}
+	}
+	if len(others) > 0 {
+		stats += "; tried " + strings.Join(others, ", ")
+	}
+	if e.OverBudget {
+		stats += "; over budget"
+	}
+	return stats
+}
+
+// Resized reports whether the page was scaled down.
+func (e EncodedImage) Resized() bool {
+	return e.Width != e.SourceWidth
+}
+
+// Paragraph is the page as it is stored on-chain: its data in an image paragraph (see
+// Paragraph).
+func (e EncodedImage) Paragraph() string {
+	return imageParagraph(e.ImageID, e.MIME, e.Alt, e.Data)
+}
+
+// Chunks is the page as it is stored on-chain when it is over the budget: its data in
+// image chunk paragraphs of at most size bytes.
+func (e EncodedImage) Chunks(size int) ([]string, error) {
+	return ChunkImage(e.ImageID, e.MIME, e.Alt, e.Data, size)
+}
+
+// EncodeImage decodes a PNG or JPEG page and re-encodes it, scaled down to
+// opts.MaxWidth if it is wider. A color page becomes a JPEG: with a budget, it keeps
+// the page's size and searches for the highest quality down to MinQuality whose
+// paragraph, envelope included, fits; if none does, it scales the page down step by
+// step to MinScale and searches again. A gray page, unless opts.KeepColor is set, is
+// tried at each size as a gray JPEG, searched the same way, and as gray-palette and
+// bilevel PNGs, and the smallest that fits is kept. The same input and options always
+// give the same bytes.
+func EncodeImage(data []byte, imageID, alt string, opts ImageOptions) (EncodedImage, error) {
+	if err := checkImageID(imageID); err != nil {
+		return EncodedImage{}, err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return EncodedImage{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return encodeImage(img, EncodedImage{ImageID: imageID, Alt: alt, Format: format, SourceBytes: len(data)}, opts)
+}
+
+// EncodePage reads and encodes a page with EncodeImage, with its label as image ID: a
+// spread kept whole up to opts.SpreadWidth, a half of a split spread cut out of its
+// image first.
+func EncodePage(page ImagePage, opts ImageOptions) (EncodedImage, error) {
+	data, err := page.Read()
+	if err != nil {
+		return EncodedImage{}, err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return EncodedImage{}, fmt.Errorf("%s: failed to decode image: %w", page.Name, err)
+	}
+	if page.Spread && opts.SpreadWidth > 0 {
+		opts.MaxWidth = opts.SpreadWidth
+	}
+	if page.Half != 0 {
+		img = halfImage(img, page.Half)
+	}
+	encoded, err := encodeImage(img, EncodedImage{ImageID: page.Label(), Alt: page.Alt(), Format: format, SourceBytes: len(data)}, opts)
+	if err != nil {
+		return EncodedImage{}, fmt.Errorf("%s: %w", page.Name, err)
+	}
+	return encoded, nil
+}
+
+func encodeImage(img image.Image, encoded EncodedImage, opts ImageOptions) (EncodedImage, error) {
+	bounds := img.Bounds()
+	encoded.SourceWidth, encoded.SourceHeight = bounds.Dx(), bounds.Dy()
+	width := bounds.Dx()
+	if opts.MaxWidth > 0 && width > opts.MaxWidth {
+		width = opts.MaxWidth
+	}
+	minQuality := opts.MinQuality
+	if minQuality <= 0 || minQuality > opts.Quality {
+		minQuality = opts.Quality
+	}
+	gray := !opts.KeepColor && isGray(img)
+	encoded.Tone = ToneColor
+	if gray {
+		encoded.Tone = ToneGray
+	}
+	fits := func(mime string, data []byte) bool {
+		header := len(imageParagraph(encoded.ImageID, mime, encoded.Alt, nil))
+		return opts.Budget <= 0 || header+base64.StdEncoding.EncodedLen(len(data)) <= opts.Budget
+	}
+
+	for _, scale := range imageScales {
+		if scale < opts.MinScale || (opts.Budget <= 0 && scale < 1) {
+			break
+		}
+		scaled := scaleImage(img, int(float64(width)*scale+0.5))
+		encoded.Width, encoded.Height = scaled.Bounds().Dx(), scaled.Bounds().Dy()
+		var err error
+		if gray {
+			err = encodeGray(&encoded, toGray(scaled), minQuality, opts, fits)
+		} else {
+			err = encodeColor(&encoded, scaled, minQuality, opts, fits)
+		}
+		if err != nil || encoded.Data != nil {
+			return encoded, err
+		}
+	}
+
+	scaled := scaleImage(img, width)
+	encoded.Width, encoded.Height = scaled.Bounds().Dx(), scaled.Bounds().Dy()
+	encoded.Encoding, encoded.Trials = EncodingJPEG, nil
+	if gray {
+		scaled, encoded.Encoding = toGray(scaled), EncodingGrayJPEG
+	}
+	data, err := encodeJPEG(scaled, opts.Quality)
+	if err != nil {
+		return EncodedImage{}, err
+	}
+	encoded.Data, encoded.MIME, encoded.Quality, encoded.PSNR, encoded.OverBudget = data, "image/jpeg", opts.Quality, 0, true
+	return encoded, nil
+}
+
+// encodeColor encodes a color page, at one scale, as the JPEG of the highest quality
+// that fits. It leaves encoded.Data nil if none does.
+func encodeColor(encoded *EncodedImage, scaled image.Image, minQuality int, opts ImageOptions, fits func(string, []byte) bool) error {
+	data, quality, err := searchJPEG(scaled, minQuality, opts.Quality, fits)
+	if err != nil || data == nil {
+		return err
+	}
+	encoded.Data, encoded.MIME, encoded.Encoding, encoded.Quality, encoded.PSNR = data, "image/jpeg", EncodingJPEG, quality, 0
+	encoded.Trials = []EncodingTrial{{Encoding: EncodingJPEG, Bytes: len(data), Quality: quality, Fits: true}}
+	return nil
+}
+
+// encodeGray encodes a gray page, at one scale, as the smallest that fits of: the gray
+// JPEG of the highest quality that fits, a PNG of grayLevels grays, and, for a bilevel
+// page, a black and white PNG. A PNG is kept only at opts.MinPSNR or better. It leaves
+// encoded.Data nil if none fits.
+func encodeGray(encoded *EncodedImage, gray *image.Gray, minQuality int, opts ImageOptions, fits func(string, []byte) bool) error {
+	encoded.Tone, encoded.Data, encoded.Trials = ToneGray, nil, nil
+	var best []byte
+	keep := func(trial EncodingTrial, data []byte, mime string) {
+		encoded.Trials = append(encoded.Trials, trial)
+		if trial.Fits && (best == nil || len(data) < len(best)) {
+			best = data
+			encoded.MIME, encoded.Encoding, encoded.Quality, encoded.PSNR = mime, trial.Encoding, trial.Quality, trial.PSNR
+		}
+	}
+
+	data, quality, err := searchJPEG(gray, minQuality, opts.Quality, fits)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		decoded, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to decode the gray JPEG: %w", err)
+		}
+		keep(EncodingTrial{Encoding: EncodingGrayJPEG, Bytes: len(data), Quality: quality, PSNR: grayPSNR(gray, decoded), Fits: true}, data, "image/jpeg")
+	}
+
+	// A bilevel PNG goes first, to be kept over a gray-palette PNG of the same size.
+	levels := []int{grayLevels}
+	if isBilevel(gray) {
+		encoded.Tone = ToneBilevel
+		levels = []int{2, grayLevels}
+	}
+	for _, n := range levels {
+		encoding := EncodingPalettePNG
+		if n == 2 {
+			encoding = EncodingBilevelPNG
+		}
+		paletted := quantizeGray(gray, n)
+		data, err := encodePNG(paletted)
+		if err != nil {
+			return err
+		}
+		psnr := grayPSNR(gray, paletted)
+		keep(EncodingTrial{Encoding: encoding, Bytes: len(data), PSNR: psnr, Fits: psnr >= opts.MinPSNR && fits("image/png", data)}, data, "image/png")
+	}
+	encoded.Data = best
+	return nil
+}
+
+// searchJPEG returns the JPEG of img of the highest quality from maxQuality down to
+// minQuality that fits, by bisection: JPEG size grows with quality. It returns nil if
+// not even minQuality fits.
+func searchJPEG(img image.Image, minQuality, maxQuality int, fits func(string, []byte) bool) ([]byte, int, error) {
+	best, err := encodeJPEG(img, minQuality)
+	if err != nil || !fits("image/jpeg", best) {
+		return nil, 0, err
+	}
+	quality, low, high := minQuality, minQuality+1, maxQuality
+	for low <= high {
+		mid := (low + high) / 2
+		candidate, err := encodeJPEG(img, mid)
+		if err != nil {
+			return nil, 0, err
+		}
+		if fits("image/jpeg", candidate) {
+			best, quality, low = candidate, mid, mid+1
+		} else {
+			high = mid - 1
+		}
+	}
+	return best, quality, nil
+}
+
+// scaleImage scales img down to width, keeping its aspect ratio.
+func scaleImage(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if width >= bounds.Dx() || width <= 0 {
+		return img
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.BiLinear.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
+	return resized
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode image as JPEG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,327 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*7 + y*3) % 256)})
+		}
+	}
+	return pngBytes(t, img)
+}
+
+// pngBytes encodes img as PNG, the source images of the encoding tests.
+func pngBytes(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+var volumeFiles = []string{
+	"Berserk - 001 (v01) - p002 [Digital].png",
+	"Berserk - 001 (v01) - p000 [Digital].png",
+	"Berserk - 001 (v01) - p001 [Digital].png",
+	"Berserk - 001 (v01) - p010 [Digital].png",
+	"Berserk v01 - credits.png",
+	"notes.png",
+	"ComicInfo.xml",
+	".DS_Store",
+}
+
+const volumeInfo = `<?xml version="1.0"?>
+<ComicInfo><Series>Berserk</Series><Number>1</Number><Volume>1</Volume><Manga>YesAndRightToLeft</Manga></ComicInfo>`
+
+// volumeFile is the content of a file of volumeFiles.
+func volumeFile(t *testing.T, name string) []byte {
+	if name == "ComicInfo.xml" {
+		return []byte(volumeInfo)
+	}
+	return testPNG(t, 4, 6)
+}
+
+func TestOpenImageVolumeDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range volumeFiles {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), volumeFile(t, name), 0o644))
+	}
+	volume, err := OpenImageVolume(dir)
+	require.NoError(t, err)
+	var numbers []int
+	for _, page := range volume.Pages {
+		numbers = append(numbers, page.Number)
+	}
+	assert.Equal(t, []int{0, 1, 2, 10}, numbers)
+	assert.Equal(t, PageCover, volume.Pages[0].Kind, "p000 is the front cover")
+	assert.Equal(t, "", volume.Pages[1].Kind)
+	require.Len(t, volume.Extras, 1)
+	assert.Equal(t, "Berserk v01 - credits.png", volume.Extras[0].Name)
+	assert.Equal(t, PageCredits, volume.Extras[0].Kind)
+	assert.Equal(t, "p011", volume.Extras[0].Label(), "extras are numbered after the last page")
+	assert.Equal(t, "1", volume.Extras[0].Chapter, "from ComicInfo.xml")
+	assert.Equal(t, []string{"notes.png"}, volume.Unnumbered)
+	require.NotNil(t, volume.Info)
+	assert.Equal(t, RightToLeft, volume.Info.ReadingOrder())
+
+	data, err := volume.Pages[1].Read()
+	require.NoError(t, err)
+	assert.Equal(t, testPNG(t, 4, 6), data)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Berserk - 001 (v01) - p001 (alt).jpg"), nil, 0o644))
+	_, err = OpenImageVolume(dir)
+	assert.ErrorContains(t, err, "page p001 is both")
+}
+
+func TestOpenImageVolumeArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Berserk v01.cbz")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	archive := zip.NewWriter(file)
+	for _, name := range append(volumeFiles, "__MACOSX/._p003.png") {
+		w, err := archive.Create("Berserk v01/" + name)
+		require.NoError(t, err)
+		w.Write(volumeFile(t, name))
+	}
+	require.NoError(t, archive.Close())
+	require.NoError(t, file.Close())
+
+	volume, err := OpenImageVolume(path)
+	require.NoError(t, err)
+	require.Len(t, volume.Pages, 4)
+	require.NotNil(t, volume.Info)
+	assert.Equal(t, "Berserk", volume.Info.Series)
+	assert.Equal(t, "Berserk v01/Berserk - 001 (v01) - p000 [Digital].png", volume.Pages[0].Name)
+	data, err := volume.Pages[3].Read()
+	require.NoError(t, err)
+	assert.Equal(t, testPNG(t, 4, 6), data)
+
+	other := filepath.Join(t.TempDir(), "volume.rar")
+	require.NoError(t, os.WriteFile(other, nil, 0o644))
+	_, err = OpenImageVolume(other)
+	assert.ErrorContains(t, err, "not a directory")
+}
+
+// numberedPage is a page of chapter (from its name) with number.
+func numberedPage(chapter string, number int) ImagePage {
+	return ImagePage{Name: chapter + "-" + PageLabel(number), PageName: PageName{Chapter: chapter, PageRef: PageRef{Number: number, Last: number}}}
+}
+
+func TestParseImageChapter(t *testing.T) {
+	page := func(n int) ImagePage { return numberedPage("", n) }
+	chapter, err := ParseImageChapter("Chapter I", 1)
+	require.NoError(t, err)
+	assert.Equal(t, ImageChapter{Title: "Chapter I", Index: 1}, chapter)
+	assert.True(t, chapter.Contains(page(0)))
+	assert.True(t, chapter.Contains(page(500)))
+
+	chapter, err = ParseImageChapter("Chapter II = p041-p080", 2)
+	require.NoError(t, err)
+	assert.Equal(t, ImageChapter{Title: "Chapter II", Index: 2, First: 41, Last: 80, Ranged: true}, chapter)
+	assert.False(t, chapter.Contains(page(40)))
+	assert.True(t, chapter.Contains(page(80)))
+	assert.False(t, chapter.Contains(page(81)))
+
+	chapter, err = ParseImageChapter("Chapter III=p081-", 3)
+	require.NoError(t, err)
+	assert.True(t, chapter.Contains(page(900)))
+	chapter, err = ParseImageChapter("Cover=p000", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, chapter.Last)
+	assert.True(t, chapter.Contains(page(0)))
+	chapter, err = ParseImageChapter("Chapter II=c002", 2)
+	require.NoError(t, err)
+	assert.Equal(t, ImageChapter{Title: "Chapter II", Index: 2, FileChapter: "2"}, chapter)
+	assert.True(t, chapter.Contains(numberedPage("2", 1)))
+	assert.False(t, chapter.Contains(numberedPage("3", 1)))
+	assert.False(t, chapter.Contains(page(1)))
+	chapter, err = ParseImageChapter("Credits=credits", 9)
+	require.NoError(t, err)
+	assert.Equal(t, ImageChapter{Title: "Credits", Index: 9, Kind: PageCredits}, chapter)
+	credits := page(30)
+	credits.Kind = PageCredits
+	assert.True(t, chapter.Contains(credits))
+	assert.False(t, chapter.Contains(page(30)))
+
+	for _, spec := range []string{"=p001-p002", "Chapter I=p040-p001", "Chapter I=one-two", "Chapter I=p-1", "Chapter I=cII"} {
+		_, err := ParseImageChapter(spec, 1)
+		assert.Error(t, err, spec)
+	}
+
+	number, err := ParsePage("p011")
+	require.NoError(t, err)
+	assert.Equal(t, 11, number)
+	number, err = ParsePage("7")
+	require.NoError(t, err)
+	assert.Equal(t, 7, number)
+}
+
+func TestAssignPages(t *testing.T) {
+	var pages []ImagePage
+	for _, n := range []int{1, 2, 3, 4, 5, 6} {
+		pages = append(pages, numberedPage("", n))
+	}
+	chapter := func(spec string) ImageChapter {
+		c, err := ParseImageChapter(spec, 1)
+		require.NoError(t, err)
+		return c
+	}
+	assigned := func(uploads []ImageUpload) []string {
+		var out []string
+		for _, u := range uploads {
+			out = append(out, u.Chapter.Title+":"+string(rune('0'+u.Page.Number)))
+		}
+		return out
+	}
+
+	uploads, err := AssignPages(pages, []ImageChapter{chapter("Chapter I")}, 2, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Chapter I:2", "Chapter I:3", "Chapter I:4"}, assigned(uploads))
+
+	uploads, err = AssignPages(pages, []ImageChapter{chapter("A=p001-p003"), chapter("B=p004-")}, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A:1", "A:2", "A:3", "B:4", "B:5", "B:6"}, assigned(uploads))
+
+	_, err = AssignPages(pages, []ImageChapter{chapter("A=p001-p002"), chapter("B=p004-")}, 0, 0)
+	assert.ErrorContains(t, err, "p003")
+	_, err = AssignPages(pages, []ImageChapter{chapter("A=p001-p002"), chapter("B=p004-")}, 4, 0)
+	assert.NoError(t, err, "pages out of range need no chapter")
+	_, err = AssignPages(pages, []ImageChapter{chapter("A=p001-p004"), chapter("B=p004-")}, 0, 0)
+	assert.ErrorContains(t, err, "overlap")
+	_, err = AssignPages(pages, []ImageChapter{chapter("A"), chapter("B=p004-")}, 0, 0)
+	assert.ErrorContains(t, err, "needs a page range")
+	_, err = AssignPages(pages, nil, 0, 0)
+	assert.Error(t, err)
+
+	// Page numbers that restart in each chapter of the names.
+	restarting := []ImagePage{numberedPage("1", 1), numberedPage("1", 2), numberedPage("2", 1)}
+	_, err = AssignPages(restarting, []ImageChapter{chapter("Chapter I")}, 0, 0)
+	assert.ErrorContains(t, err, `"Chapter I=c2"`)
+	chapters, err := FileImageChapters(restarting, "Chapter %s", 3)
+	require.NoError(t, err)
+	assert.Equal(t, []ImageChapter{
+		{Title: "Chapter 1", Index: 3, FileChapter: "1"},
+		{Title: "Chapter 2", Index: 4, FileChapter: "2"},
+	}, chapters)
+	uploads, err = AssignPages(restarting, chapters, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Chapter 1:1", "Chapter 1:2", "Chapter 2:1"}, assigned(uploads))
+	_, err = AssignPages(restarting, []ImageChapter{chapter("A=c1"), chapter("B=c001")}, 0, 0)
+	assert.ErrorContains(t, err, "both take chapter 1")
+	_, err = FileImageChapters(pages, "Chapter %s", 1)
+	assert.ErrorContains(t, err, "no chapter number")
+
+	// Covers and credits go to the chapters that take their kind, wherever they are.
+	kinds := []ImagePage{numberedPage("", 0), numberedPage("", 1), numberedPage("", 2), numberedPage("", 3)}
+	kinds[0].Kind, kinds[3].Kind = PageCover, PageCredits
+	uploads, err = AssignPages(kinds, []ImageChapter{chapter("Cover=cover"), chapter("Chapter I"), chapter("Credits=credits")}, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Cover:0", "Chapter I:1", "Chapter I:2", "Credits:3"}, assigned(uploads))
+	uploads, err = AssignPages(kinds, []ImageChapter{chapter("Chapter I")}, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, uploads, 4, "without a chapter for their kind, covers and credits stay in place")
+	_, err = AssignPages(kinds, []ImageChapter{chapter("A=cover"), chapter("B=cover"), chapter("Chapter I")}, 0, 0)
+	assert.ErrorContains(t, err, "both take the cover pages")
+}
+
+func TestImagePageAlt(t *testing.T) {
+	page := func(name, kind string) ImagePage {
+		parsed, ok := ParsePageName(name)
+		require.True(t, ok, name)
+		return ImagePage{Name: name, PageName: parsed, Kind: kind}
+	}
+	assert.Equal(t, "Berserk, volume 1, chapter 2, pages 96-97", page("Berserk - 002 (v01) - p096-097 [Digital].png", "").Alt())
+	assert.Equal(t, "Berserk, volume 1, cover", page("Berserk v01 p000.jpg", PageCover).Alt())
+	assert.Equal(t, "page 7", page("p007.png", "").Alt())
+}
+
+func TestEncodeImage(t *testing.T) {
+	source := testPNG(t, 300, 200)
+	encoded, err := EncodeImage(source, "p001", "page 1", ImageOptions{MaxWidth: 150, Quality: 70, KeepColor: true})
+	require.NoError(t, err)
+	assert.Equal(t, "png", encoded.Format)
+	assert.Equal(t, len(source), encoded.SourceBytes)
+	assert.Equal(t, []int{300, 200, 150, 100}, []int{encoded.SourceWidth, encoded.SourceHeight, encoded.Width, encoded.Height})
+	assert.True(t, encoded.Resized())
+
+	decoded, err := jpeg.Decode(bytes.NewReader(encoded.Data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 150, 100), decoded.Bounds())
+	paragraph, err := ParseParagraph(encoded.Paragraph())
+	require.NoError(t, err)
+	assert.Equal(t, Paragraph{Kind: ParagraphImage, Version: 1, ImageID: "p001", MIME: "image/jpeg", Alt: "page 1", Data: encoded.Data}, paragraph)
+
+	again, err := EncodeImage(source, "p001", "page 1", ImageOptions{MaxWidth: 150, Quality: 70, KeepColor: true})
+	require.NoError(t, err)
+	assert.Equal(t, encoded.Data, again.Data, "encoding is deterministic")
+
+	small, err := EncodeImage(source, "p001", "page 1", DefaultImageOptions)
+	require.NoError(t, err)
+	assert.False(t, small.Resized())
+
+	_, err = EncodeImage([]byte("not an image"), "p001", "", DefaultImageOptions)
+	assert.Error(t, err)
+	_, err = EncodeImage(source, "page 1", "", DefaultImageOptions)
+	assert.ErrorContains(t, err, "invalid image ID")
+}
+
+// noisyPNG is a page JPEG compresses badly, so its size depends on quality and scale.
+func noisyPNG(t *testing.T, width, height int) []byte {
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.IntN(256))
+	}
+	return pngBytes(t, img)
+}
+
+func TestEncodeImageBudget(t *testing.T) {
+	source := noisyPNG(t, 400, 600)
+	unlimited, err := EncodeImage(source, "p001", "page 1", ImageOptions{Quality: 85, KeepColor: true})
+	require.NoError(t, err)
+	size := len(unlimited.Paragraph())
+
+	// Some quality has to go, but the page keeps its size.
+	opts := ImageOptions{Quality: 85, MinQuality: 20, MinScale: 0.5, Budget: size * 3 / 4, KeepColor: true}
+	lower, err := EncodeImage(source, "p001", "page 1", opts)
+	require.NoError(t, err)
+	assert.False(t, lower.OverBudget)
+	assert.False(t, lower.Resized())
+	assert.Less(t, lower.Quality, 85)
+	assert.GreaterOrEqual(t, lower.Quality, 20)
+	assert.LessOrEqual(t, len(lower.Paragraph()), opts.Budget)
+	higher, err := EncodeImage(source, "p001", "page 1", ImageOptions{Quality: lower.Quality + 1, MinScale: 1, Budget: opts.Budget, KeepColor: true})
+	require.NoError(t, err)
+	assert.Greater(t, len(higher.Paragraph()), opts.Budget, "the highest quality that fits is chosen")
+
+	// Not even the lowest quality fits, so the page is scaled down.
+	opts.Budget = size / 4
+	smaller, err := EncodeImage(source, "p001", "page 1", opts)
+	require.NoError(t, err)
+	assert.False(t, smaller.OverBudget)
+	assert.True(t, smaller.Resized())
+	assert.GreaterOrEqual(t, smaller.Width, 200)
+	assert.LessOrEqual(t, len(smaller.Paragraph()), opts.Budget)
+
+	// Nothing within the options fits: the page comes back whole, marked over budget.
+	opts.Budget = 1000
+	over, err := EncodeImage(source, "p001", "page 1", opts)
+	require.NoError(t, err)
+	assert.True(t, over.OverBudget)
+	assert.Equal(t, []int{400, 600, 85}, []int{over.Width, over.Height, over.Quality})
+	assert.Equal(t, unlimited.Data, over.Data)
+}
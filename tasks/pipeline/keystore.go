@@ -0,0 +1,211 @@
+package pipeline
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeystoreVersion is the format written by Keystore.Save.
+const KeystoreVersion = 1
+
+// KeystorePassphraseEnv names the environment variable that supplies the keystore
+// passphrase to runs without a terminal.
+const KeystorePassphraseEnv = "ALEXANDRIA_KEYSTORE_PASSPHRASE"
+
+// ErrWrongPassphrase is returned when a key does not decrypt with the passphrase given.
+var ErrWrongPassphrase = errors.New("wrong keystore passphrase, or the key was tampered with")
+
+// ScryptParams are the cost parameters of the key derivation. DefaultScrypt takes about
+// 100 ms and 32 MB per key; tests use cheaper ones.
+type ScryptParams struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+// DefaultScrypt are the parameters new keys are encrypted with.
+var DefaultScrypt = ScryptParams{N: 1 << 15, R: 8, P: 1}
+
+// AccountKey identifies a Flow account key and how it signs, as flow.json describes it.
+type AccountKey struct {
+	// Account is the flow.json account name, e.g. "mainnet-Librarian".
+	Account  string `json:"account"`
+	Address  string `json:"address"`
+	Index    int    `json:"index"`
+	SigAlgo  string `json:"signatureAlgorithm"`
+	HashAlgo string `json:"hashAlgorithm"`
+}
+
+// KeystoreEntry is one private key encrypted with AES-256-GCM under a key derived from
+// the passphrase with scrypt. The account key is authenticated with it, so an entry
+// cannot be moved to another account without failing to decrypt.
+type KeystoreEntry struct {
+	Key        AccountKey   `json:"key"`
+	PublicKey  string       `json:"publicKey"`
+	Scrypt     ScryptParams `json:"scrypt"`
+	Salt       string       `json:"salt"`
+	Nonce      string       `json:"nonce"`
+	Ciphertext string       `json:"ciphertext"`
+}
+
+// Keystore is the encrypted keystore file: entries by flow.json account name.
+type Keystore struct {
+	Version int                      `json:"version"`
+	Keys    map[string]KeystoreEntry `json:"keys"`
+}
+
+// LoadKeystore reads the keystore at path. A missing file is an empty keystore.
+func LoadKeystore(path string) (*Keystore, error) {
+	keystore := &Keystore{Version: KeystoreVersion, Keys: map[string]KeystoreEntry{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return keystore, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, keystore); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if keystore.Version != KeystoreVersion {
+		return nil, fmt.Errorf("%s: unsupported keystore version %d", path, keystore.Version)
+	}
+	if keystore.Keys == nil {
+		keystore.Keys = map[string]KeystoreEntry{}
+	}
+	return keystore, nil
+}
+
+// Save writes the keystore to path, readable only by its owner.
+func (k *Keystore) Save(path string) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Accounts returns the account names in the keystore, in order.
+func (k *Keystore) Accounts() []string {
+	names := make([]string, 0, len(k.Keys))
+	for name := range k.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Add encrypts privateKey for key with passphrase and stores it, replacing any entry
+// for the same account.
+func (k *Keystore) Add(key AccountKey, privateKey []byte, passphrase string, params ScryptParams) error {
+	if passphrase == "" {
+		return errors.New("the keystore passphrase is empty")
+	}
+	signer, err := NewLocalSigner(key, privateKey)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, 32)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	publicKey, err := signer.PublicKey()
+	if err != nil {
+		return err
+	}
+	entry := KeystoreEntry{
+		Key:       key,
+		PublicKey: hex.EncodeToString(publicKey),
+		Scrypt:    params,
+		Salt:      hex.EncodeToString(salt),
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	aead, err := entry.cipher(passphrase)
+	if err != nil {
+		return err
+	}
+	entry.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, privateKey, entry.additionalData()))
+	k.Keys[key.Account] = entry
+	return nil
+}
+
+// Decrypt returns the private key of account.
+func (k *Keystore) Decrypt(account, passphrase string) ([]byte, error) {
+	entry, ok := k.Keys[account]
+	if !ok {
+		return nil, fmt.Errorf("no key for %s in the keystore", account)
+	}
+	nonce, err := hex.DecodeString(entry.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%s: nonce: %w", account, err)
+	}
+	ciphertext, err := hex.DecodeString(entry.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ciphertext: %w", account, err)
+	}
+	aead, err := entry.cipher(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", account, err)
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%s: nonce is %d bytes, expected %d", account, len(nonce), aead.NonceSize())
+	}
+	privateKey, err := aead.Open(nil, nonce, ciphertext, entry.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", account, ErrWrongPassphrase)
+	}
+	return privateKey, nil
+}
+
+// Signer decrypts account's key and returns a signer for it.
+func (k *Keystore) Signer(account, passphrase string) (*LocalSigner, error) {
+	privateKey, err := k.Decrypt(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalSigner(k.Keys[account].Key, privateKey)
+}
+
+func (e KeystoreEntry) cipher(passphrase string) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(e.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("salt: %w", err)
+	}
+	derived, err := scrypt.Key([]byte(passphrase), salt, e.Scrypt.N, e.Scrypt.R, e.Scrypt.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("scrypt: %w", err)
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e KeystoreEntry) additionalData() []byte {
+	return []byte(strings.Join([]string{e.Key.Account, e.Key.Address, fmt.Sprint(e.Key.Index), e.Key.SigAlgo, e.Key.HashAlgo}, "\x00"))
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testScrypt keeps the tests fast; real keys use DefaultScrypt.
+var testScrypt = ScryptParams{N: 1 << 10, R: 8, P: 1}
+
+var librarianKey = AccountKey{
+	Account:  "mainnet-Librarian",
+	Address:  "0x6d96bf7d95a8b595",
+	SigAlgo:  DefaultSigAlgo,
+	HashAlgo: DefaultHashAlgo,
+}
+
+func testPrivateKey(t *testing.T) []byte {
+	key, err := ParsePrivateKeyHex("0x1c9b3b2a3f5d8d0c6a7e4f1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f\n")
+	require.NoError(t, err)
+	return key
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "keystore.json")
+	keystore, err := LoadKeystore(path)
+	require.NoError(t, err)
+	assert.Empty(t, keystore.Accounts())
+
+	require.NoError(t, keystore.Add(librarianKey, testPrivateKey(t), "correct horse", testScrypt))
+	require.NoError(t, keystore.Save(path))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	loaded, err := LoadKeystore(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mainnet-Librarian"}, loaded.Accounts())
+	assert.NotContains(t, loaded.Keys["mainnet-Librarian"].Ciphertext, "1c9b3b2a3f5d8d0c")
+
+	key, err := loaded.Decrypt("mainnet-Librarian", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, testPrivateKey(t), key)
+
+	_, err = loaded.Decrypt("mainnet-Librarian", "wrong horse")
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+	_, err = loaded.Decrypt("mainnet-Prime-librarian", "correct horse")
+	assert.Error(t, err)
+
+	signer, err := loaded.Signer("mainnet-Librarian", "correct horse")
+	require.NoError(t, err)
+	publicKey, err := signer.PublicKey()
+	require.NoError(t, err)
+	assert.Len(t, publicKey, 64)
+}
+
+func TestKeystoreEntryBoundToAccount(t *testing.T) {
+	keystore, err := LoadKeystore(filepath.Join(t.TempDir(), "keystore.json"))
+	require.NoError(t, err)
+	require.NoError(t, keystore.Add(librarianKey, testPrivateKey(t), "correct horse", testScrypt))
+
+	entry := keystore.Keys["mainnet-Librarian"]
+	entry.Key.Address = "0xfed1adffd14ea9d0"
+	keystore.Keys["mainnet-Librarian"] = entry
+	_, err = keystore.Decrypt("mainnet-Librarian", "correct horse")
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+}
+
+func TestKeystoreRefusesBadInput(t *testing.T) {
+	keystore, err := LoadKeystore(filepath.Join(t.TempDir(), "keystore.json"))
+	require.NoError(t, err)
+	assert.Error(t, keystore.Add(librarianKey, testPrivateKey(t), "", testScrypt))
+	assert.Error(t, keystore.Add(librarianKey, []byte{1, 2, 3}, "correct horse", testScrypt))
+
+	secp := librarianKey
+	secp.SigAlgo = "ECDSA_secp256k1"
+	assert.Error(t, keystore.Add(secp, testPrivateKey(t), "correct horse", testScrypt))
+
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 7, "keys": {}}`), 0o600))
+	_, err = LoadKeystore(path)
+	assert.Error(t, err)
+}
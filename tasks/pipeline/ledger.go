@@ -0,0 +1,260 @@
+package pipeline
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Ledger statuses
+const (
+	StatusSealed = "sealed"
+	StatusFailed = "failed"
+)
+
+// LedgerEntry is one line of a book's upload ledger: a single transaction
+// sent for the book, and what it carried.
+type LedgerEntry struct {
+	Network     string    `json:"network"`
+	Book        string    `json:"book"`
+	Action      string    `json:"action"`
+	Chapter     string    `json:"chapter,omitempty"`
+	Index       int       `json:"index"`
+	ContentHash string    `json:"contentHash,omitempty"`
+	Paragraphs  int       `json:"paragraphs"`
+	TxID        string    `json:"txId,omitempty"`
+	BlockHeight uint64    `json:"blockHeight,omitempty"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	// Librarian, Reviewer and Note record an admin's review of a librarian submission.
+	Librarian string `json:"librarian,omitempty"`
+	Reviewer  string `json:"reviewer,omitempty"`
+	Note      string `json:"note,omitempty"`
+	// Keeper is the address an account/add_keeper transaction assigned to the book.
+	Keeper string `json:"keeper,omitempty"`
+	// Page is the page an image upload appended to the chapter, as in its file name
+	// ("p011", "p096-097", "p000x1"; see PageRef). A page too large for one transaction is sent in Chunks
+	// parts; Chunk numbers them from 1.
+	Page   string `json:"page,omitempty"`
+	Chunk  int    `json:"chunk,omitempty"`
+	Chunks int    `json:"chunks,omitempty"`
+	// ImageHash is the content hash of the page image as encoded (see HashImage), which
+	// identifies it on-chain whatever paragraphs carry it.
+	ImageHash string `json:"imageHash,omitempty"`
+}
+
+// Ledger is an append-only JSON-lines file recording every transaction the
+// uploader sent for one book. It holds no keys or signatures, so it can be
+// committed next to the book's section files.
+type Ledger struct {
+	Path    string
+	entries []LedgerEntry
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// LedgerPath returns the ledger file for bookTitle inside dir,
+// e.g. books/ledger/Ecce_Homo.jsonl
+func LedgerPath(dir, bookTitle string) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(bookTitle, "_"), "_")
+	return filepath.Join(dir, name+".jsonl")
+}
+
+// OpenLedger loads the ledger at path. A missing file is an empty ledger;
+// it is created on the first Append.
+func OpenLedger(path string) (*Ledger, error) {
+	l := &Ledger{Path: path}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry LedgerEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		l.entries = append(l.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append writes entry to the end of the ledger and syncs it to disk, so an
+// interrupted upload never loses the record of a transaction already sent.
+func (l *Ledger) Append(entry LedgerEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+// Entries returns every entry in the order it was written.
+func (l *Ledger) Entries() []LedgerEntry {
+	return l.entries
+}
+
+// Latest returns, for each chapter, the most recent entry on network for
+// the given action. Book-level actions are keyed by the empty chapter title.
+func (l *Ledger) Latest(network, action string) map[string]LedgerEntry {
+	latest := map[string]LedgerEntry{}
+	for _, entry := range l.entries {
+		if entry.Network != network || entry.Action != action {
+			continue
+		}
+		latest[entry.Chapter] = entry
+	}
+	return latest
+}
+
+// Sealed reports whether the latest entry for chapter on network for the
+// given action is sealed and carried contentHash. An empty contentHash
+// matches any content.
+func (l *Ledger) Sealed(network, action, chapter, contentHash string) bool {
+	entry, ok := l.Latest(network, action)[chapter]
+	if !ok || entry.Status != StatusSealed {
+		return false
+	}
+	return contentHash == "" || entry.ContentHash == contentHash
+}
+
+// PageAction appends one page image to a chapter.
+const PageAction = "Admin/add_paragraph_to_chapter"
+
+// SealedPages returns the pages of chapter on network whose upload is sealed, by page
+// label: pages sent whole, and pages with every chunk sealed. The first page of a
+// chapter an image upload creates is sent in its Admin/add_chapter transaction, whose
+// entry carries the page like a PageAction one.
+func (l *Ledger) SealedPages(network, chapter string) map[string]LedgerEntry {
+	pages := map[string]LedgerEntry{}
+	for _, entry := range l.sealedPageEntries(network, chapter) {
+		if entry.Chunks == 0 || len(l.SealedChunks(network, chapter, entry.Page, entry.ContentHash)) == entry.Chunks {
+			pages[entry.Page] = entry
+		}
+	}
+	return pages
+}
+
+// PartialPages returns the pages of chapter on network that were sent in chunks and
+// have only some of them sealed, by page label, with the content hash of the page.
+func (l *Ledger) PartialPages(network, chapter string) map[string]string {
+	complete := l.SealedPages(network, chapter)
+	partial := map[string]string{}
+	for _, entry := range l.sealedPageEntries(network, chapter) {
+		if _, ok := complete[entry.Page]; !ok && entry.Chunks > 0 {
+			partial[entry.Page] = entry.ContentHash
+		}
+	}
+	return partial
+}
+
+// SealedChunks returns which chunks of a page, sent in chunks with contentHash, are sealed.
+func (l *Ledger) SealedChunks(network, chapter, page, contentHash string) map[int]bool {
+	chunks := map[int]bool{}
+	for _, entry := range l.sealedPageEntries(network, chapter) {
+		if entry.Page == page && entry.Chunks > 0 && entry.ContentHash == contentHash {
+			chunks[entry.Chunk] = true
+		}
+	}
+	return chunks
+}
+
+func (l *Ledger) sealedPageEntries(network, chapter string) []LedgerEntry {
+	var entries []LedgerEntry
+	for _, entry := range l.entries {
+		if entry.Network == network && entry.Chapter == chapter &&
+			(entry.Action == PageAction || entry.Action == "Admin/add_chapter") &&
+			entry.Page != "" && entry.Status == StatusSealed {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// ContentActions are the ledger actions that set a chapter's content on-chain.
+var ContentActions = []string{"Admin/add_chapter", "Admin/approve_chapter", "patch"}
+
+// ContentSealed reports whether the content the chapter last received on network,
+// by upload, approved submission or patch, is sealed and has contentHash.
+func (l *Ledger) ContentSealed(network, chapter, contentHash string) bool {
+	var latest *LedgerEntry
+	for i, entry := range l.entries {
+		if entry.Network != network || entry.Chapter != chapter || entry.Status != StatusSealed {
+			continue
+		}
+		for _, action := range ContentActions {
+			if entry.Action == action {
+				latest = &l.entries[i]
+			}
+		}
+	}
+	return latest != nil && latest.ContentHash == contentHash
+}
+
+// Rejected reports whether a reviewer's last sealed decision on network about the
+// submission of chapter with contentHash, by Admin/approve_chapter or
+// Admin/reject_chapter, rejected it.
+func (l *Ledger) Rejected(network, chapter, contentHash string) bool {
+	rejected := false
+	for _, entry := range l.entries {
+		if entry.Network != network || entry.Chapter != chapter || entry.ContentHash != contentHash || entry.Status != StatusSealed {
+			continue
+		}
+		switch entry.Action {
+		case "Admin/approve_chapter":
+			rejected = false
+		case "Admin/reject_chapter":
+			rejected = true
+		}
+	}
+	return rejected
+}
+
+// HashParagraphs returns the hex SHA-256 of the paragraphs joined by
+// newlines. Paragraphs are the text exactly as sent and stored, so the hash
+// can be compared with what is read back from the chain.
+func HashParagraphs(paragraphs []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(paragraphs, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerAppendAndResume(t *testing.T) {
+	path := LedgerPath(t.TempDir(), "Ecce Homo")
+	assert.Equal(t, "Ecce_Homo.jsonl", filepath.Base(path))
+
+	ledger, err := OpenLedger(path)
+	require.NoError(t, err)
+	assert.Empty(t, ledger.Entries())
+
+	hash := HashParagraphs([]string{"Why I Am So Wise", "1."})
+	require.NoError(t, ledger.Append(LedgerEntry{
+		Network: "mainnet", Book: "Ecce Homo", Action: "Admin/add_chapter",
+		Chapter: "Chapter 1", Index: 1, ContentHash: hash, Paragraphs: 2, Status: StatusFailed,
+	}))
+	require.NoError(t, ledger.Append(LedgerEntry{
+		Network: "mainnet", Book: "Ecce Homo", Action: "Admin/add_chapter",
+		Chapter: "Chapter 1", Index: 1, ContentHash: hash, Paragraphs: 2, Status: StatusSealed,
+	}))
+
+	reopened, err := OpenLedger(path)
+	require.NoError(t, err)
+	require.Len(t, reopened.Entries(), 2)
+	assert.False(t, reopened.Entries()[0].Timestamp.IsZero())
+
+	assert.True(t, reopened.Sealed("mainnet", "Admin/add_chapter", "Chapter 1", hash))
+	assert.True(t, reopened.Sealed("mainnet", "Admin/add_chapter", "Chapter 1", ""))
+	assert.False(t, reopened.Sealed("mainnet", "Admin/add_chapter", "Chapter 1", HashParagraphs([]string{"changed"})))
+	assert.False(t, reopened.Sealed("testnet", "Admin/add_chapter", "Chapter 1", hash))
+	assert.False(t, reopened.Sealed("mainnet", "Admin/add_chapter", "Chapter 2", hash))
+}
+
+func TestLedgerContentSealed(t *testing.T) {
+	ledger, err := OpenLedger(LedgerPath(t.TempDir(), "Ecce Homo"))
+	require.NoError(t, err)
+
+	uploaded := HashParagraphs([]string{"Why I Am So Wise", "1."})
+	patched := HashParagraphs([]string{"Why I Am So Wise", "1!"})
+	require.NoError(t, ledger.Append(LedgerEntry{
+		Network: "mainnet", Action: "Admin/add_chapter", Chapter: "Chapter 1", ContentHash: uploaded, Status: StatusSealed,
+	}))
+	assert.True(t, ledger.ContentSealed("mainnet", "Chapter 1", uploaded))
+
+	require.NoError(t, ledger.Append(LedgerEntry{
+		Network: "mainnet", Action: "patch", Chapter: "Chapter 1", ContentHash: patched, Status: StatusFailed,
+	}))
+	assert.True(t, ledger.ContentSealed("mainnet", "Chapter 1", uploaded))
+
+	require.NoError(t, ledger.Append(LedgerEntry{
+		Network: "mainnet", Action: "patch", Chapter: "Chapter 1", ContentHash: patched, Status: StatusSealed,
+	}))
+	assert.True(t, ledger.ContentSealed("mainnet", "Chapter 1", patched))
+	assert.False(t, ledger.ContentSealed("mainnet", "Chapter 1", uploaded))
+	assert.False(t, ledger.ContentSealed("testnet", "Chapter 1", patched))
+}
+
+func TestLedgerSealedPages(t *testing.T) {
+	ledger, err := OpenLedger(LedgerPath(t.TempDir(), "Berserk"))
+	require.NoError(t, err)
+	page := func(chapter, label, status string) LedgerEntry {
+		return LedgerEntry{Network: "mainnet", Action: PageAction, Chapter: chapter, Page: label, ContentHash: "h" + label, Status: status}
+	}
+	chunk := func(label string, chunk, chunks int, hash string) LedgerEntry {
+		entry := page("Chapter I", label, StatusSealed)
+		entry.Chunk, entry.Chunks, entry.ContentHash = chunk, chunks, hash
+		return entry
+	}
+	for _, entry := range []LedgerEntry{
+		page("Chapter I", "p000", StatusSealed),
+		page("Chapter I", "p000x1", StatusSealed),
+		page("Chapter I", "p011", StatusSealed),
+		page("Chapter I", "p012", StatusFailed),
+		page("Chapter I", "p012", StatusSealed),
+		page("Chapter I", "p013", StatusFailed),
+		page("Chapter II", "p041", StatusSealed),
+		// Chapter III was created with its first page
+		{Network: "mainnet", Action: "Admin/add_chapter", Chapter: "Chapter III", Page: "p061", ContentHash: "hp061", Status: StatusSealed},
+		page("Chapter III", "p062", StatusSealed),
+		// a text chapter is created with no page
+		{Network: "mainnet", Action: "Admin/add_chapter", Chapter: "Chapter I", ContentHash: "text", Status: StatusSealed},
+		{Network: "testnet", Action: PageAction, Chapter: "Chapter I", Page: "p014", Status: StatusSealed},
+		// a patch appends paragraphs with no page
+		{Network: "mainnet", Action: PageAction, Chapter: "Chapter I", Status: StatusSealed},
+		// p020 is sent in three chunks, p021 in two, first with other content
+		chunk("p020", 1, 3, "a"),
+		chunk("p020", 2, 3, "a"),
+		chunk("p020", 3, 3, "a"),
+		chunk("p021", 1, 2, "old"),
+		chunk("p021", 1, 2, "b"),
+	} {
+		require.NoError(t, ledger.Append(entry))
+	}
+	pages := ledger.SealedPages("mainnet", "Chapter I")
+	var labels []string
+	for label := range pages {
+		labels = append(labels, label)
+	}
+	assert.ElementsMatch(t, []string{"p000", "p000x1", "p011", "p012", "p020"}, labels)
+	assert.Equal(t, map[string]string{"p021": "b"}, ledger.PartialPages("mainnet", "Chapter I"))
+	assert.Equal(t, map[int]bool{1: true}, ledger.SealedChunks("mainnet", "Chapter I", "p021", "b"))
+	assert.Empty(t, ledger.SealedChunks("mainnet", "Chapter I", "p021", "c"))
+	assert.Len(t, ledger.SealedPages("mainnet", "Chapter III"), 2)
+	assert.Contains(t, ledger.SealedPages("mainnet", "Chapter III"), "p061")
+}
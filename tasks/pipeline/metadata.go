@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/onflow/cadence"
+)
+
+// BookMetadata is what the uploader stores in a book's extra dictionary. Each field is
+// stored under its JSON name, as a String or an Int; zero fields are not stored.
+type BookMetadata struct {
+	Language string `json:"language,omitempty"`
+	// PublicationYear is the year the work was first published, not the edition's.
+	PublicationYear int    `json:"publicationYear,omitempty"`
+	Translator      string `json:"translator,omitempty"`
+	SourceURL       string `json:"sourceUrl,omitempty"`
+	License         string `json:"license,omitempty"`
+	ISBN            string `json:"isbn,omitempty"`
+	Series          string `json:"series,omitempty"`
+	WordCount       int    `json:"wordCount,omitempty"`
+}
+
+// ChapterMetadata is what the uploader stores in a chapter's extra dictionary.
+type ChapterMetadata struct {
+	WordCount int `json:"wordCount,omitempty"`
+	// Spreads are the positions of an image chapter's double-page spreads (see
+	// ParseSpreads).
+	Spreads string `json:"spreads,omitempty"`
+}
+
+// Metadata is a set of extra keys and their values, as read from or sent to the chain.
+type Metadata map[string]interface{}
+
+// OnChainMetadata is the output of get_book_metadata: the book's extra dictionary and
+// each chapter's, by chapter title.
+type OnChainMetadata struct {
+	Book     Metadata            `json:"book"`
+	Chapters map[string]Metadata `json:"chapters"`
+}
+
+// Merge returns m with its empty fields taken from fallback.
+func (m BookMetadata) Merge(fallback BookMetadata) BookMetadata {
+	merged := reflect.ValueOf(&m).Elem()
+	other := reflect.ValueOf(fallback)
+	for i := 0; i < merged.NumField(); i++ {
+		if merged.Field(i).IsZero() {
+			merged.Field(i).Set(other.Field(i))
+		}
+	}
+	return m
+}
+
+// MetadataFields returns the non-zero fields of a BookMetadata or ChapterMetadata by key.
+func MetadataFields(metadata interface{}) Metadata {
+	fields := Metadata{}
+	v := reflect.ValueOf(metadata)
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Field(i).IsZero() {
+			fields[metadataKey(v.Type().Field(i))] = v.Field(i).Interface()
+		}
+	}
+	return fields
+}
+
+// DecodeMetadata fills a *BookMetadata or *ChapterMetadata from extra as read from the
+// chain. Keys it does not know are ignored; a known key with a value of the wrong type
+// is an error.
+func DecodeMetadata(extra Metadata, into interface{}) error {
+	v := reflect.ValueOf(into).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := metadataKey(v.Type().Field(i))
+		value, ok := extra[key]
+		if !ok || value == nil {
+			continue
+		}
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("metadata %s: expected a string, got %T", key, value)
+			}
+			field.SetString(s)
+		case reflect.Int:
+			n, err := metadataInt(value)
+			if err != nil {
+				return fmt.Errorf("metadata %s: %w", key, err)
+			}
+			field.SetInt(n)
+		}
+	}
+	return nil
+}
+
+// Changed returns the keys of m whose value on-chain is missing or different.
+func (m Metadata) Changed(onChain Metadata) Metadata {
+	changed := Metadata{}
+	for key, value := range m {
+		if current, ok := onChain[key]; !ok || fmt.Sprint(current) != fmt.Sprint(value) {
+			changed[key] = value
+		}
+	}
+	return changed
+}
+
+// Keys returns the metadata keys in order.
+func (m Metadata) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Arg encodes the metadata as a Cadence {String: AnyStruct} argument, with string
+// values as String and integers as Int, in key order.
+func (m Metadata) Arg() CadenceArg {
+	pairs := make([]cadence.KeyValuePair, 0, len(m))
+	for _, key := range m.Keys() {
+		var value cadence.Value
+		switch v := m[key].(type) {
+		case int:
+			value = cadence.NewInt(v)
+		default:
+			value = cadence.String(fmt.Sprint(v))
+		}
+		pairs = append(pairs, cadence.KeyValuePair{Key: cadence.String(key), Value: value})
+	}
+	return cadence.NewDictionary(pairs).WithType(cadence.NewDictionaryType(cadence.StringType, cadence.AnyStructType))
+}
+
+func metadataKey(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
+
+// metadataInt reads an Int the way it may come back from a script: a number, a
+// big.Int, or a decimal string.
+func metadataInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, fmt.Errorf("expected an integer, got %v", v)
+		}
+		return int64(v), nil
+	case json.Number:
+		return v.Int64()
+	case *big.Int:
+		return v.Int64(), nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected an integer, got %q", v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("expected an integer, got %T", value)
+}
+
+// WordCount counts the whitespace-separated words in paragraphs.
+func WordCount(paragraphs []string) int {
+	count := 0
+	for _, paragraph := range paragraphs {
+		count += len(strings.Fields(paragraph))
+	}
+	return count
+}
+
+var (
+	headerLine      = regexp.MustCompile(`^_?([A-Z][A-Za-z ]+):_?\s*(.*)$`)
+	gutenbergNumber = regexp.MustCompile(`\[e[Bb]ook #(\d+)\]`)
+	fadedPageNumber = regexp.MustCompile(`Faded Page eBook #(\d+)`)
+	yearPattern     = regexp.MustCompile(`\b(1[0-9]{3}|20[0-9]{2})\b`)
+)
+
+// ParseSourceHeader extracts metadata from the header of a Project Gutenberg or Faded
+// Page text: language, translator(s), original publication year, the source URL and
+// its licence. It reads up to the "*** START OF" line, or the first 100 lines.
+func ParseSourceHeader(r io.Reader) (BookMetadata, error) {
+	var metadata BookMetadata
+	fields := map[string]string{}
+	lastKey := ""
+	scanner := bufio.NewScanner(r)
+	canadianPublicDomain := false
+	for line := 0; line < 100 && scanner.Scan(); line++ {
+		text := strings.TrimPrefix(scanner.Text(), "\ufeff")
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "*** START OF") {
+			break
+		}
+		if strings.Contains(trimmed, "Canadian public domain") {
+			canadianPublicDomain = true
+		}
+		if m := fadedPageNumber.FindStringSubmatch(trimmed); m != nil {
+			metadata.SourceURL = "https://www.fadedpage.com/showbook.php?pid=" + m[1]
+		}
+		if m := headerLine.FindStringSubmatch(trimmed); m != nil && text == trimmed {
+			lastKey = strings.ToLower(m[1])
+			fields[lastKey] = m[2]
+			continue
+		}
+		// Indented lines continue the previous field, e.g. a second translator.
+		if trimmed != "" && text != trimmed && lastKey != "" && !strings.Contains(trimmed, ":") {
+			fields[lastKey] += ", " + trimmed
+			continue
+		}
+		lastKey = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return metadata, err
+	}
+
+	metadata.Language = fields["language"]
+	metadata.Translator = fields["translator"]
+	for _, key := range []string{"original publication", "date of first publication"} {
+		if m := yearPattern.FindString(fields[key]); m != "" {
+			metadata.PublicationYear, _ = strconv.Atoi(m)
+			break
+		}
+	}
+	if m := gutenbergNumber.FindStringSubmatch(fields["release date"]); m != nil {
+		metadata.SourceURL = "https://www.gutenberg.org/ebooks/" + m[1]
+		metadata.License = "Project Gutenberg License"
+	} else if metadata.SourceURL != "" && canadianPublicDomain {
+		metadata.License = "Public domain in Canada"
+	}
+	return metadata, nil
+}
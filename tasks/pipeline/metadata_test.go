@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const gutenbergHeader = `The Project Gutenberg eBook of Ecce Homo
+
+Title: Ecce Homo
+
+Author: Friedrich Wilhelm Nietzsche
+
+Translator: Paul V. Cohn
+        Anthony M. Ludovici
+
+Release date: May 30, 2016 [eBook #52190]
+                Most recently updated: January 27, 2025
+
+Language: English
+
+*** START OF THE PROJECT GUTENBERG EBOOK ECCE HOMO ***
+Language: German
+`
+
+const fadedPageHeader = "\ufeff=* A Distributed Proofreaders Canada eBook *=\n" + `
+This work is in the Canadian public domain, but may be under copyright
+in some countries.
+
+_Title:_ You Only Live Twice
+_Date of first publication:_ 1964
+_Author:_ Ian Fleming (1908-1964)
+Faded Page eBook #20171118
+`
+
+func TestParseSourceHeader(t *testing.T) {
+	metadata, err := ParseSourceHeader(strings.NewReader(gutenbergHeader))
+	require.NoError(t, err)
+	assert.Equal(t, BookMetadata{
+		Language:   "English",
+		Translator: "Paul V. Cohn, Anthony M. Ludovici",
+		SourceURL:  "https://www.gutenberg.org/ebooks/52190",
+		License:    "Project Gutenberg License",
+	}, metadata)
+
+	metadata, err = ParseSourceHeader(strings.NewReader(fadedPageHeader))
+	require.NoError(t, err)
+	assert.Equal(t, BookMetadata{
+		PublicationYear: 1964,
+		SourceURL:       "https://www.fadedpage.com/showbook.php?pid=20171118",
+		License:         "Public domain in Canada",
+	}, metadata)
+}
+
+func TestMetadataFields(t *testing.T) {
+	manifest := BookMetadata{Language: "German", PublicationYear: 1908, ISBN: "978-0140445152"}
+	source := BookMetadata{Language: "English", SourceURL: "https://www.gutenberg.org/ebooks/52190"}
+	merged := manifest.Merge(source)
+	assert.Equal(t, "German", merged.Language)
+	assert.Equal(t, source.SourceURL, merged.SourceURL)
+
+	fields := MetadataFields(merged)
+	assert.Equal(t, []string{"isbn", "language", "publicationYear", "sourceUrl"}, fields.Keys())
+	encoded, err := EncodeArg(Metadata{"language": "German", "publicationYear": 1908}.Arg())
+	require.NoError(t, err)
+	assert.Equal(t, `{"value":[{"key":{"value":"language","type":"String"},"value":{"value":"German","type":"String"}},`+
+		`{"key":{"value":"publicationYear","type":"String"},"value":{"value":"1908","type":"Int"}}],"type":"Dictionary"}`, string(encoded))
+
+	// Values come back from a script as decoded JSON; ints may be numbers or strings.
+	var decoded BookMetadata
+	require.NoError(t, DecodeMetadata(Metadata{"language": "German", "publicationYear": float64(1908), "isbn": "978-0140445152", "sourceUrl": source.SourceURL, "shelf": "B"}, &decoded))
+	assert.Equal(t, merged, decoded)
+	var chapter ChapterMetadata
+	require.NoError(t, DecodeMetadata(Metadata{"wordCount": "4211"}, &chapter))
+	assert.Equal(t, 4211, chapter.WordCount)
+	assert.ErrorContains(t, DecodeMetadata(Metadata{"wordCount": "many"}, &chapter), "metadata wordCount")
+	assert.ErrorContains(t, DecodeMetadata(Metadata{"language": 7}, &decoded), "expected a string")
+
+	onChain := MetadataFields(decoded)
+	onChain["publicationYear"] = 1888
+	assert.Equal(t, Metadata{"publicationYear": 1908}, fields.Changed(onChain))
+	assert.Empty(t, fields.Changed(MetadataFields(decoded)))
+}
+
+func TestWordCount(t *testing.T) {
+	assert.Equal(t, 7, WordCount([]string{"Why I am so wise", "  ECCE\tHOMO  ", ""}))
+}
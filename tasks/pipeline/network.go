@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DefaultNetwork is where tasks run unless told otherwise, so a test run never
+// writes to the real library by accident.
+const DefaultNetwork = "emulator"
+
+// NetworkProfile is a named Flow network from flow.json and the accounts tasks use on it.
+type NetworkProfile struct {
+	Name string
+	// Signer is the admin account used when a book does not name its own.
+	Signer string
+	// Permanent networks hold the real library; writes to them need an explicit
+	// flag and a confirmation.
+	Permanent bool
+	// ContractAddress is where Alexandria is deployed; when empty it is read from
+	// flow.json (see FlowContractAddress).
+	ContractAddress string
+	// AccessAPI is the REST endpoint of an access node, used by the offline workflow.
+	AccessAPI string
+}
+
+// networkProfiles are the networks of flow.json that tasks run on. The testnet signer
+// and contract address come from flow.json's testnet account and Alexandria alias.
+var networkProfiles = map[string]NetworkProfile{
+	"emulator": {Name: "emulator", Signer: "account", ContractAddress: "0xf8d6e0586b0a20c7", AccessAPI: "http://127.0.0.1:8888"},
+	"testnet":  {Name: "testnet", Signer: "Prime-librarian", AccessAPI: "https://rest-testnet.onflow.org"},
+	"mainnet":  {Name: "mainnet", Signer: "Prime-librarian", Permanent: true, ContractAddress: "0xfed1adffd14ea9d0", AccessAPI: "https://rest-mainnet.onflow.org"},
+}
+
+// LookupNetwork returns the profile for name.
+func LookupNetwork(name string) (NetworkProfile, error) {
+	profile, ok := networkProfiles[name]
+	if !ok {
+		names := make([]string, 0, len(networkProfiles))
+		for n := range networkProfiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return NetworkProfile{}, fmt.Errorf("unknown network %q (expected %s)", name, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
+
+// WriteConfirmation describes a set of transactions about to be sent for one book.
+type WriteConfirmation struct {
+	Network string
+	Book    string
+	Cost    CostEstimate
+}
+
+// Token is what an operator types, or passes with -confirm, to approve exactly this
+// write. It names the network, book and transaction count, so a token approved for one
+// plan does not approve a different one.
+func (c WriteConfirmation) Token() string {
+	book := strings.Trim(unsafeFileChars.ReplaceAllString(c.Book, "_"), "_")
+	return fmt.Sprintf("%s:%s:%d", c.Network, book, c.Cost.Transactions)
+}
+
+// Summary describes the write for the confirmation prompt.
+func (c WriteConfirmation) Summary() string {
+	return fmt.Sprintf("%s: %d transactions for %q, %s", c.Network, c.Cost.Transactions, c.Book, c.Cost)
+}
+
+// WriteGuard decides whether a write may be sent to a network.
+type WriteGuard struct {
+	Profile NetworkProfile
+	// Allow is the explicit opt-in flag for permanent networks.
+	Allow bool
+	// Tokens are pre-approved confirmation tokens, for runs without a terminal.
+	Tokens []string
+	// In and Out are the terminal for interactive confirmation; a nil In means there is none.
+	In  io.Reader
+	Out io.Writer
+}
+
+// Confirm returns nil if the write may go ahead. Writes to networks that are not
+// permanent always may. A permanent network needs Allow, and then either a matching
+// pre-approved token or the token typed back at the prompt.
+func (g WriteGuard) Confirm(c WriteConfirmation) error {
+	if !g.Profile.Permanent {
+		return nil
+	}
+	if !g.Allow {
+		return fmt.Errorf("refusing to write to %s without -allow-%s (%s)", g.Profile.Name, g.Profile.Name, c.Summary())
+	}
+	token := c.Token()
+	for _, t := range g.Tokens {
+		if t == token {
+			return nil
+		}
+	}
+	if g.In == nil {
+		return fmt.Errorf("%s needs confirmation: pass -confirm %s", c.Summary(), token)
+	}
+	fmt.Fprintf(g.Out, "\nAbout to write permanently to %s\nType %s to continue: ", c.Summary(), token)
+	answer, _ := bufio.NewReader(g.In).ReadString('\n')
+	if strings.TrimSpace(answer) != token {
+		return fmt.Errorf("not confirmed; nothing was sent")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupNetwork(t *testing.T) {
+	profile, err := LookupNetwork(DefaultNetwork)
+	require.NoError(t, err)
+	assert.False(t, profile.Permanent)
+
+	profile, err = LookupNetwork("mainnet")
+	require.NoError(t, err)
+	assert.True(t, profile.Permanent)
+
+	profile, err = LookupNetwork("testnet")
+	require.NoError(t, err)
+	assert.False(t, profile.Permanent)
+	assert.Empty(t, profile.ContractAddress, "read from flow.json")
+
+	_, err = LookupNetwork("mainet")
+	assert.ErrorContains(t, err, "emulator, mainnet, testnet")
+}
+
+func TestWriteGuard(t *testing.T) {
+	mainnet, _ := LookupNetwork("mainnet")
+	emulator, _ := LookupNetwork(DefaultNetwork)
+	write := WriteConfirmation{Network: "mainnet", Book: "Ecce Homo", Cost: FeeEstimate(12)}
+	assert.Equal(t, "mainnet:Ecce_Homo:12", write.Token())
+
+	assert.NoError(t, WriteGuard{Profile: emulator}.Confirm(write))
+	assert.ErrorContains(t, WriteGuard{Profile: mainnet}.Confirm(write), "-allow-mainnet")
+	assert.ErrorContains(t, WriteGuard{Profile: mainnet, Allow: true}.Confirm(write), "-confirm mainnet:Ecce_Homo:12")
+
+	assert.NoError(t, WriteGuard{Profile: mainnet, Allow: true, Tokens: []string{"mainnet:Ecce_Homo:12"}}.Confirm(write))
+	// A token for a different plan does not approve this one.
+	assert.Error(t, WriteGuard{Profile: mainnet, Allow: true, Tokens: []string{"mainnet:Ecce_Homo:11"}}.Confirm(write))
+
+	var out bytes.Buffer
+	guard := WriteGuard{Profile: mainnet, Allow: true, In: strings.NewReader("mainnet:Ecce_Homo:12\n"), Out: &out}
+	assert.NoError(t, guard.Confirm(write))
+	assert.Contains(t, out.String(), `12 transactions for "Ecce Homo", estimated fees up to 0.0012 FLOW`)
+
+	guard.In = strings.NewReader("y\n")
+	assert.Error(t, guard.Confirm(write))
+	// Without the flag the prompt is never shown.
+	guard.Allow = false
+	assert.Error(t, guard.Confirm(write))
+}
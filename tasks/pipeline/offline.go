@@ -0,0 +1,257 @@
+package pipeline
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/onflow/flow-go-sdk"
+)
+
+// OfflineBundleVersion is the format written by OfflineBundle.Save.
+const OfflineBundleVersion = 1
+
+// Offline bundle stages, in the order a bundle goes through them.
+const (
+	OfflineUnsigned = "unsigned"
+	OfflineSigned   = "signed"
+)
+
+// DefaultGasLimit is the computation limit of offline transactions, Overflow's default.
+const DefaultGasLimit = 9999
+
+// TransactionExpiry is how many blocks after its reference block a transaction can
+// still be included. Every transaction in a bundle shares one reference block, so a
+// bundle must be signed and submitted within this many blocks of being built.
+const TransactionExpiry = 600
+
+// OfflineTx is one transaction of a bundle. The bundle's account proposes, pays for
+// and authorizes it, so it carries a single envelope signature.
+type OfflineTx struct {
+	// Entry is the ledger entry recorded when the transaction is submitted.
+	Entry LedgerEntry `json:"entry"`
+	Label string      `json:"label"`
+	// Script is the transaction's Cadence code with its imports resolved.
+	Script string `json:"script"`
+	// Arguments are the JSON-Cadence encoded arguments, in parameter order. They are
+	// stored base64 encoded, so the bytes signed are exactly the bytes sent.
+	Arguments      [][]byte `json:"arguments"`
+	GasLimit       uint64   `json:"gasLimit"`
+	SequenceNumber uint64   `json:"sequenceNumber"`
+	// Signature is the hex envelope signature; ID is set with it.
+	Signature string `json:"signature,omitempty"`
+	ID        string `json:"id,omitempty"`
+}
+
+// OfflineBundle is a set of transactions built on an online host, signed on an
+// air-gapped one and submitted, in order, by the online host again.
+type OfflineBundle struct {
+	Version int    `json:"version"`
+	Stage   string `json:"stage"`
+	Network string `json:"network"`
+	Book    string `json:"book"`
+	// Key is the account key that proposes, pays for and authorizes every transaction;
+	// PublicKey is its hex public key as read from the chain when the bundle was built.
+	Key       AccountKey `json:"key"`
+	PublicKey string     `json:"publicKey"`
+	// SequenceNumber is the key's sequence number when the bundle was built; the
+	// transactions use it and the numbers after it, in order.
+	SequenceNumber       uint64      `json:"sequenceNumber"`
+	ReferenceBlockID     string      `json:"referenceBlockId"`
+	ReferenceBlockHeight uint64      `json:"referenceBlockHeight"`
+	Built                time.Time   `json:"built"`
+	Signed               time.Time   `json:"signed,omitempty"`
+	Transactions         []OfflineTx `json:"transactions"`
+}
+
+// OfflinePath returns where a book's bundle at stage is kept inside dir,
+// e.g. books/offline/Ecce_Homo.unsigned.json
+func OfflinePath(dir, bookTitle, stage string) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(bookTitle, "_"), "_")
+	return filepath.Join(dir, name+"."+stage+".json")
+}
+
+// LoadOfflineBundle reads the bundle at path.
+func LoadOfflineBundle(path string) (*OfflineBundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var bundle OfflineBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if bundle.Version != OfflineBundleVersion {
+		return nil, fmt.Errorf("%s: unsupported bundle version %d", path, bundle.Version)
+	}
+	return &bundle, nil
+}
+
+// Save writes the bundle to path.
+func (b *OfflineBundle) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// AddTransaction appends a transaction with the next sequence number.
+func (b *OfflineBundle) AddTransaction(entry LedgerEntry, label, script string, args ...CadenceArg) error {
+	tx := OfflineTx{
+		Entry:          entry,
+		Label:          label,
+		Script:         script,
+		GasLimit:       DefaultGasLimit,
+		SequenceNumber: b.SequenceNumber + uint64(len(b.Transactions)),
+	}
+	for _, arg := range args {
+		encoded, err := EncodeArg(arg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Action, err)
+		}
+		tx.Arguments = append(tx.Arguments, encoded)
+	}
+	b.Transactions = append(b.Transactions, tx)
+	return nil
+}
+
+// Sign signs every transaction of an unsigned bundle with signer, which must hold the
+// bundle's account key.
+func (b *OfflineBundle) Sign(signer Signer, now time.Time) error {
+	if b.Stage != OfflineUnsigned {
+		return fmt.Errorf("bundle is %s, not %s", b.Stage, OfflineUnsigned)
+	}
+	key := signer.AccountKey()
+	if key.Address != b.Key.Address || key.Index != b.Key.Index {
+		return fmt.Errorf("signer is key %d of %s; the bundle needs key %d of %s", key.Index, key.Address, b.Key.Index, b.Key.Address)
+	}
+	publicKey, err := signer.PublicKey()
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(hex.EncodeToString(publicKey), strings.TrimPrefix(b.PublicKey, "0x")) {
+		return errors.New("the signer's public key is not the account key on-chain")
+	}
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		flowTx, err := b.Transaction(*tx)
+		if err != nil {
+			return err
+		}
+		signature, err := signer.Sign(envelopeMessage(flowTx))
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", tx.Entry.Action, tx.Entry.Chapter, err)
+		}
+		flowTx.AddEnvelopeSignature(flowTx.Payer, flowTx.ProposalKey.KeyIndex, signature)
+		tx.Signature, tx.ID = hex.EncodeToString(signature), flowTx.ID().Hex()
+	}
+	b.Stage, b.Signed = OfflineSigned, now
+	return nil
+}
+
+// Verify checks that every transaction of a signed bundle is signed by the bundle's
+// public key and has the ID it claims.
+func (b *OfflineBundle) Verify() error {
+	if b.Stage != OfflineSigned {
+		return fmt.Errorf("bundle is %s, not %s", b.Stage, OfflineSigned)
+	}
+	publicKey, err := hex.DecodeString(strings.TrimPrefix(b.PublicKey, "0x"))
+	if err != nil {
+		return fmt.Errorf("public key: %w", err)
+	}
+	for _, tx := range b.Transactions {
+		flowTx, err := b.Transaction(tx)
+		if err != nil {
+			return err
+		}
+		if len(flowTx.EnvelopeSignatures) != 1 {
+			return fmt.Errorf("%s %s: not signed", tx.Entry.Action, tx.Entry.Chapter)
+		}
+		ok, err := VerifySignature(publicKey, b.Key.HashAlgo, envelopeMessage(flowTx), flowTx.EnvelopeSignatures[0].Signature)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s %s: the signature does not match the bundle's key", tx.Entry.Action, tx.Entry.Chapter)
+		}
+		if id := flowTx.ID().Hex(); id != tx.ID {
+			return fmt.Errorf("%s %s: ID %s does not match its contents (%s)", tx.Entry.Action, tx.Entry.Chapter, tx.ID, id)
+		}
+	}
+	return nil
+}
+
+// Expired reports whether the bundle's reference block is too old at sealedHeight for
+// its transactions to be included; margin blocks are kept in reserve for sealing.
+func (b *OfflineBundle) Expired(sealedHeight, margin uint64) bool {
+	return sealedHeight+margin >= b.ReferenceBlockHeight+TransactionExpiry
+}
+
+// Transaction builds tx as a Flow transaction: the bundle's key proposes, pays for and
+// authorizes it, and once tx is signed it carries the envelope signature.
+func (b *OfflineBundle) Transaction(tx OfflineTx) (*flow.Transaction, error) {
+	blockID, err := hex.DecodeString(b.ReferenceBlockID)
+	if err != nil || len(blockID) != len(flow.Identifier{}) {
+		return nil, fmt.Errorf("invalid reference block ID %q", b.ReferenceBlockID)
+	}
+	canonical, err := ParseAddress(b.Key.Address)
+	if err != nil {
+		return nil, err
+	}
+	address, keyIndex := flow.HexToAddress(canonical), uint32(b.Key.Index)
+	flowTx := flow.NewTransaction().
+		SetScript([]byte(tx.Script)).
+		SetReferenceBlockID(flow.BytesToID(blockID)).
+		SetComputeLimit(tx.GasLimit).
+		SetProposalKey(address, keyIndex, tx.SequenceNumber).
+		SetPayer(address).
+		AddAuthorizer(address)
+	for _, arg := range tx.Arguments {
+		flowTx.AddRawArgument(arg)
+	}
+	if tx.Signature != "" {
+		signature, err := hex.DecodeString(tx.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: signature: %w", tx.Entry.Action, tx.Entry.Chapter, err)
+		}
+		flowTx.AddEnvelopeSignature(address, keyIndex, signature)
+	}
+	return flowTx, nil
+}
+
+// envelopeMessage is what the account signs: the transaction domain tag, then the
+// envelope.
+func envelopeMessage(tx *flow.Transaction) []byte {
+	return append(append([]byte{}, flow.TransactionDomainTag[:]...), tx.EnvelopeMessage()...)
+}
+
+var stringImport = regexp.MustCompile(`(?m)^(\s*)import\s+"(\w+)"`)
+
+// ResolveImports rewrites the `import "Contract"` lines of Cadence code to import the
+// contract from its address, as the access node needs them.
+func ResolveImports(code string, addresses map[string]string) (string, error) {
+	var missing []string
+	resolved := stringImport.ReplaceAllStringFunc(code, func(line string) string {
+		m := stringImport.FindStringSubmatch(line)
+		address, ok := addresses[m[2]]
+		if !ok || address == "" {
+			missing = append(missing, m[2])
+			return line
+		}
+		return fmt.Sprintf("%simport %s from %s", m[1], m[2], address)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("no address for imported contracts: %s", strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
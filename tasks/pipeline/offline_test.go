@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onflow/flow-go-sdk"
+	"github.com/onflow/flow-go-sdk/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const addChapterScript = `import "Alexandria"
+
+transaction(bookTitle: String, chapterTitle: String) {
+    prepare(signer: auth(BorrowValue) &Account) {}
+}
+`
+
+// testBundle returns an unsigned bundle of two transactions for the librarian key, and
+// a signer holding that key.
+func testBundle(t *testing.T) (*OfflineBundle, Signer) {
+	signer, err := NewLocalSigner(librarianKey, testPrivateKey(t))
+	require.NoError(t, err)
+	publicKey, err := signer.PublicKey()
+	require.NoError(t, err)
+
+	bundle := &OfflineBundle{
+		Version:              OfflineBundleVersion,
+		Stage:                OfflineUnsigned,
+		Network:              "mainnet",
+		Book:                 "Ecce Homo",
+		Key:                  librarianKey,
+		PublicKey:            hex.EncodeToString(publicKey),
+		SequenceNumber:       41,
+		ReferenceBlockID:     strings.Repeat("ab", 32),
+		ReferenceBlockHeight: 1000,
+		Built:                time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+	}
+	script, err := ResolveImports(addChapterScript, map[string]string{"Alexandria": "0xfed1adffd14ea9d0"})
+	require.NoError(t, err)
+	for _, chapter := range []string{"Preface", "Why I Am So Wise"} {
+		entry := LedgerEntry{Network: "mainnet", Book: "Ecce Homo", Action: "Admin/add_chapter_name", Chapter: chapter}
+		require.NoError(t, bundle.AddTransaction(entry, chapter, script, StringArg("Ecce Homo"), StringArg(chapter)))
+	}
+	return bundle, signer
+}
+
+func TestOfflineBundleSignAndVerify(t *testing.T) {
+	bundle, signer := testBundle(t)
+	assert.Equal(t, uint64(41), bundle.Transactions[0].SequenceNumber)
+	assert.Equal(t, uint64(42), bundle.Transactions[1].SequenceNumber)
+	assert.Contains(t, bundle.Transactions[0].Script, "import Alexandria from 0xfed1adffd14ea9d0")
+	assert.Error(t, bundle.Verify(), "an unsigned bundle does not verify")
+
+	signed := time.Date(2026, 10, 19, 12, 5, 0, 0, time.UTC)
+	require.NoError(t, bundle.Sign(signer, signed))
+	assert.Equal(t, OfflineSigned, bundle.Stage)
+	assert.Equal(t, signed, bundle.Signed)
+	require.NoError(t, bundle.Verify())
+	assert.Len(t, bundle.Transactions[0].ID, 64)
+	assert.NotEqual(t, bundle.Transactions[0].ID, bundle.Transactions[1].ID)
+	assert.Error(t, bundle.Sign(signer, signed), "a signed bundle is not signed again")
+
+	path := filepath.Join(t.TempDir(), "offline", OfflinePath("", "Ecce Homo", OfflineSigned))
+	assert.Equal(t, "Ecce_Homo.signed.json", filepath.Base(path))
+	require.NoError(t, bundle.Save(path))
+	loaded, err := LoadOfflineBundle(path)
+	require.NoError(t, err)
+	require.NoError(t, loaded.Verify())
+	assert.Equal(t, bundle.Transactions, loaded.Transactions)
+}
+
+func TestOfflineBundleTransaction(t *testing.T) {
+	bundle, signer := testBundle(t)
+	require.NoError(t, bundle.Sign(signer, time.Now()))
+	tx := bundle.Transactions[1]
+	flowTx, err := bundle.Transaction(tx)
+	require.NoError(t, err)
+
+	address := flow.HexToAddress("6d96bf7d95a8b595")
+	assert.Equal(t, flow.ProposalKey{Address: address, KeyIndex: 0, SequenceNumber: 42}, flowTx.ProposalKey)
+	assert.Equal(t, address, flowTx.Payer)
+	assert.Equal(t, []flow.Address{address}, flowTx.Authorizers)
+	assert.Equal(t, tx.ID, flowTx.ID().Hex())
+
+	// The signature verifies with Flow's own crypto over the SDK's envelope message.
+	publicKey, err := crypto.DecodePublicKeyHex(crypto.ECDSA_P256, bundle.PublicKey)
+	require.NoError(t, err)
+	require.Len(t, flowTx.EnvelopeSignatures, 1)
+	message := append(flow.TransactionDomainTag[:], flowTx.EnvelopeMessage()...)
+	ok, err := publicKey.Verify(flowTx.EnvelopeSignatures[0].Signature, message, crypto.NewSHA3_256())
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The transaction survives Flow's canonical encoding with the same ID.
+	decoded, err := flow.DecodeTransaction(flowTx.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, tx.ID, decoded.ID().Hex())
+}
+
+func TestOfflineBundleDetectsTampering(t *testing.T) {
+	bundle, signer := testBundle(t)
+	require.NoError(t, bundle.Sign(signer, time.Now()))
+
+	tampered := *bundle
+	tampered.Transactions = append([]OfflineTx(nil), bundle.Transactions...)
+	arg, err := EncodeArg(StringArg("Ecce Homo, abridged"))
+	require.NoError(t, err)
+	tampered.Transactions[1].Arguments = [][]byte{arg, tampered.Transactions[1].Arguments[1]}
+	assert.ErrorContains(t, tampered.Verify(), "signature does not match")
+
+	tampered = *bundle
+	tampered.Transactions = append([]OfflineTx(nil), bundle.Transactions...)
+	tampered.Transactions[0].ID = bundle.Transactions[1].ID
+	assert.ErrorContains(t, tampered.Verify(), "does not match its contents")
+
+	tampered = *bundle
+	tampered.ReferenceBlockID = strings.Repeat("cd", 32)
+	assert.Error(t, tampered.Verify())
+}
+
+func TestOfflineBundleSignerMustHoldTheKey(t *testing.T) {
+	bundle, _ := testBundle(t)
+
+	other := librarianKey
+	other.Index = 1
+	signer, err := NewLocalSigner(other, testPrivateKey(t))
+	require.NoError(t, err)
+	assert.ErrorContains(t, bundle.Sign(signer, time.Now()), "needs key 0")
+
+	kms := NewLocalKMS()
+	_, err = kms.CreateKey("librarian")
+	require.NoError(t, err)
+	assert.ErrorContains(t, bundle.Sign(KMSSigner{Key: librarianKey, KMS: kms, KeyID: "librarian"}, time.Now()), "not the account key on-chain")
+	assert.Equal(t, OfflineUnsigned, bundle.Stage)
+}
+
+func TestOfflineBundleExpired(t *testing.T) {
+	bundle, _ := testBundle(t)
+	assert.False(t, bundle.Expired(1000, 30))
+	assert.False(t, bundle.Expired(1569, 30))
+	assert.True(t, bundle.Expired(1570, 30))
+	assert.True(t, bundle.Expired(1600, 0))
+}
+
+func TestResolveImports(t *testing.T) {
+	code := "import \"Alexandria\"\nimport \"FlowToken\"\n\ntransaction {}\n"
+	resolved, err := ResolveImports(code, map[string]string{"Alexandria": "0xfed1adffd14ea9d0", "FlowToken": "0x1654653399040a61"})
+	require.NoError(t, err)
+	assert.Equal(t, "import Alexandria from 0xfed1adffd14ea9d0\nimport FlowToken from 0x1654653399040a61\n\ntransaction {}\n", resolved)
+
+	_, err = ResolveImports(code, map[string]string{"Alexandria": "0xfed1adffd14ea9d0"})
+	assert.ErrorContains(t, err, "FlowToken")
+	_, err = ResolveImports(code, map[string]string{"Alexandria": "", "FlowToken": "0x1654653399040a61"})
+	assert.ErrorContains(t, err, "Alexandria")
+}
@@ -0,0 +1,237 @@
+package pipeline
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PageRef is a page's place in a chapter: its number, the last page it covers (a
+// spread like p096-097 covers two), its variant (the 1 of p000x1, an alternative
+// version of p000) and, for the halves of a split spread named for one page, its part
+// (p006a and p006b are parts 1 and 2 of p006).
+type PageRef struct {
+	Number, Last, Variant, Part int
+}
+
+// Label writes the page as in file names: "p011", "p096-097", "p000x1" or "p006a".
+func (r PageRef) Label() string {
+	label := PageLabel(r.Number)
+	if r.Last > r.Number {
+		label += fmt.Sprintf("-%03d", r.Last)
+	}
+	if r.Variant > 0 {
+		label += fmt.Sprintf("x%d", r.Variant)
+	}
+	if r.Part > 0 {
+		label += string(rune('a' + r.Part - 1))
+	}
+	return label
+}
+
+// Before reports whether r is stored before other: by page number, then a page before
+// its variants, in variant order, then by part.
+func (r PageRef) Before(other PageRef) bool {
+	if r.Number != other.Number {
+		return r.Number < other.Number
+	}
+	if r.Variant != other.Variant {
+		return r.Variant < other.Variant
+	}
+	if r.Part != other.Part {
+		return r.Part < other.Part
+	}
+	return r.Last < other.Last
+}
+
+var pageRefLabel = regexp.MustCompile(`^p(\d+)(?:-p?(\d+))?(?:x(\d+))?([ab])?$`)
+
+// ParsePageRef parses a page label as written by Label.
+func ParsePageRef(label string) (PageRef, error) {
+	m := pageRefLabel.FindStringSubmatch(strings.TrimSpace(label))
+	if m == nil {
+		return PageRef{}, fmt.Errorf("invalid page %q (expected a page like p011, p096-097 or p000x1)", label)
+	}
+	ref := pageRefFromMatch(m[1], m[2], m[3])
+	if ref.Last < ref.Number {
+		return PageRef{}, fmt.Errorf("invalid page %q: the range ends before it starts", label)
+	}
+	if m[4] != "" {
+		ref.Part = int(m[4][0]-'a') + 1
+	}
+	return ref, nil
+}
+
+func pageRefFromMatch(first, last, variant string) PageRef {
+	var ref PageRef
+	ref.Number, _ = strconv.Atoi(first)
+	ref.Last = ref.Number
+	if last != "" {
+		ref.Last, _ = strconv.Atoi(last)
+	}
+	if variant != "" {
+		ref.Variant, _ = strconv.Atoi(variant)
+	}
+	return ref
+}
+
+// PageName is what a page image's file name says about it, in the naming of digital
+// releases ("Berserk - 002 (v01) - p096-097 [Digital][Cyborgzx-repack].png") and of
+// scanlations ("Berserk v01 c002 p096.jpg", "Berserk_Ch.2_p096.png").
+type PageName struct {
+	Series string
+	// Chapter is the chapter number without leading zeros ("2", "2.5"); "" when the
+	// name has none.
+	Chapter string
+	// Volume is 0 when the name has none.
+	Volume int
+	PageRef
+	// Tags are the bracketed release tags, e.g. "Digital".
+	Tags []string
+}
+
+var (
+	nameTag     = regexp.MustCompile(`\[([^\]]*)\]`)
+	namePage    = regexp.MustCompile(`(?i)\bp(?:age)?[ .]?(\d+)(?:-p?(\d+))?(?:x(\d+))?\b`)
+	nameVolume  = regexp.MustCompile(`(?i)\bv(?:ol|olume)?[ .]?(\d+)\b`)
+	nameChapter = regexp.MustCompile(`(?i)\bc(?:h|hap|hapter)?[ .]?(\d+(?:\.\d+)?)\b`)
+	// nameDigital is the chapter of digital releases, a bare number after the series.
+	nameDigital = regexp.MustCompile(`^(.+?) - (\d+(?:\.\d+)?)\b`)
+)
+
+// ParsePageName parses the file name of a page image, with or without its directory
+// and extension. It reports false if the name has no page number.
+func ParsePageName(name string) (PageName, bool) {
+	base := path.Base(name)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	var parsed PageName
+	for _, m := range nameTag.FindAllStringSubmatch(base, -1) {
+		parsed.Tags = append(parsed.Tags, strings.TrimSpace(m[1]))
+	}
+	base = strings.ReplaceAll(nameTag.ReplaceAllString(base, " "), "_", " ")
+
+	m := namePage.FindStringSubmatchIndex(base)
+	if m == nil {
+		return parsed, false
+	}
+	group := func(m []int, i int) string {
+		if m[2*i] < 0 {
+			return ""
+		}
+		return base[m[2*i]:m[2*i+1]]
+	}
+	parsed.PageRef = pageRefFromMatch(group(m, 1), group(m, 2), group(m, 3))
+	if parsed.Last < parsed.Number {
+		parsed.Last = parsed.Number
+	}
+	seriesEnd := m[0]
+
+	if v := nameVolume.FindStringSubmatchIndex(base); v != nil {
+		parsed.Volume, _ = strconv.Atoi(group(v, 1))
+		seriesEnd = min(seriesEnd, v[0])
+	}
+	if c := nameChapter.FindStringSubmatchIndex(base); c != nil {
+		parsed.Chapter = chapterNumber(group(c, 1))
+		seriesEnd = min(seriesEnd, c[0])
+	} else if d := nameDigital.FindStringSubmatchIndex(base); d != nil && d[4] < m[0] {
+		parsed.Chapter = chapterNumber(group(d, 2))
+		seriesEnd = min(seriesEnd, d[3])
+	}
+	parsed.Series = strings.Join(strings.Fields(strings.Trim(base[:seriesEnd], " -.(")), " ")
+	return parsed, true
+}
+
+// chapterNumber writes a chapter number without leading zeros.
+func chapterNumber(s string) string {
+	number, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// chapterLess orders chapter numbers numerically, pages without one first.
+func chapterLess(a, b string) bool {
+	if a == "" || b == "" {
+		return a == "" && b != ""
+	}
+	x, _ := strconv.ParseFloat(a, 64)
+	y, _ := strconv.ParseFloat(b, 64)
+	return x < y
+}
+
+// FileChapters returns the chapter numbers the pages' file names carry, in order.
+func FileChapters(pages []ImagePage) []string {
+	seen := map[string]bool{}
+	var chapters []string
+	for _, page := range pages {
+		if page.Chapter != "" && !seen[page.Chapter] {
+			seen[page.Chapter] = true
+			chapters = append(chapters, page.Chapter)
+		}
+	}
+	sort.Slice(chapters, func(i, j int) bool { return chapterLess(chapters[i], chapters[j]) })
+	return chapters
+}
+
+// PageGap is a run of page numbers missing from a chapter of a volume.
+type PageGap struct {
+	// Chapter is the chapter number from the file names; "" when they have none.
+	Chapter     string
+	First, Last int
+}
+
+func (g PageGap) String() string {
+	pages := PageLabel(g.First)
+	if g.Last > g.First {
+		pages += "-" + PageLabel(g.Last)
+	}
+	if g.Chapter == "" {
+		return pages
+	}
+	return fmt.Sprintf("chapter %s %s", g.Chapter, pages)
+}
+
+// PageGaps returns the page numbers missing between the first and last page of each
+// chapter of a volume, counting every page a spread covers.
+func PageGaps(pages []ImagePage) []PageGap {
+	covered := map[string]map[int]bool{}
+	for _, page := range pages {
+		if covered[page.Chapter] == nil {
+			covered[page.Chapter] = map[int]bool{}
+		}
+		for n := page.Number; n <= page.Last; n++ {
+			covered[page.Chapter][n] = true
+		}
+	}
+	var chapters []string
+	for chapter := range covered {
+		chapters = append(chapters, chapter)
+	}
+	sort.Slice(chapters, func(i, j int) bool { return chapterLess(chapters[i], chapters[j]) })
+
+	var gaps []PageGap
+	for _, chapter := range chapters {
+		first, last := -1, -1
+		for n := range covered[chapter] {
+			if first < 0 || n < first {
+				first = n
+			}
+			last = max(last, n)
+		}
+		for n := first; n <= last; n++ {
+			if covered[chapter][n] {
+				continue
+			}
+			if len(gaps) > 0 && gaps[len(gaps)-1].Chapter == chapter && gaps[len(gaps)-1].Last == n-1 {
+				gaps[len(gaps)-1].Last = n
+			} else {
+				gaps = append(gaps, PageGap{Chapter: chapter, First: n, Last: n})
+			}
+		}
+	}
+	return gaps
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePageName(t *testing.T) {
+	for name, want := range map[string]PageName{
+		"Berserk - 002 (v01) - p096-097 [Digital][Cyborgzx-repack].png": {
+			Series: "Berserk", Chapter: "2", Volume: 1, PageRef: PageRef{96, 97, 0, 0}, Tags: []string{"Digital", "Cyborgzx-repack"},
+		},
+		"Berserk v01/Berserk - 001 (v01) - p000x1 [Digital].jpg": {
+			Series: "Berserk", Chapter: "1", Volume: 1, PageRef: PageRef{0, 0, 1, 0}, Tags: []string{"Digital"},
+		},
+		"Berserk v01 c002 p096.jpg":                {Series: "Berserk", Chapter: "2", Volume: 1, PageRef: PageRef{96, 96, 0, 0}},
+		"Berserk_Ch.10.5_p003.png":                 {Series: "Berserk", Chapter: "10.5", PageRef: PageRef{3, 3, 0, 0}},
+		"Vinland Saga Vol.2 Chapter 12 Page 4.png": {Series: "Vinland Saga", Chapter: "12", Volume: 2, PageRef: PageRef{4, 4, 0, 0}},
+		"p011.png": {PageRef: PageRef{11, 11, 0, 0}},
+	} {
+		got, ok := ParsePageName(name)
+		require.True(t, ok, name)
+		assert.Equal(t, want, got, name)
+	}
+	for _, name := range []string{"Berserk v01 - credits.png", "cover.jpg", "Peach Girl v01.png"} {
+		_, ok := ParsePageName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestPageRef(t *testing.T) {
+	for label, ref := range map[string]PageRef{
+		"p011":     {11, 11, 0, 0},
+		"p096-097": {96, 97, 0, 0},
+		"p000x1":   {0, 0, 1, 0},
+		"p006b":    {6, 6, 0, 2},
+	} {
+		assert.Equal(t, label, ref.Label())
+		parsed, err := ParsePageRef(label)
+		require.NoError(t, err)
+		assert.Equal(t, ref, parsed)
+	}
+	for _, label := range []string{"11", "p097-096", "page 3"} {
+		_, err := ParsePageRef(label)
+		assert.Error(t, err, label)
+	}
+
+	// A page comes before its variants, in variant order.
+	order := []PageRef{{0, 0, 0, 0}, {0, 0, 1, 0}, {0, 0, 2, 0}, {1, 1, 0, 0}, {2, 3, 0, 0}, {4, 4, 0, 1}, {4, 4, 0, 2}, {5, 5, 0, 0}}
+	for i := 1; i < len(order); i++ {
+		assert.True(t, order[i-1].Before(order[i]), order[i].Label())
+		assert.False(t, order[i].Before(order[i-1]), order[i].Label())
+	}
+}
+
+func TestPageGaps(t *testing.T) {
+	spread := numberedPage("1", 4)
+	spread.Last = 5
+	pages := []ImagePage{
+		numberedPage("1", 0), numberedPage("1", 1), spread, numberedPage("1", 6), numberedPage("1", 9),
+		numberedPage("2", 1), numberedPage("2", 2),
+		numberedPage("10", 1), numberedPage("10", 3),
+	}
+	var gaps []string
+	for _, gap := range PageGaps(pages) {
+		gaps = append(gaps, gap.String())
+	}
+	assert.Equal(t, []string{"chapter 1 p002-p003", "chapter 1 p007-p008", "chapter 10 p002"}, gaps)
+	assert.Empty(t, PageGaps(pages[5:7]))
+	assert.Empty(t, FileChapters(nil))
+	assert.Equal(t, []string{"1", "2", "10"}, FileChapters(pages))
+}
@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParagraphVersion is the version of the paragraph envelope this package writes, and
+// the newest it reads.
+const ParagraphVersion = 1
+
+// Paragraph kinds, as classified by ParseParagraph.
+const (
+	ParagraphText       = "text"
+	ParagraphImage      = "image"
+	ParagraphImageChunk = "image-chunk"
+)
+
+// envelopeKinds are the paragraph kinds stored in an envelope, by their header name.
+var envelopeKinds = map[string]string{"IMAGE": ParagraphImage, "IMAGE-CHUNK": ParagraphImageChunk}
+
+// envelopeHeader matches the start of an envelope's header line: ALEXANDRIA-<kind>/<version>.
+var envelopeHeader = regexp.MustCompile(`^ALEXANDRIA-([A-Z][A-Z-]*)/(\d+)(?: |$)`)
+
+// Paragraph is a chapter paragraph, classified. Text is stored as is. Anything else
+// is stored in an envelope: a header line naming its kind and the envelope version,
+// then, after a newline, its payload. An image is
+//
+//	ALEXANDRIA-IMAGE/1 <image ID> <MIME type> <alt text>
+//
+// then the base64 of the image; a part of an image too large for one paragraph is an
+// ImageChunk. Paragraphs written before the envelope, images as bare base64, are
+// classified as images of Version 0.
+type Paragraph struct {
+	Kind string
+	// Version is the envelope version; 0 for text and legacy images.
+	Version int
+	Text    string
+	// ImageID, MIME, Alt and Data describe an image, or the image a chunk is part of;
+	// a legacy image has no ID or alt text, and its MIME type is sniffed from its bytes.
+	ImageID string
+	MIME    string
+	Alt     string
+	Data    []byte
+	// Chunk is set for an image chunk.
+	Chunk *ImageChunk
+}
+
+// Legacy reports whether p is an image stored before the envelope.
+func (p Paragraph) Legacy() bool {
+	return p.Kind == ParagraphImage && p.Version == 0
+}
+
+// imageHeader writes the header line of an image or image chunk paragraph, fields
+// first. The alt text is kept to one line.
+func imageHeader(kind string, alt string, fields ...string) string {
+	header := fmt.Sprintf("ALEXANDRIA-%s/%d %s", kind, ParagraphVersion, strings.Join(fields, " "))
+	if alt = strings.Join(strings.Fields(alt), " "); alt != "" {
+		header += " " + alt
+	}
+	return header
+}
+
+// imageParagraph stores a whole image in one paragraph.
+func imageParagraph(imageID, mime, alt string, data []byte) string {
+	return imageHeader("IMAGE", alt, imageID, mime) + "\n" + base64.StdEncoding.EncodeToString(data)
+}
+
+// checkImageID checks that an image ID can be written in an envelope header.
+func checkImageID(imageID string) error {
+	if imageID == "" || strings.ContainsAny(imageID, " \t\r\n") {
+		return fmt.Errorf("invalid image ID %q", imageID)
+	}
+	return nil
+}
+
+// ParseParagraph classifies a paragraph and decodes its envelope. An envelope of an
+// unknown kind or a newer version is an error rather than text, so that readers do
+// not show it as text; so is an envelope that does not decode.
+func ParseParagraph(paragraph string) (Paragraph, error) {
+	m := envelopeHeader.FindStringSubmatch(paragraph)
+	if m == nil {
+		if data, ok := legacyImage(paragraph); ok {
+			return Paragraph{Kind: ParagraphImage, MIME: http.DetectContentType(data), Data: data}, nil
+		}
+		return Paragraph{Kind: ParagraphText, Text: paragraph}, nil
+	}
+	kind, known := envelopeKinds[m[1]]
+	version, err := strconv.Atoi(m[2])
+	if !known || err != nil || version < 1 {
+		return Paragraph{}, fmt.Errorf("unknown paragraph envelope %q", strings.TrimSpace(m[0]))
+	}
+	if version > ParagraphVersion {
+		return Paragraph{}, fmt.Errorf("paragraph envelope %q is newer than version %d; update the reader", strings.TrimSpace(m[0]), ParagraphVersion)
+	}
+
+	header, payload, ok := strings.Cut(paragraph, "\n")
+	if !ok {
+		return Paragraph{}, fmt.Errorf("paragraph envelope %q has no payload", header)
+	}
+	fields := strings.Fields(header)
+	p := Paragraph{Kind: kind, Version: version}
+	switch kind {
+	case ParagraphImage:
+		if len(fields) < 3 {
+			return Paragraph{}, fmt.Errorf("image header %q: expected an image ID and a MIME type", header)
+		}
+		p.ImageID, p.MIME, p.Alt = fields[1], fields[2], strings.Join(fields[3:], " ")
+	case ParagraphImageChunk:
+		if len(fields) < 5 {
+			return Paragraph{}, fmt.Errorf("image chunk header %q: expected an image ID, a chunk number, a MIME type and a SHA-256", header)
+		}
+		chunk := ImageChunk{ImageID: fields[1], MIME: fields[3], SHA256: fields[4], Alt: strings.Join(fields[5:], " ")}
+		index, count, _ := strings.Cut(fields[2], "/")
+		var err1, err2 error
+		chunk.Index, err1 = strconv.Atoi(index)
+		chunk.Count, err2 = strconv.Atoi(count)
+		if err1 != nil || err2 != nil || chunk.Index < 1 || chunk.Index > chunk.Count {
+			return Paragraph{}, fmt.Errorf("image chunk header %q: invalid chunk number %q", header, fields[2])
+		}
+		p.ImageID, p.MIME, p.Alt, p.Chunk = chunk.ImageID, chunk.MIME, chunk.Alt, &chunk
+	}
+	if p.Data, err = base64.StdEncoding.DecodeString(payload); err != nil {
+		return Paragraph{}, fmt.Errorf("paragraph envelope %q: %w", header, err)
+	}
+	if p.Chunk != nil {
+		p.Chunk.Data = p.Data
+	}
+	return p, nil
+}
+
+// legacyImage returns the image a paragraph holds as bare base64, as image pages were
+// stored before the envelope: the whole paragraph decodes, and its bytes sniff as an
+// image.
+func legacyImage(paragraph string) ([]byte, bool) {
+	if paragraph == "" || len(paragraph)%4 != 0 || strings.ContainsAny(paragraph, " \t\r\n") {
+		return nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(paragraph)
+	if err != nil || !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseParagraph(t *testing.T) {
+	page := testPNG(t, 4, 6)
+	legacy := base64.StdEncoding.EncodeToString(page)
+	for _, test := range []struct {
+		paragraph string
+		want      Paragraph
+	}{
+		{"Call me Ishmael.", Paragraph{Kind: ParagraphText, Text: "Call me Ishmael."}},
+		{"", Paragraph{Kind: ParagraphText}},
+		// Base64 that is not an image, and envelope-like text, stay text.
+		{"AAAA", Paragraph{Kind: ParagraphText, Text: "AAAA"}},
+		{"ALEXANDRIA-IMAGES are stored on-chain.", Paragraph{Kind: ParagraphText, Text: "ALEXANDRIA-IMAGES are stored on-chain."}},
+		{legacy, Paragraph{Kind: ParagraphImage, MIME: "image/png", Data: page}},
+		{imageParagraph("p011", "image/png", "Berserk,\nchapter 2", page),
+			Paragraph{Kind: ParagraphImage, Version: 1, ImageID: "p011", MIME: "image/png", Alt: "Berserk, chapter 2", Data: page}},
+		{imageParagraph("p011", "image/png", "", page),
+			Paragraph{Kind: ParagraphImage, Version: 1, ImageID: "p011", MIME: "image/png", Data: page}},
+	} {
+		got, err := ParseParagraph(test.paragraph)
+		require.NoError(t, err, test.paragraph)
+		assert.Equal(t, test.want, got)
+	}
+	p, err := ParseParagraph(legacy)
+	require.NoError(t, err)
+	assert.True(t, p.Legacy())
+	p, err = ParseParagraph(imageParagraph("p011", "image/png", "", page))
+	require.NoError(t, err)
+	assert.False(t, p.Legacy())
+
+	for paragraph, message := range map[string]string{
+		"ALEXANDRIA-IMAGE/2 p011 image/png\nAAAA":              "newer than version 1",
+		"ALEXANDRIA-VIDEO/1 p011 video/mp4\nAAAA":              "unknown paragraph envelope",
+		"ALEXANDRIA-IMAGE/1 p011 image/png":                    "has no payload",
+		"ALEXANDRIA-IMAGE/1 p011\nAAAA":                        "expected an image ID and a MIME type",
+		"ALEXANDRIA-IMAGE/1 p011 image/png\nnot base64":        "illegal base64",
+		"ALEXANDRIA-IMAGE-CHUNK/1 p011 2/1 image/png 00\nAAAA": "invalid chunk number",
+		"ALEXANDRIA-IMAGE-CHUNK/1 p011 1/2 image/png\nAAAA":    "expected an image ID, a chunk number",
+	} {
+		_, err := ParseParagraph(paragraph)
+		assert.ErrorContains(t, err, message, paragraph)
+	}
+}
@@ -0,0 +1,105 @@
+package pipeline
+
+import "fmt"
+
+// Patch strategies
+const (
+	PatchNone    = "none"
+	PatchTail    = "tail"
+	PatchReplace = "replace"
+)
+
+// PatchTxWeightBytes weighs a transaction against its arguments when comparing
+// patch plans: sending and sealing one transaction costs about as much as carrying
+// this many bytes of arguments, so a one-paragraph fix at the end of a long chapter
+// is a trim and re-append, while a change near the start is a replacement.
+const PatchTxWeightBytes = 10_000
+
+// PatchStep is one transaction of a patch plan. Paragraph is set for
+// Admin/add_paragraph_to_chapter, Paragraphs for Admin/add_chapter.
+type PatchStep struct {
+	Name         string
+	Paragraph    string
+	Paragraphs   []string
+	PayloadBytes int
+}
+
+// PatchPlan is the set of transactions that turns an on-chain chapter into the local one.
+type PatchPlan struct {
+	Strategy string
+	// Keep is the number of leading paragraphs the chain and the local section share.
+	Keep int
+	// Remove and Append are the paragraphs a tail patch trims and re-appends.
+	Remove       int
+	Append       int
+	Steps        []PatchStep
+	PayloadBytes int
+}
+
+// Cost is the plan's weight in bytes: its arguments plus PatchTxWeightBytes per transaction.
+func (p PatchPlan) Cost() int {
+	return p.PayloadBytes + len(p.Steps)*PatchTxWeightBytes
+}
+
+// PlanPatch picks the cheapest correct way to turn the onChain paragraphs into local:
+// trim the tail back to the last shared paragraph with Admin/remove_last_paragraph and
+// re-append the rest with Admin/add_paragraph_to_chapter, or overwrite the whole chapter
+// with Admin/add_chapter. The contract refuses to leave a chapter with fewer than two
+// paragraphs after a removal, so a tail patch that would trim below that is not
+// considered; neither is a plan with a transaction over MaxTransactionBytes.
+func PlanPatch(bookTitle, chapterTitle string, index int, onChain, local []string) (PatchPlan, error) {
+	keep := 0
+	for keep < len(onChain) && keep < len(local) && onChain[keep] == local[keep] {
+		keep++
+	}
+	if keep == len(onChain) && keep == len(local) {
+		return PatchPlan{Strategy: PatchNone, Keep: keep}, nil
+	}
+
+	var plans []PatchPlan
+	tail := PatchPlan{Strategy: PatchTail, Keep: keep, Remove: len(onChain) - keep, Append: len(local) - keep}
+	if tail.Remove == 0 || keep >= 2 {
+		for i := 0; i < tail.Remove; i++ {
+			tail.add(PatchStep{Name: "Admin/remove_last_paragraph"}, StringArg(bookTitle), StringArg(chapterTitle))
+		}
+		for _, paragraph := range local[keep:] {
+			tail.add(PatchStep{Name: "Admin/add_paragraph_to_chapter", Paragraph: paragraph},
+				StringArg(bookTitle), StringArg(chapterTitle), StringArg(paragraph))
+		}
+		plans = append(plans, tail)
+	}
+	replace := PatchPlan{Strategy: PatchReplace, Keep: keep}
+	replace.add(PatchStep{Name: "Admin/add_chapter", Paragraphs: local},
+		StringArg(bookTitle), StringArg(chapterTitle), IntArg(index), StringArrayArg(local))
+	plans = append(plans, replace)
+
+	best := -1
+	for i, plan := range plans {
+		if plan.oversized() {
+			continue
+		}
+		if best == -1 || plan.Cost() < plans[best].Cost() {
+			best = i
+		}
+	}
+	if best == -1 {
+		return PatchPlan{}, fmt.Errorf("%s: every patch needs a transaction over the %d byte limit", chapterTitle, MaxTransactionBytes)
+	}
+	return plans[best], nil
+}
+
+func (p *PatchPlan) add(step PatchStep, args ...CadenceArg) {
+	// Arguments were built from strings, so encoding cannot fail.
+	step.PayloadBytes, _ = PayloadBytes(args...)
+	p.Steps = append(p.Steps, step)
+	p.PayloadBytes += step.PayloadBytes
+}
+
+func (p PatchPlan) oversized() bool {
+	for _, step := range p.Steps {
+		if step.PayloadBytes > MaxTransactionBytes {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chapterOf(n int, size int) []string {
+	paragraphs := make([]string, n)
+	for i := range paragraphs {
+		paragraphs[i] = strings.Repeat(string(rune('a'+i%26)), size)
+	}
+	return paragraphs
+}
+
+func TestPlanPatchTail(t *testing.T) {
+	onChain := chapterOf(40, 2_000)
+	local := append(append([]string{}, onChain[:39]...), "The corrected last paragraph.", "A new closing line.")
+
+	plan, err := PlanPatch("Ecce Homo", "Chapter 1", 1, onChain, local)
+	require.NoError(t, err)
+	assert.Equal(t, PatchTail, plan.Strategy)
+	assert.Equal(t, 39, plan.Keep)
+	assert.Equal(t, 1, plan.Remove)
+	assert.Equal(t, 2, plan.Append)
+	require.Len(t, plan.Steps, 3)
+	assert.Equal(t, "Admin/remove_last_paragraph", plan.Steps[0].Name)
+	assert.Equal(t, "Admin/add_paragraph_to_chapter", plan.Steps[1].Name)
+	assert.Equal(t, "A new closing line.", plan.Steps[2].Paragraph)
+}
+
+func TestPlanPatchReplace(t *testing.T) {
+	onChain := chapterOf(40, 2_000)
+	local := append([]string{"A corrected first paragraph."}, onChain[1:]...)
+
+	plan, err := PlanPatch("Ecce Homo", "Chapter 1", 1, onChain, local)
+	require.NoError(t, err)
+	assert.Equal(t, PatchReplace, plan.Strategy)
+	require.Len(t, plan.Steps, 1)
+	assert.Equal(t, "Admin/add_chapter", plan.Steps[0].Name)
+	assert.Equal(t, local, plan.Steps[0].Paragraphs)
+}
+
+func TestPlanPatchLimits(t *testing.T) {
+	plan, err := PlanPatch("Ecce Homo", "Chapter 1", 1, []string{"a", "b"}, []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, PatchNone, plan.Strategy)
+	assert.Empty(t, plan.Steps)
+
+	// Trimming below two paragraphs is refused by the contract.
+	plan, err = PlanPatch("Ecce Homo", "Chapter 1", 1, []string{"a", "b"}, []string{"a", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, PatchReplace, plan.Strategy)
+
+	// A chapter too large to send whole can still be fixed at the tail.
+	big := chapterOf(200, 10_000)
+	local := append(append([]string{}, big[:199]...), "fixed")
+	plan, err = PlanPatch("Ecce Homo", "Chapter 1", 1, big, local)
+	require.NoError(t, err)
+	assert.Equal(t, PatchTail, plan.Strategy)
+
+	local = append([]string{"fixed"}, big[1:]...)
+	_, err = PlanPatch("Ecce Homo", "Chapter 1", 1, big, local)
+	assert.Error(t, err)
+}
@@ -0,0 +1,249 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Preflight check outcomes. A failed check blocks the upload; a warning does not.
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+)
+
+// PreflightCheck is one line of a preflight report.
+type PreflightCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// PreflightReport is every check run for one book before an upload.
+type PreflightReport struct {
+	Book   string
+	Checks []PreflightCheck
+}
+
+func (r *PreflightReport) add(name, status, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, PreflightCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Count returns the number of checks with status.
+func (r PreflightReport) Count(status string) int {
+	n := 0
+	for _, check := range r.Checks {
+		if check.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Err returns an error naming the failed checks, or nil if none failed.
+func (r PreflightReport) Err() error {
+	var failed []string
+	for _, check := range r.Checks {
+		if check.Status == PreflightFail {
+			failed = append(failed, check.Name)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("preflight failed for %s: %s", r.Book, strings.Join(failed, ", "))
+}
+
+// PreflightSection is what preflight knows about one local section file.
+type PreflightSection struct {
+	Path  string
+	Index int
+	Title string
+	// Paragraphs and PayloadBytes are those of the section's Admin/add_chapter; ReadErr
+	// is set instead when the file could not be read or is not valid UTF-8.
+	Paragraphs   int
+	PayloadBytes int
+	ReadErr      error
+}
+
+// StorageIdentifier is the identifier of the storage path the contract saves a book
+// at: Alexandria_Library_<contract address>_<title>.
+func StorageIdentifier(contractAddress, title string) string {
+	return fmt.Sprintf("Alexandria_Library_%s_%s", contractAddress, title)
+}
+
+// CheckStorageTitle reports whether a title can be part of a book's storage path
+// identifier. StoragePath(identifier:) accepts any string at runtime, but a title that
+// is empty, padded with whitespace, or holds control characters or "/" makes a path
+// that cannot be written, parsed back from its /storage/... form or told apart from
+// another title reliably. Other characters outside [A-Za-z0-9_] only mean the path
+// cannot be written as a Cadence literal, so they are a warning.
+func CheckStorageTitle(title string) (status, detail string) {
+	switch {
+	case title == "":
+		return PreflightFail, "title is empty"
+	case !utf8.ValidString(title):
+		return PreflightFail, "title is not valid UTF-8"
+	case strings.TrimSpace(title) != title:
+		return PreflightFail, fmt.Sprintf("title %q has leading or trailing whitespace", title)
+	case strings.Contains(title, "/"):
+		return PreflightFail, fmt.Sprintf("title %q contains \"/\", the path separator", title)
+	}
+	for _, r := range title {
+		if unicode.IsControl(r) {
+			return PreflightFail, fmt.Sprintf("title %q contains control character %U", title, r)
+		}
+	}
+	var other []string
+	seen := map[rune]bool{}
+	for _, r := range title {
+		if r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) || seen[r] {
+			continue
+		}
+		seen[r] = true
+		other = append(other, fmt.Sprintf("%q", r))
+	}
+	if len(other) > 0 {
+		return PreflightWarn, fmt.Sprintf("path is built at runtime only; it cannot be written as a literal (%s)", strings.Join(other, " "))
+	}
+	return PreflightPass, "valid Cadence identifier"
+}
+
+// PreflightOffline checks a book and its section files without touching the chain:
+// the manifest, the storage path title, chapter titles and indices, and every section's
+// content and transaction size.
+func PreflightOffline(book BookManifest, contractAddress string, sections []PreflightSection) PreflightReport {
+	report := PreflightReport{Book: book.Title}
+
+	if err := book.Validate(); err != nil {
+		report.add("manifest", PreflightFail, "%v", err)
+	} else {
+		report.add("manifest", PreflightPass, "title, author, genre and section pattern are set")
+	}
+
+	status, detail := CheckStorageTitle(book.Title)
+	report.add("storage path", status, "%s: %s", StorageIdentifier(contractAddress, book.Title), detail)
+
+	if len(sections) == 0 {
+		report.add("sections", PreflightFail, "no section files match %s", book.SectionFileRegex)
+		return report
+	}
+
+	byIndex := map[int][]string{}
+	byTitle := map[string][]string{}
+	for _, section := range sections {
+		byIndex[section.Index] = append(byIndex[section.Index], section.Path)
+		byTitle[section.Title] = append(byTitle[section.Title], section.Path)
+	}
+	duplicates := 0
+	for _, section := range sections {
+		if paths := byIndex[section.Index]; len(paths) > 1 && paths[0] == section.Path {
+			report.add("chapter indices", PreflightFail, "index %d is used by %s", section.Index, strings.Join(paths, ", "))
+			duplicates++
+		}
+	}
+	if duplicates == 0 {
+		report.add("chapter indices", PreflightPass, "%d sections, each with its own index", len(sections))
+	}
+	duplicates = 0
+	for _, section := range sections {
+		if paths := byTitle[section.Title]; len(paths) > 1 && paths[0] == section.Path {
+			report.add("chapter titles", PreflightFail, "%q is the title of %s", section.Title, strings.Join(paths, ", "))
+			duplicates++
+		}
+	}
+	if duplicates == 0 {
+		report.add("chapter titles", PreflightPass, "%d distinct chapter titles", len(byTitle))
+	}
+	var unused []int
+	for index := range book.ChapterTitles {
+		if len(byIndex[index]) == 0 {
+			unused = append(unused, index)
+		}
+	}
+	sort.Ints(unused)
+	for _, index := range unused {
+		report.add("chapter titles", PreflightWarn, "chapterTitles names index %d (%q) but no section file has it", index, book.ChapterTitles[index])
+	}
+
+	problems := 0
+	for _, section := range sections {
+		name := fmt.Sprintf("section %s", section.Title)
+		switch {
+		case section.ReadErr != nil:
+			report.add(name, PreflightFail, "%v", section.ReadErr)
+		case section.Paragraphs == 0:
+			report.add(name, PreflightFail, "%s is empty", section.Path)
+		case section.PayloadBytes > MaxTransactionBytes:
+			report.add(name, PreflightFail, "Admin/add_chapter would be %d bytes, over the %d byte limit", section.PayloadBytes, MaxTransactionBytes)
+		case section.Paragraphs == 1:
+			report.add(name, PreflightWarn, "a single paragraph; the contract will not let a patch trim it, only replace it")
+		default:
+			continue
+		}
+		problems++
+	}
+	if problems == 0 {
+		report.add("sections", PreflightPass, "%d sections with content, each under the transaction size limit", len(sections))
+	}
+	return report
+}
+
+// OnChainBookInfo is what preflight reads from the chain about a book's title.
+type OnChainBookInfo struct {
+	// Exists is set when a book with the title is in the library, with its fields.
+	Exists  bool
+	Author  string
+	Genre   string
+	Edition string
+	// Authors are every author in the library. The contract records authors in the
+	// same dictionary as titles, so a new book cannot take an author's name.
+	Authors []string
+	// ChapterTitles are the chapter names the book already has.
+	ChapterTitles []string
+}
+
+// PreflightOnChain adds the checks against on-chain state to report: whether the title
+// belongs to another book or an author, and which chapter names are already there
+// without the ledger knowing, as for a book uploaded before the ledger was kept; the
+// upload skips Admin/add_chapter_name for them. skipNames are the chapters whose name
+// or content the ledger has sealed on this network.
+func PreflightOnChain(report *PreflightReport, book BookManifest, sections []PreflightSection, chain OnChainBookInfo, skipNames map[string]bool) {
+	if !chain.Exists {
+		for _, author := range chain.Authors {
+			if author == book.Title {
+				report.add("title", PreflightFail, "%q is an author's name in the library; the contract refuses it as a title", book.Title)
+				return
+			}
+		}
+		report.add("title", PreflightPass, "%q is not in the library yet", book.Title)
+		return
+	}
+	if chain.Author != book.Author || chain.Edition != book.Edition {
+		report.add("title", PreflightFail, "%q is already used by another book (%s, %s)", book.Title, chain.Author, chain.Edition)
+		return
+	}
+	if chain.Genre != book.Genre {
+		report.add("title", PreflightWarn, "%q is on-chain with genre %q, not %q", book.Title, chain.Genre, book.Genre)
+	} else {
+		report.add("title", PreflightPass, "%q is on-chain by the same author and edition; the upload resumes", book.Title)
+	}
+
+	onChain := map[string]bool{}
+	for _, title := range chain.ChapterTitles {
+		onChain[title] = true
+	}
+	unrecorded := 0
+	for _, section := range sections {
+		if onChain[section.Title] && !skipNames[section.Title] {
+			report.add("chapter names", PreflightWarn, "%q is already on-chain but not in the ledger; the upload does not add it again", section.Title)
+			unrecorded++
+		}
+	}
+	if unrecorded == 0 {
+		report.add("chapter names", PreflightPass, "ledger and chain agree on the chapter names already added")
+	}
+}
@@ -0,0 +1,125 @@
+package pipeline
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func preflightBook() BookManifest {
+	return BookManifest{
+		Title:            "Ecce Homo",
+		Author:           "Friedrich Nietzsche",
+		Genre:            "Philosophy",
+		Edition:          "Project Gutenberg eBook #52190",
+		SectionFileRegex: `^EcceHomo_Section_(\d+)\.txt$`,
+	}
+}
+
+func checksNamed(report PreflightReport, name string) []PreflightCheck {
+	var checks []PreflightCheck
+	for _, check := range report.Checks {
+		if check.Name == name {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+func TestCheckStorageTitle(t *testing.T) {
+	status, _ := CheckStorageTitle("Ecce_Homo")
+	assert.Equal(t, PreflightPass, status)
+	status, _ = CheckStorageTitle("Ecce Homo")
+	assert.Equal(t, PreflightWarn, status)
+	for _, title := range []string{"", " Ecce Homo", "Ecce/Homo", "Ecce\tHomo", "Ecce\xffHomo"} {
+		status, _ = CheckStorageTitle(title)
+		assert.Equal(t, PreflightFail, status, title)
+	}
+	assert.Equal(t, "Alexandria_Library_0xf8d6e0586b0a20c7_Ecce Homo", StorageIdentifier("0xf8d6e0586b0a20c7", "Ecce Homo"))
+}
+
+func TestPreflightOffline(t *testing.T) {
+	book := preflightBook()
+	book.ChapterTitles = map[int]string{1: "Preface", 9: "Epilogue"}
+	sections := []PreflightSection{
+		{Path: "s1.txt", Index: 1, Title: "Preface", Paragraphs: 12, PayloadBytes: 4000},
+		{Path: "s2.txt", Index: 2, Title: "Chapter 2", Paragraphs: 1, PayloadBytes: 900},
+		{Path: "s2b.txt", Index: 2, Title: "Chapter 2", Paragraphs: 8, PayloadBytes: 3000},
+		{Path: "s3.txt", Index: 3, Title: "Chapter 3"},
+		{Path: "s4.txt", Index: 4, Title: "Chapter 4", Paragraphs: 90, PayloadBytes: MaxTransactionBytes + 1},
+		{Path: "s5.txt", Index: 5, Title: "Chapter 5", ReadErr: errors.New("s5.txt is not valid UTF-8")},
+	}
+	report := PreflightOffline(book, "0xf8d6e0586b0a20c7", sections)
+
+	assert.Equal(t, PreflightPass, checksNamed(report, "manifest")[0].Status)
+	assert.Equal(t, PreflightWarn, checksNamed(report, "storage path")[0].Status)
+	assert.Equal(t, []PreflightCheck{{Name: "chapter indices", Status: PreflightFail, Detail: "index 2 is used by s2.txt, s2b.txt"}}, checksNamed(report, "chapter indices"))
+	titles := checksNamed(report, "chapter titles")
+	assert.Len(t, titles, 2)
+	assert.Equal(t, PreflightFail, titles[0].Status)
+	assert.Equal(t, PreflightWarn, titles[1].Status)
+	assert.Contains(t, titles[1].Detail, "index 9")
+
+	assert.Equal(t, PreflightWarn, checksNamed(report, "section Chapter 2")[0].Status)
+	assert.Contains(t, checksNamed(report, "section Chapter 3")[0].Detail, "empty")
+	assert.Contains(t, checksNamed(report, "section Chapter 4")[0].Detail, "over the")
+	assert.Contains(t, checksNamed(report, "section Chapter 5")[0].Detail, "UTF-8")
+	assert.Empty(t, checksNamed(report, "section Preface"))
+
+	err := report.Err()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "chapter indices")
+	}
+}
+
+func TestPreflightOfflinePasses(t *testing.T) {
+	book := preflightBook()
+	book.Title = "Ecce_Homo"
+	report := PreflightOffline(book, "0xf8d6e0586b0a20c7", []PreflightSection{
+		{Path: "s1.txt", Index: 1, Title: "Chapter 1", Paragraphs: 12, PayloadBytes: 4000},
+		{Path: "s2.txt", Index: 2, Title: "Chapter 2", Paragraphs: 8, PayloadBytes: 3000},
+	})
+	assert.NoError(t, report.Err())
+	assert.Equal(t, len(report.Checks), report.Count(PreflightPass))
+
+	report = PreflightOffline(book, "0xf8d6e0586b0a20c7", nil)
+	assert.Error(t, report.Err())
+}
+
+func TestPreflightOnChain(t *testing.T) {
+	book := preflightBook()
+	sections := []PreflightSection{{Title: "Chapter 1"}, {Title: "Chapter 2"}}
+
+	var report PreflightReport
+	PreflightOnChain(&report, book, sections, OnChainBookInfo{Authors: []string{"Ecce Homo"}}, nil)
+	assert.Equal(t, PreflightFail, checksNamed(report, "title")[0].Status)
+
+	report = PreflightReport{}
+	PreflightOnChain(&report, book, sections, OnChainBookInfo{Authors: []string{"Friedrich Nietzsche"}}, nil)
+	assert.NoError(t, report.Err())
+
+	report = PreflightReport{}
+	PreflightOnChain(&report, book, sections, OnChainBookInfo{Exists: true, Author: "Someone Else", Edition: book.Edition}, nil)
+	assert.Equal(t, PreflightFail, checksNamed(report, "title")[0].Status)
+
+	existing := OnChainBookInfo{
+		Exists:        true,
+		Author:        book.Author,
+		Genre:         "Biography",
+		Edition:       book.Edition,
+		ChapterTitles: []string{"Chapter 1", "Chapter 2"},
+	}
+	report = PreflightReport{}
+	PreflightOnChain(&report, book, sections, existing, map[string]bool{"Chapter 1": true})
+	assert.Equal(t, PreflightWarn, checksNamed(report, "title")[0].Status)
+	names := checksNamed(report, "chapter names")
+	assert.Len(t, names, 1)
+	assert.Equal(t, PreflightWarn, names[0].Status, "a book uploaded before the ledger resumes")
+	assert.Contains(t, names[0].Detail, "Chapter 2")
+	assert.NoError(t, report.Err())
+
+	report = PreflightReport{}
+	PreflightOnChain(&report, book, sections, existing, map[string]bool{"Chapter 1": true, "Chapter 2": true})
+	assert.NoError(t, report.Err())
+}
@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Progress tracks an upload's chapters and argument bytes as they are sent.
+type Progress struct {
+	ChaptersTotal int
+	ChaptersDone  int
+	BytesTotal    int
+	BytesSent     int
+	Started       time.Time
+	// Unit names what is counted in Line, "chapters" if empty; image uploads count pages.
+	Unit string
+}
+
+// NewProgress starts tracking an upload of chapters carrying bytes of arguments.
+func NewProgress(chapters, bytes int, started time.Time) *Progress {
+	return &Progress{ChaptersTotal: chapters, BytesTotal: bytes, Started: started}
+}
+
+// ETA estimates the time left from the byte rate so far, or 0 before anything was sent.
+func (p *Progress) ETA(now time.Time) time.Duration {
+	elapsed := now.Sub(p.Started)
+	if p.BytesSent == 0 || elapsed <= 0 || p.BytesSent >= p.BytesTotal {
+		return 0
+	}
+	rate := float64(p.BytesSent) / elapsed.Seconds()
+	return time.Duration(float64(p.BytesTotal-p.BytesSent) / rate * float64(time.Second))
+}
+
+// Line is the progress display, e.g. "chapters 3/12  bytes 120.0 kB/1.4 MB (8%)  ETA 4m10s".
+func (p *Progress) Line(now time.Time) string {
+	percent := 100
+	if p.BytesTotal > 0 {
+		percent = p.BytesSent * 100 / p.BytesTotal
+	}
+	eta := "--"
+	if d := p.ETA(now); d > 0 {
+		eta = d.Round(time.Second).String()
+	}
+	unit := p.Unit
+	if unit == "" {
+		unit = "chapters"
+	}
+	return fmt.Sprintf("%s %d/%d  bytes %s/%s (%d%%)  ETA %s",
+		unit, p.ChaptersDone, p.ChaptersTotal, FormatBytes(p.BytesSent), FormatBytes(p.BytesTotal), percent, eta)
+}
+
+// FormatBytes prints a byte count in decimal units.
+func FormatBytes(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1f MB", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1f kB", float64(n)/1_000)
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// LogRecord is one line of the JSON-lines run log: a transaction ("tx"), a progress
+// update ("progress") or a book's outcome ("book").
+type LogRecord struct {
+	Time          time.Time `json:"time"`
+	Event         string    `json:"event"`
+	Network       string    `json:"network"`
+	Book          string    `json:"book"`
+	Action        string    `json:"action,omitempty"`
+	Chapter       string    `json:"chapter,omitempty"`
+	TxID          string    `json:"txId,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Bytes         int       `json:"bytes,omitempty"`
+	ChaptersDone  int       `json:"chaptersDone,omitempty"`
+	ChaptersTotal int       `json:"chaptersTotal,omitempty"`
+	BytesSent     int       `json:"bytesSent,omitempty"`
+	BytesTotal    int       `json:"bytesTotal,omitempty"`
+	ETASeconds    float64   `json:"etaSeconds,omitempty"`
+}
+
+// JSONLog writes LogRecords as JSON lines, for CI to follow a run. It is safe for
+// concurrent use, and a nil *JSONLog discards everything.
+type JSONLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLog writes records to w.
+func NewJSONLog(w io.Writer) *JSONLog {
+	return &JSONLog{w: w}
+}
+
+// Write appends record as one line, stamping it with the current time if it has none.
+func (l *JSONLog) Write(record LogRecord) error {
+	if l == nil {
+		return nil
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// Record returns a "progress" log record for p.
+func (p *Progress) Record(network, book string, now time.Time) LogRecord {
+	return LogRecord{
+		Time:          now.UTC(),
+		Event:         "progress",
+		Network:       network,
+		Book:          book,
+		ChaptersDone:  p.ChaptersDone,
+		ChaptersTotal: p.ChaptersTotal,
+		BytesSent:     p.BytesSent,
+		BytesTotal:    p.BytesTotal,
+		ETASeconds:    p.ETA(now).Seconds(),
+	}
+}
@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	started := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	progress := NewProgress(4, 2_000_000, started)
+	assert.Equal(t, "chapters 0/4  bytes 0 B/2.0 MB (0%)  ETA --", progress.Line(started))
+
+	progress.BytesSent += 500_000
+	progress.ChaptersDone++
+	now := started.Add(time.Minute)
+	assert.Equal(t, 3*time.Minute, progress.ETA(now))
+	assert.Equal(t, "chapters 1/4  bytes 500.0 kB/2.0 MB (25%)  ETA 3m0s", progress.Line(now))
+
+	progress.BytesSent = progress.BytesTotal
+	assert.Zero(t, progress.ETA(now))
+
+	pages := NewProgress(120, 60_000_000, started)
+	pages.Unit = "pages"
+	assert.Equal(t, "pages 0/120  bytes 0 B/60.0 MB (0%)  ETA --", pages.Line(started))
+}
+
+func TestJSONLog(t *testing.T) {
+	var out bytes.Buffer
+	log := NewJSONLog(&out)
+	progress := NewProgress(2, 100, time.Now())
+	require.NoError(t, log.Write(LogRecord{Event: "tx", Network: "emulator", Book: "Ecce Homo", Action: "Admin/add_chapter", Status: StatusSealed}))
+	require.NoError(t, log.Write(progress.Record("emulator", "Ecce Homo", time.Now())))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	var record LogRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "Admin/add_chapter", record.Action)
+	assert.False(t, record.Time.IsZero())
+	assert.Contains(t, lines[1], `"chaptersTotal":2`)
+
+	var none *JSONLog
+	assert.NoError(t, none.Write(LogRecord{}))
+}
@@ -0,0 +1,218 @@
+package pipeline
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha3"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// Signer signs messages with one Flow account key. LocalSigner holds a decrypted key
+// in memory; KMSSigner asks a key management service, so the key never leaves it.
+type Signer interface {
+	AccountKey() AccountKey
+	// PublicKey is the key's 64-byte X||Y encoding, as Flow stores account keys.
+	PublicKey() ([]byte, error)
+	// Sign hashes message with the key's hash algorithm and returns the 64-byte r||s
+	// signature Flow expects.
+	Sign(message []byte) ([]byte, error)
+}
+
+// ParsePrivateKeyHex decodes a hex private key as found in a .pkey file or flow.json,
+// with or without a 0x prefix and surrounding whitespace.
+func ParsePrivateKeyHex(text string) ([]byte, error) {
+	text = strings.TrimPrefix(strings.TrimSpace(text), "0x")
+	key, err := hex.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("private key is not hex: %w", err)
+	}
+	return key, nil
+}
+
+// LocalSigner signs with a private key held in memory.
+type LocalSigner struct {
+	key     AccountKey
+	private *ecdsa.PrivateKey
+}
+
+// NewLocalSigner returns a signer for a raw private key. Only ECDSA_P256 keys are
+// supported; Flow's other curve, secp256k1, is not in the standard library.
+func NewLocalSigner(key AccountKey, privateKey []byte) (*LocalSigner, error) {
+	if err := checkAlgorithms(key); err != nil {
+		return nil, err
+	}
+	private, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key.Account, err)
+	}
+	return &LocalSigner{key: key, private: private}, nil
+}
+
+func (s *LocalSigner) AccountKey() AccountKey { return s.key }
+
+func (s *LocalSigner) PublicKey() ([]byte, error) {
+	return encodePublicKey(&s.private.PublicKey)
+}
+
+func (s *LocalSigner) Sign(message []byte) ([]byte, error) {
+	digest, err := Digest(s.key.HashAlgo, message)
+	if err != nil {
+		return nil, err
+	}
+	return signDigest(s.private, digest)
+}
+
+// KMS is a key management service that signs digests with keys it never exports.
+type KMS interface {
+	PublicKey(keyID string) ([]byte, error)
+	SignDigest(keyID string, digest []byte) ([]byte, error)
+}
+
+// KMSSigner signs with a key held by a KMS.
+type KMSSigner struct {
+	Key   AccountKey
+	KMS   KMS
+	KeyID string
+}
+
+func (s KMSSigner) AccountKey() AccountKey { return s.Key }
+
+func (s KMSSigner) PublicKey() ([]byte, error) { return s.KMS.PublicKey(s.KeyID) }
+
+func (s KMSSigner) Sign(message []byte) ([]byte, error) {
+	if err := checkAlgorithms(s.Key); err != nil {
+		return nil, err
+	}
+	digest, err := Digest(s.Key.HashAlgo, message)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := s.KMS.SignDigest(s.KeyID, digest)
+	if err != nil {
+		return nil, fmt.Errorf("%s: KMS key %s: %w", s.Key.Account, s.KeyID, err)
+	}
+	return signature, nil
+}
+
+// LocalKMS is an in-memory stand-in for a key management service, for tests.
+type LocalKMS struct {
+	mu   sync.Mutex
+	keys map[string]*ecdsa.PrivateKey
+}
+
+// NewLocalKMS returns an empty LocalKMS.
+func NewLocalKMS() *LocalKMS {
+	return &LocalKMS{keys: map[string]*ecdsa.PrivateKey{}}
+}
+
+// CreateKey generates a P-256 key under keyID and returns its public key.
+func (k *LocalKMS) CreateKey(keyID string) ([]byte, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	k.keys[keyID] = private
+	k.mu.Unlock()
+	return encodePublicKey(&private.PublicKey)
+}
+
+func (k *LocalKMS) lookup(keyID string) (*ecdsa.PrivateKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	private, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("no key %q", keyID)
+	}
+	return private, nil
+}
+
+func (k *LocalKMS) PublicKey(keyID string) ([]byte, error) {
+	private, err := k.lookup(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return encodePublicKey(&private.PublicKey)
+}
+
+func (k *LocalKMS) SignDigest(keyID string, digest []byte) ([]byte, error) {
+	private, err := k.lookup(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return signDigest(private, digest)
+}
+
+// Digest hashes message with a Flow hash algorithm: SHA3_256 or SHA2_256.
+func Digest(hashAlgo string, message []byte) ([]byte, error) {
+	switch hashAlgo {
+	case "SHA3_256":
+		sum := sha3.Sum256(message)
+		return sum[:], nil
+	case "SHA2_256":
+		sum := sha256.Sum256(message)
+		return sum[:], nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q (expected SHA3_256 or SHA2_256)", hashAlgo)
+}
+
+// VerifySignature reports whether signature is a valid r||s signature of message by
+// the 64-byte X||Y P-256 publicKey.
+func VerifySignature(publicKey []byte, hashAlgo string, message, signature []byte) (bool, error) {
+	if len(publicKey) != 64 {
+		return false, fmt.Errorf("public key is %d bytes, expected 64", len(publicKey))
+	}
+	public, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append([]byte{4}, publicKey...))
+	if err != nil {
+		return false, err
+	}
+	if len(signature) != 64 {
+		return false, nil
+	}
+	digest, err := Digest(hashAlgo, message)
+	if err != nil {
+		return false, err
+	}
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	return ecdsa.Verify(public, digest, r, s), nil
+}
+
+func checkAlgorithms(key AccountKey) error {
+	if key.SigAlgo != "ECDSA_P256" {
+		return fmt.Errorf("%s: unsupported signature algorithm %q (only ECDSA_P256 keys are supported)", key.Account, key.SigAlgo)
+	}
+	if _, err := Digest(key.HashAlgo, nil); err != nil {
+		return fmt.Errorf("%s: %w", key.Account, err)
+	}
+	return nil
+}
+
+func encodePublicKey(public *ecdsa.PublicKey) ([]byte, error) {
+	encoded, err := public.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(encoded) != 65 || encoded[0] != 4 {
+		return nil, errors.New("unexpected public key encoding")
+	}
+	return encoded[1:], nil
+}
+
+func signDigest(private *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, private, digest)
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature, nil
+}
@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertSigns(t *testing.T, signer Signer) {
+	publicKey, err := signer.PublicKey()
+	require.NoError(t, err)
+	message := []byte("FLOW-V0.0-transaction payload")
+	signature, err := signer.Sign(message)
+	require.NoError(t, err)
+	assert.Len(t, signature, 64)
+
+	ok, err := VerifySignature(publicKey, signer.AccountKey().HashAlgo, message, signature)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = VerifySignature(publicKey, signer.AccountKey().HashAlgo, []byte("another payload"), signature)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestLocalSigner(t *testing.T) {
+	signer, err := NewLocalSigner(librarianKey, testPrivateKey(t))
+	require.NoError(t, err)
+	assertSigns(t, signer)
+
+	sha2 := librarianKey
+	sha2.HashAlgo = "SHA2_256"
+	signer, err = NewLocalSigner(sha2, testPrivateKey(t))
+	require.NoError(t, err)
+	assertSigns(t, signer)
+
+	unknown := librarianKey
+	unknown.HashAlgo = "KECCAK_256"
+	_, err = NewLocalSigner(unknown, testPrivateKey(t))
+	assert.Error(t, err)
+}
+
+func TestKMSSigner(t *testing.T) {
+	kms := NewLocalKMS()
+	publicKey, err := kms.CreateKey("projects/alexandria/keys/librarian")
+	require.NoError(t, err)
+
+	key := librarianKey
+	key.HashAlgo = "SHA2_256"
+	signer := KMSSigner{Key: key, KMS: kms, KeyID: "projects/alexandria/keys/librarian"}
+	assertSigns(t, signer)
+	fromKMS, err := signer.PublicKey()
+	require.NoError(t, err)
+	assert.Equal(t, publicKey, fromKMS)
+
+	_, err = KMSSigner{Key: key, KMS: kms, KeyID: "missing"}.Sign([]byte("payload"))
+	assert.Error(t, err)
+}
+
+func TestVerifySignatureRejectsMalformedKeys(t *testing.T) {
+	_, err := VerifySignature(make([]byte, 63), DefaultHashAlgo, nil, make([]byte, 64))
+	assert.Error(t, err)
+	_, err = VerifySignature(make([]byte, 64), DefaultHashAlgo, nil, make([]byte, 64))
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SpreadAspect is how many times wider than tall an image named for a single page must
+// be to be taken for a double-page spread.
+const SpreadAspect = 1.2
+
+// How LayoutSpreads lays out double-page spreads.
+const (
+	SpreadsWhole = "whole"
+	SpreadsSplit = "split"
+)
+
+// Reading orders: manga read right to left, most comics left to right.
+const (
+	RightToLeft = "rtl"
+	LeftToRight = "ltr"
+)
+
+// Halves of a split spread, as in ImagePage.Half.
+const (
+	LeftHalf  = 1
+	RightHalf = 2
+)
+
+// LayoutSpreads finds the double-page spreads among pages: images named for a page
+// range (p006-007) or marked DoublePage, and images at least SpreadAspect times wider
+// than tall. With
+// SpreadsWhole each is marked Spread. With SpreadsSplit each is replaced by its two
+// halves, the half read first (the right one, right to left) first: p006-007 becomes
+// p006 and p007, and a spread named p006 becomes p006a and p006b.
+func LayoutSpreads(pages []ImagePage, layout, readingOrder string) ([]ImagePage, error) {
+	if layout != SpreadsWhole && layout != SpreadsSplit {
+		return nil, fmt.Errorf("spreads must be %s or %s, not %q", SpreadsWhole, SpreadsSplit, layout)
+	}
+	if readingOrder != RightToLeft && readingOrder != LeftToRight {
+		return nil, fmt.Errorf("reading order must be %s or %s, not %q", RightToLeft, LeftToRight, readingOrder)
+	}
+	labels := map[string]string{}
+	for _, page := range pages {
+		labels[page.Chapter+"/"+page.Label()] = page.Name
+	}
+	var laidOut []ImagePage
+	for _, page := range pages {
+		spread, err := isSpread(page)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !spread:
+			laidOut = append(laidOut, page)
+		case layout == SpreadsWhole:
+			page.Spread = true
+			laidOut = append(laidOut, page)
+		default:
+			first, second := page, page
+			if page.Last > page.Number {
+				first.Last, second.Number = first.Number, first.Number+1
+			} else {
+				first.Part, second.Part = 1, 2
+			}
+			first.Half, second.Half = LeftHalf, RightHalf
+			if readingOrder == RightToLeft {
+				first.Half, second.Half = RightHalf, LeftHalf
+			}
+			for _, half := range []ImagePage{first, second} {
+				key := half.Chapter + "/" + half.Label()
+				if other, ok := labels[key]; ok {
+					return nil, fmt.Errorf("%s would be both a half of %q and %q", half.Label(), page.Name, other)
+				}
+				labels[key] = page.Name
+			}
+			laidOut = append(laidOut, first, second)
+		}
+	}
+	return laidOut, nil
+}
+
+// isSpread reports whether page is a double-page spread, by its name or its shape.
+func isSpread(page ImagePage) (bool, error) {
+	if page.Last > page.Number || page.DoublePage {
+		return true, nil
+	}
+	data, err := page.Read()
+	if err != nil {
+		return false, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return false, fmt.Errorf("%s: failed to decode image: %w", page.Name, err)
+	}
+	return float64(config.Width) >= SpreadAspect*float64(config.Height), nil
+}
+
+// halfImage cuts the left or right half out of img.
+func halfImage(img image.Image, half int) image.Image {
+	bounds := img.Bounds()
+	middle := bounds.Min.X + bounds.Dx()/2
+	rect := image.Rect(bounds.Min.X, bounds.Min.Y, middle, bounds.Max.Y)
+	if half == RightHalf {
+		rect = image.Rect(middle, bounds.Min.Y, bounds.Max.X, bounds.Max.Y)
+	}
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			cropped.Set(x-rect.Min.X, y-rect.Min.Y, img.At(x, y))
+		}
+	}
+	return cropped
+}
+
+// ParseSpreads reads the spreads key of chapter metadata: the positions, from 0, of
+// the chapter's paragraphs that are double-page spreads, comma separated.
+func ParseSpreads(s string) ([]int, error) {
+	var positions []int
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		position, err := strconv.Atoi(field)
+		if err != nil || position < 0 {
+			return nil, fmt.Errorf("invalid spread position %q", field)
+		}
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// FormatSpreads writes positions for the spreads key, sorted and without repeats.
+func FormatSpreads(positions []int) string {
+	sorted := append([]int(nil), positions...)
+	sort.Ints(sorted)
+	var fields []string
+	for i, position := range sorted {
+		if i == 0 || position != sorted[i-1] {
+			fields = append(fields, strconv.Itoa(position))
+		}
+	}
+	return strings.Join(fields, ",")
+}
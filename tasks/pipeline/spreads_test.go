@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spreadPNG is a width x height image, black on its left half and white on its right.
+func spreadPNG(t *testing.T, width, height int) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := width / 2; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	return pngBytes(t, img)
+}
+
+func spreadVolume(t *testing.T) *ImageVolume {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"Berserk - 001 (v01) - p005 [Digital].png":     testPNG(t, 40, 60),
+		"Berserk - 001 (v01) - p006-007 [Digital].png": spreadPNG(t, 80, 60),
+		"Berserk - 001 (v01) - p008 [Digital].png":     spreadPNG(t, 80, 60),
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+	volume, err := OpenImageVolume(dir)
+	require.NoError(t, err)
+	return volume
+}
+
+func TestLayoutSpreads(t *testing.T) {
+	volume := spreadVolume(t)
+	layout := func(pages []ImagePage) []string {
+		var out []string
+		for _, page := range pages {
+			label := page.Label()
+			switch {
+			case page.Spread:
+				label += " spread"
+			case page.Half == LeftHalf:
+				label += " left"
+			case page.Half == RightHalf:
+				label += " right"
+			}
+			out = append(out, label)
+		}
+		return out
+	}
+
+	whole, err := LayoutSpreads(volume.Pages, SpreadsWhole, RightToLeft)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p005", "p006-007 spread", "p008 spread"}, layout(whole))
+
+	split, err := LayoutSpreads(volume.Pages, SpreadsSplit, RightToLeft)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p005", "p006 right", "p007 left", "p008a right", "p008b left"}, layout(split))
+	split, err = LayoutSpreads(volume.Pages, SpreadsSplit, LeftToRight)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p005", "p006 left", "p007 right", "p008a left", "p008b right"}, layout(split))
+
+	_, err = LayoutSpreads(volume.Pages, "fold", RightToLeft)
+	assert.Error(t, err)
+	_, err = LayoutSpreads(volume.Pages, SpreadsSplit, "ttb")
+	assert.Error(t, err)
+
+	// p007 is both a page of its own and half of p006-007.
+	clash := append([]ImagePage{}, volume.Pages...)
+	clash = append(clash, numberedPage("1", 7))
+	_, err = LayoutSpreads(clash, SpreadsSplit, RightToLeft)
+	assert.ErrorContains(t, err, "p007 would be both")
+}
+
+func TestEncodePageSpread(t *testing.T) {
+	volume := spreadVolume(t)
+	split, err := LayoutSpreads(volume.Pages, SpreadsSplit, RightToLeft)
+	require.NoError(t, err)
+	opts := ImageOptions{MaxWidth: 30, SpreadWidth: 60, Quality: 90}
+
+	// Read right to left, p006 is the white right half and p007 the black left one.
+	for i, want := range map[int]uint8{1: 255, 2: 0} {
+		encoded, err := EncodePage(split[i], opts)
+		require.NoError(t, err)
+		assert.Equal(t, []int{40, 60, 30, 45}, []int{encoded.SourceWidth, encoded.SourceHeight, encoded.Width, encoded.Height})
+		img, _, err := image.Decode(bytes.NewReader(encoded.Data))
+		require.NoError(t, err)
+		gray := color.GrayModel.Convert(img.At(15, 20)).(color.Gray)
+		assert.InDelta(t, want, gray.Y, 8, split[i].Label())
+	}
+
+	whole, err := LayoutSpreads(volume.Pages, SpreadsWhole, RightToLeft)
+	require.NoError(t, err)
+	encoded, err := EncodePage(whole[1], opts)
+	require.NoError(t, err)
+	assert.Equal(t, []int{60, 45}, []int{encoded.Width, encoded.Height}, "a spread kept whole gets SpreadWidth")
+	encoded, err = EncodePage(whole[0], opts)
+	require.NoError(t, err)
+	assert.Equal(t, 30, encoded.Width)
+}
+
+func TestSpreadPositions(t *testing.T) {
+	positions, err := ParseSpreads("6, 20,3")
+	require.NoError(t, err)
+	assert.Equal(t, []int{6, 20, 3}, positions)
+	assert.Equal(t, "3,6,20,21", FormatSpreads(append(positions, 21, 6)))
+	positions, err = ParseSpreads("")
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+	assert.Equal(t, "", FormatSpreads(nil))
+	_, err = ParseSpreads("6,-1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+// Review states of a chapter submitted by a librarian
+const (
+	SubmissionPending    = "pending"
+	SubmissionApproved   = "approved"
+	SubmissionSuperseded = "superseded"
+	SubmissionRejected   = "rejected"
+)
+
+// ResolveSubmission works out what happened to a librarian's submission from
+// the content hashes read back from the chain: the hash of the chapter still
+// pending review under the librarian's address ("" if none), and the hash of
+// the book's current chapter ("" if it has none). rejected is set when the ledger
+// records a reviewer rejecting it (see Ledger.Rejected): a rejected submission leaves
+// the pending map just as a superseded one does.
+//
+// Book.submitChapter replaces the whole pending map for a chapter, so a later
+// submission by anyone, or a different one by the same librarian, supersedes
+// this one.
+func ResolveSubmission(submittedHash, pendingHash, chapterHash string, rejected bool) string {
+	switch {
+	case pendingHash == submittedHash:
+		return SubmissionPending
+	case pendingHash != "":
+		return SubmissionSuperseded
+	case chapterHash == submittedHash:
+		return SubmissionApproved
+	case rejected:
+		return SubmissionRejected
+	default:
+		return SubmissionSuperseded
+	}
+}
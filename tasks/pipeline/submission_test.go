@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSubmission(t *testing.T) {
+	ours := HashParagraphs([]string{"Chapter I", "Call me Ishmael."})
+	other := HashParagraphs([]string{"Chapter I", "Call me Ishmael!"})
+
+	assert.Equal(t, SubmissionPending, ResolveSubmission(ours, ours, "", false))
+	assert.Equal(t, SubmissionPending, ResolveSubmission(ours, ours, other, false))
+	assert.Equal(t, SubmissionSuperseded, ResolveSubmission(ours, other, "", false))
+	assert.Equal(t, SubmissionApproved, ResolveSubmission(ours, "", ours, false))
+	assert.Equal(t, SubmissionSuperseded, ResolveSubmission(ours, "", other, false))
+	assert.Equal(t, SubmissionSuperseded, ResolveSubmission(ours, "", "", false))
+	assert.Equal(t, SubmissionRejected, ResolveSubmission(ours, "", "", true))
+	assert.Equal(t, SubmissionRejected, ResolveSubmission(ours, "", other, true))
+	// Submitted again after the rejection.
+	assert.Equal(t, SubmissionPending, ResolveSubmission(ours, ours, "", true))
+}
+
+func TestLedgerRejected(t *testing.T) {
+	ours := HashParagraphs([]string{"Chapter I", "Call me Ishmael."})
+	other := HashParagraphs([]string{"Chapter I", "Call me Ishmael!"})
+	ledger, err := OpenLedger(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	require.NoError(t, err)
+	review := func(action, hash, status string) {
+		require.NoError(t, ledger.Append(LedgerEntry{Network: "emulator", Action: action, Chapter: "Chapter_1", ContentHash: hash, Status: status}))
+	}
+
+	assert.False(t, ledger.Rejected("emulator", "Chapter_1", ours))
+	review("Admin/reject_chapter", ours, StatusFailed)
+	assert.False(t, ledger.Rejected("emulator", "Chapter_1", ours), "the rejection failed")
+	review("Admin/reject_chapter", ours, StatusSealed)
+	assert.True(t, ledger.Rejected("emulator", "Chapter_1", ours))
+	assert.False(t, ledger.Rejected("emulator", "Chapter_1", other))
+	assert.False(t, ledger.Rejected("mainnet", "Chapter_1", ours))
+	assert.False(t, ledger.Rejected("emulator", "Chapter_2", ours))
+	review("Admin/approve_chapter", ours, StatusSealed)
+	assert.False(t, ledger.Rejected("emulator", "Chapter_1", ours), "approved when submitted again")
+}
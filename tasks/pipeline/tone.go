@@ -0,0 +1,192 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// Page tones, as in EncodedImage.Tone.
+const (
+	ToneColor = "color"
+	ToneGray  = "gray"
+	// ToneBilevel is a gray page that is almost all black and white: line art and
+	// text, the halftones of a print scan.
+	ToneBilevel = "bilevel"
+)
+
+// Page encodings, as in EncodedImage.Encoding.
+const (
+	EncodingJPEG     = "jpeg"
+	EncodingGrayJPEG = "gray-jpeg"
+	// EncodingPalettePNG is a PNG of grayLevels evenly spaced grays, EncodingBilevelPNG
+	// one of black and white.
+	EncodingPalettePNG = "palette-png"
+	EncodingBilevelPNG = "bilevel-png"
+)
+
+const (
+	// chromaTolerance is the largest spread between a pixel's red, green and blue, out
+	// of 255, for it to count as gray; grayShare the share of pixels of a gray page
+	// that must.
+	chromaTolerance = 24
+	grayShare       = 0.999
+	// bilevelShare is the share of pixels of a bilevel page within bilevelTolerance of
+	// black or white.
+	bilevelShare     = 0.95
+	bilevelTolerance = 48
+	grayLevels       = 16
+)
+
+// EncodingTrial is one encoding tried for a page, at the scale it was encoded at.
+type EncodingTrial struct {
+	Encoding string
+	Bytes    int
+	// Quality is the JPEG quality; 0 for a PNG.
+	Quality int
+	// PSNR is its fidelity to the page at that scale, in dB: +Inf when it is exact, 0
+	// when it is not measured, as for color pages.
+	PSNR float64
+	// Fits is set when it fits the budget at acceptable fidelity.
+	Fits bool
+}
+
+func (t EncodingTrial) String() string {
+	name := map[string]string{
+		EncodingJPEG: "JPEG", EncodingGrayJPEG: "gray JPEG",
+		EncodingPalettePNG: fmt.Sprintf("%d-gray PNG", grayLevels), EncodingBilevelPNG: "bilevel PNG",
+	}[t.Encoding]
+	if t.Quality > 0 {
+		name += fmt.Sprintf(" q%d", t.Quality)
+	}
+	switch {
+	case t.PSNR == 0:
+		return fmt.Sprintf("%s %d bytes", name, t.Bytes)
+	case math.IsInf(t.PSNR, 1):
+		return fmt.Sprintf("%s %d bytes, exact", name, t.Bytes)
+	}
+	return fmt.Sprintf("%s %d bytes, %.1f dB", name, t.Bytes, t.PSNR)
+}
+
+// isGray reports whether a page is black and white or grayscale, allowing for the
+// color noise of scans and JPEG sources.
+func isGray(img image.Image) bool {
+	bounds := img.Bounds()
+	total := bounds.Dx() * bounds.Dy()
+	allowed := int(float64(total) * (1 - grayShare))
+	colored := 0
+	count := func(spread int) bool {
+		if spread > chromaTolerance {
+			colored++
+		}
+		return colored > allowed
+	}
+	switch img := img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	case *image.YCbCr:
+		// Gray is chroma 128; a Cb or Cr off by d spreads red, green and blue by about 2d.
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				i := img.COffset(x, y)
+				spread := 2 * max(absDiff(int(img.Cb[i]), 128), absDiff(int(img.Cr[i]), 128))
+				if count(spread) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			spread := int(max(r, g, b)>>8) - int(min(r, g, b)>>8)
+			if count(spread) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// toGray converts a page to grayscale, its pixels from 0 with no padding.
+func toGray(img image.Image) *image.Gray {
+	if gray, ok := img.(*image.Gray); ok && gray.Rect.Min == (image.Point{}) && gray.Stride == gray.Rect.Dx() {
+		return gray
+	}
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+	return gray
+}
+
+// isBilevel reports whether a gray page is almost all black and white.
+func isBilevel(gray *image.Gray) bool {
+	near := 0
+	for _, y := range gray.Pix {
+		if y <= bilevelTolerance || y >= 255-bilevelTolerance {
+			near++
+		}
+	}
+	return float64(near) >= bilevelShare*float64(len(gray.Pix))
+}
+
+// quantizeGray maps a gray page to levels evenly spaced grays, the nearest for each
+// pixel, with no dithering: dithering costs PNG more bytes than it gains fidelity. The
+// palette keeps only the grays used, so that PNG stores as few bits per pixel as it can.
+func quantizeGray(gray *image.Gray, levels int) *image.Paletted {
+	level := func(y uint8) int { return (int(y)*(levels-1) + 127) / 255 }
+	index := make([]int, levels)
+	for _, y := range gray.Pix {
+		index[level(y)] = 1
+	}
+	var palette color.Palette
+	for i := range index {
+		if index[i] > 0 {
+			index[i] = len(palette)
+			palette = append(palette, color.Gray{Y: uint8(i * 255 / (levels - 1))})
+		}
+	}
+	paletted := image.NewPaletted(gray.Bounds(), palette)
+	for i, y := range gray.Pix {
+		paletted.Pix[i] = uint8(index[level(y)])
+	}
+	return paletted
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image as PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// grayPSNR is the peak signal-to-noise ratio, in dB, of a gray image against the
+// original; +Inf when they are the same.
+func grayPSNR(original *image.Gray, img image.Image) float64 {
+	other := toGray(img)
+	var sum float64
+	for i, y := range original.Pix {
+		d := float64(y) - float64(other.Pix[i])
+		sum += d * d
+	}
+	if sum == 0 {
+		return math.Inf(1)
+	}
+	mse := sum / float64(len(original.Pix))
+	return 10 * math.Log10(255*255/mse)
+}
+
+func absDiff(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
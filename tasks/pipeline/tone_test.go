@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lineArt is a white page with black rings and stripes, antialiased when smooth is set.
+func lineArt(width, height int, smooth bool) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := float64(x-width/2), float64(y-height/2)
+			ink := 0.0
+			if d := math.Abs(math.Mod(math.Hypot(dx, dy), 20) - 10); d < 2 {
+				ink = 1
+				if smooth {
+					ink = min(1, 2-d)
+				}
+			}
+			if (x+2*y)%37 < 2 {
+				ink = 1
+			}
+			img.Pix[y*img.Stride+x] = uint8(255 * (1 - ink))
+		}
+	}
+	return img
+}
+
+func TestIsGray(t *testing.T) {
+	gray := lineArt(60, 90, true)
+	assert.True(t, isGray(gray))
+
+	rgba := image.NewRGBA(gray.Bounds())
+	for i, y := range gray.Pix {
+		copy(rgba.Pix[4*i:], []uint8{y, y, y, 255})
+	}
+	// A little color noise, as in a scan, leaves the page gray.
+	rgba.Pix[0], rgba.Pix[2] = 200, 180
+	assert.True(t, isGray(rgba))
+	for i := 0; i < 100; i++ {
+		rgba.Pix[4*i] = 255 - rgba.Pix[4*i+1]
+	}
+	assert.False(t, isGray(rgba), "a color patch makes a color page")
+
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, gray, &jpeg.Options{Quality: 90}))
+	decoded, err := jpeg.Decode(&buf)
+	require.NoError(t, err)
+	assert.True(t, isGray(decoded))
+
+	assert.False(t, isBilevel(lineArt(60, 90, true)), "antialiasing is gray")
+	assert.True(t, isBilevel(lineArt(60, 90, false)))
+}
+
+func TestEncodeImageTones(t *testing.T) {
+	opts := ImageOptions{Quality: 85, MinQuality: 40, MinPSNR: 30}
+
+	// Black and white line art is stored exactly in a 1-bit PNG.
+	bilevel := lineArt(300, 450, false)
+	encoded, err := EncodeImage(pngBytes(t, bilevel), "p001", "", opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ToneBilevel, EncodingBilevelPNG, "image/png"}, []string{encoded.Tone, encoded.Encoding, encoded.MIME})
+	assert.True(t, math.IsInf(encoded.PSNR, 1))
+	require.Len(t, encoded.Trials, 3)
+	for _, trial := range encoded.Trials {
+		assert.LessOrEqual(t, len(encoded.Data), trial.Bytes, "the smallest is kept")
+	}
+	decoded, err := png.Decode(bytes.NewReader(encoded.Data))
+	require.NoError(t, err)
+	assert.Equal(t, math.Inf(1), grayPSNR(bilevel, decoded))
+	assert.Contains(t, encoded.Stats(), "bilevel page 300x450, bilevel PNG")
+
+	// Antialiased, it is gray: a 1-bit PNG loses too much, so the gray palette is kept.
+	smooth := pngBytes(t, lineArt(300, 450, true))
+	encoded, err = EncodeImage(smooth, "p001", "", opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ToneGray, EncodingPalettePNG}, []string{encoded.Tone, encoded.Encoding})
+	assert.GreaterOrEqual(t, encoded.PSNR, 30.0)
+	require.Len(t, encoded.Trials, 2)
+	assert.Equal(t, EncodingGrayJPEG, encoded.Trials[0].Encoding)
+	assert.Greater(t, encoded.Trials[0].Bytes, len(encoded.Data))
+
+	// Asking for more fidelity than the palette gives falls back to gray JPEG.
+	strict := opts
+	strict.MinPSNR = 60
+	encoded, err = EncodeImage(smooth, "p001", "", strict)
+	require.NoError(t, err)
+	assert.Equal(t, []string{EncodingGrayJPEG, "image/jpeg"}, []string{encoded.Encoding, encoded.MIME})
+	assert.Equal(t, 85, encoded.Quality)
+	img, err := jpeg.Decode(bytes.NewReader(encoded.Data))
+	require.NoError(t, err)
+	assert.IsType(t, &image.Gray{}, img, "a gray JPEG has one channel")
+	assert.Contains(t, encoded.Stats(), "(rejected)")
+
+	// Color pages keep the color JPEG, and so does every page with KeepColor.
+	rgba := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		copy(rgba.Pix[i:], []uint8{uint8(i / 4 % 120 * 2), 40, 200, 255})
+	}
+	encoded, err = EncodeImage(pngBytes(t, rgba), "p001", "", opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ToneColor, EncodingJPEG}, []string{encoded.Tone, encoded.Encoding})
+	assert.Len(t, encoded.Trials, 1)
+	keep := opts
+	keep.KeepColor = true
+	encoded, err = EncodeImage(smooth, "p001", "", keep)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ToneColor, EncodingJPEG}, []string{encoded.Tone, encoded.Encoding})
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+// OnChainChapter mirrors the Alexandria.Chapter struct returned by the get_book_chapter script.
+type OnChainChapter struct {
+	BookTitle    string                 `json:"bookTitle"`
+	ChapterTitle string                 `json:"chapterTitle"`
+	Index        int                    `json:"index"`
+	Paragraphs   []string               `json:"paragraphs"`
+	Extra        map[string]interface{} `json:"extra"`
+}
+
+// ChapterDiff is the result of comparing a local section with the chapter read back from the chain.
+type ChapterDiff struct {
+	LocalParagraphs   int
+	OnChainParagraphs int
+	LocalHash         string
+	OnChainHash       string
+	// FirstDiff is the index of the first paragraph that differs, or -1 if none does.
+	FirstDiff   int
+	LocalText   string
+	OnChainText string
+}
+
+// Match reports whether the on-chain chapter is identical to the local section.
+func (d ChapterDiff) Match() bool {
+	return d.FirstDiff == -1 && d.LocalHash == d.OnChainHash
+}
+
+// CompareParagraphs compares local paragraphs with the paragraphs stored on-chain.
+func CompareParagraphs(local, onChain []string) ChapterDiff {
+	diff := ChapterDiff{
+		LocalParagraphs:   len(local),
+		OnChainParagraphs: len(onChain),
+		LocalHash:         HashParagraphs(local),
+		OnChainHash:       HashParagraphs(onChain),
+		FirstDiff:         -1,
+	}
+	for i := 0; i < len(local) || i < len(onChain); i++ {
+		var l, c string
+		if i < len(local) {
+			l = local[i]
+		}
+		if i < len(onChain) {
+			c = onChain[i]
+		}
+		if i >= len(local) || i >= len(onChain) || l != c {
+			diff.FirstDiff = i
+			diff.LocalText = l
+			diff.OnChainText = c
+			break
+		}
+	}
+	return diff
+}
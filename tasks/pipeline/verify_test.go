@@ -0,0 +1,27 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareParagraphs(t *testing.T) {
+	local := []string{"Why I Am So Wise", "1.", "The happiness of my existence"}
+
+	same := CompareParagraphs(local, []string{"Why I Am So Wise", "1.", "The happiness of my existence"})
+	assert.True(t, same.Match())
+	assert.Equal(t, -1, same.FirstDiff)
+
+	typo := CompareParagraphs(local, []string{"Why I Am So Wise", "1.", "The hapiness of my existence"})
+	assert.False(t, typo.Match())
+	assert.Equal(t, 2, typo.FirstDiff)
+	assert.Equal(t, "The hapiness of my existence", typo.OnChainText)
+
+	short := CompareParagraphs(local, local[:2])
+	assert.False(t, short.Match())
+	assert.Equal(t, 3, short.LocalParagraphs)
+	assert.Equal(t, 2, short.OnChainParagraphs)
+	assert.Equal(t, 2, short.FirstDiff)
+	assert.Equal(t, "", short.OnChainText)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// onChainBook mirrors the fields of the Alexandria.Book returned by get_book that
+// preflight compares.
+type onChainBook struct {
+	Title   string `json:"Title"`
+	Author  string `json:"Author"`
+	Genre   string `json:"Genre"`
+	Edition string `json:"Edition"`
+}
+
+// preflightSections reads every section the way the upload will send it.
+func preflightSections(book pipeline.BookManifest, sections []chapterFile) []pipeline.PreflightSection {
+	checked := make([]pipeline.PreflightSection, len(sections))
+	for i, section := range sections {
+		checked[i] = pipeline.PreflightSection{Path: section.Path, Index: section.Index, Title: section.Title}
+		paragraphs, err := readParagraphs(section.Path)
+		if err != nil {
+			checked[i].ReadErr = err
+			continue
+		}
+		checked[i].Paragraphs = len(paragraphs)
+		checked[i].PayloadBytes, checked[i].ReadErr = pipeline.PayloadBytes(
+			pipeline.StringArg(book.Title),
+			pipeline.StringArg(section.Title),
+			pipeline.IntArg(section.Index),
+			pipeline.StringArrayArg(paragraphs),
+		)
+	}
+	return checked
+}
+
+// fetchBookInfo reads what preflight needs to know about the book's title on-chain.
+func fetchBookInfo(o *OverflowState, bookTitle string) (pipeline.OnChainBookInfo, error) {
+	var info pipeline.OnChainBookInfo
+	result := o.Script("get_authors")
+	if result.Err != nil {
+		return info, fmt.Errorf("could not read authors: %w", result.Err)
+	}
+	if err := result.MarshalAs(&info.Authors); err != nil {
+		return info, fmt.Errorf("failed to decode authors: %w", err)
+	}
+
+	// get_book fails for a title that is not in the library.
+	result = o.Script("get_book", WithArg("bookTitle", pipeline.StringArg(bookTitle)))
+	if result.Err != nil {
+		return info, nil
+	}
+	var book onChainBook
+	if err := result.MarshalAs(&book); err != nil {
+		return info, fmt.Errorf("failed to decode book: %w", err)
+	}
+	info.Exists = true
+	info.Author, info.Genre, info.Edition = book.Author, book.Genre, book.Edition
+	titles, err := fetchChapterTitles(o, bookTitle)
+	if err != nil {
+		return info, fmt.Errorf("could not read chapter titles: %w", err)
+	}
+	info.ChapterTitles = titles
+	return info, nil
+}
+
+// preflightBook runs every preflight check for a book: offline on its manifest and
+// section files, then against the library on the chain.
+func preflightBook(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, sections []chapterFile, ledger *pipeline.Ledger) pipeline.PreflightReport {
+	contract := settings.Profile.ContractAddress
+	if contract == "" {
+		contract = "<contract>"
+	}
+	checked := preflightSections(book, sections)
+	report := pipeline.PreflightOffline(book, contract, checked)
+
+	info, err := fetchBookInfo(o, book.Title)
+	if err != nil {
+		report.Checks = append(report.Checks, pipeline.PreflightCheck{Name: "chain", Status: pipeline.PreflightFail, Detail: err.Error()})
+		return report
+	}
+	skipNames := map[string]bool{}
+	for _, section := range sections {
+		if ledger.Sealed(settings.Network, "Admin/add_chapter_name", section.Title, "") {
+			skipNames[section.Title] = true
+			continue
+		}
+		if paragraphs, err := readParagraphs(section.Path); err == nil && ledger.ContentSealed(settings.Network, section.Title, pipeline.HashParagraphs(paragraphs)) {
+			skipNames[section.Title] = true
+		}
+	}
+	pipeline.PreflightOnChain(&report, book, checked, info, skipNames)
+	return report
+}
+
+// printPreflight prints a preflight report as a pass/warn/fail list.
+func printPreflight(report pipeline.PreflightReport) {
+	color.Cyan("Preflight for %s:", report.Book)
+	for _, check := range report.Checks {
+		line := fmt.Sprintf("  %-4s  %-24s %s", strings.ToUpper(check.Status), check.Name, check.Detail)
+		switch check.Status {
+		case pipeline.PreflightPass:
+			color.Green("%s", line)
+		case pipeline.PreflightWarn:
+			color.Yellow("%s", line)
+		default:
+			color.Red("%s", line)
+		}
+	}
+	fmt.Printf("  %d passed, %d warnings, %d failed\n",
+		report.Count(pipeline.PreflightPass), report.Count(pipeline.PreflightWarn), report.Count(pipeline.PreflightFail))
+}
+
+// runPreflight checks the configured book, or every book in a catalog, offline and
+// against on-chain state without sending anything. Returns the process exit code:
+// non-zero if any check failed.
+func runPreflight(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, sections []chapterFile, ledger *pipeline.Ledger, args []string) int {
+	flags := flag.NewFlagSet("preflight", flag.ExitOnError)
+	catalogPath := flags.String("catalog", "", "check every book in this catalog instead")
+	flags.Parse(args)
+
+	if *catalogPath == "" {
+		report := preflightBook(o, settings, book, sections, ledger)
+		printPreflight(report)
+		if report.Err() != nil {
+			return 1
+		}
+		return 0
+	}
+
+	catalog, err := pipeline.LoadCatalog(*catalogPath)
+	if err != nil {
+		color.Red("Error loading catalog: %v", err)
+		return 1
+	}
+	failed := 0
+	for _, book := range catalog.Books {
+		ledger, err := pipeline.OpenLedger(pipeline.LedgerPath(settings.LedgerFolder, book.Title))
+		if err != nil {
+			color.Red("%s: error reading upload ledger: %v", book.Title, err)
+			failed++
+			continue
+		}
+		sections, err := loadSections(settings.BooksFolder, book)
+		if err != nil {
+			color.Red("%s: error discovering section files: %v", book.Title, err)
+			failed++
+			continue
+		}
+		report := preflightBook(o, settings, book, sections, ledger)
+		printPreflight(report)
+		fmt.Println()
+		if report.Err() != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		color.Red("Preflight failed for %d of %d books.", failed, len(catalog.Books))
+		return 1
+	}
+	color.Green("Preflight passed for all %d books.", len(catalog.Books))
+	return 0
+}
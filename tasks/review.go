@@ -0,0 +1,217 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// runReview is the admin console for librarian submissions. With no command it lists
+// what is pending review; "diff" compares one submission with the current chapter or
+// the local section; "approve" and "reject" decide it and record the decision in the
+// ledger. Returns the process exit code.
+func runReview(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, sections []chapterFile, ledger *pipeline.Ledger, args []string) int {
+	command := "list"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("review "+command, flag.ExitOnError)
+	catalogPath := flags.String("catalog", "", "list pending submissions of every book in this catalog")
+	chapter := flags.String("chapter", "", "chapter title of the submission")
+	librarian := flags.String("librarian", "", "account name or address of the librarian who submitted it")
+	against := flags.String("against", "auto", "compare with the on-chain chapter (chain), the local section (local), or chain if it has content (auto)")
+	note := flags.String("note", "", "reason for the decision, recorded in the ledger")
+	flags.Parse(args)
+
+	if command == "list" {
+		books := []string{book.Title}
+		if *catalogPath != "" {
+			catalog, err := pipeline.LoadCatalog(*catalogPath)
+			if err != nil {
+				color.Red("Error reading catalog: %v", err)
+				return 1
+			}
+			books = books[:0]
+			for _, b := range catalog.Books {
+				books = append(books, b.Title)
+			}
+		}
+		for _, title := range books {
+			if err := listPendingReview(o, title); err != nil {
+				color.Red("%s: could not read submissions: %v", title, err)
+			}
+		}
+		return 0
+	}
+
+	if *chapter == "" || *librarian == "" {
+		color.Red("review %s needs -chapter and -librarian", command)
+		return 2
+	}
+	address, err := accountAddress(settings, *librarian)
+	if err != nil {
+		color.Red("-librarian: %v", err)
+		return 2
+	}
+	submission, err := fetchSubmission(o, book.Title, *chapter, address)
+	if err != nil {
+		color.Red("Could not read the submission: %v", err)
+		return 1
+	}
+	if submission == nil {
+		color.Red("%s has no submission of %s pending review in %s.", *librarian, *chapter, book.Title)
+		return 1
+	}
+
+	switch command {
+	case "diff":
+		if err := reviewDiff(o, book.Title, sections, *submission, *against); err != nil {
+			color.Red("%v", err)
+			return 1
+		}
+		return 0
+	case "approve", "reject":
+		if err := reviewDecide(o, settings, book, ledger, *submission, address, command, *note); err != nil {
+			color.Red("%v", err)
+			return 1
+		}
+		return 0
+	default:
+		fmt.Printf("Unknown review command %q (expected list, diff, approve or reject)\n", command)
+		return 2
+	}
+}
+
+// listPendingReview prints the librarians with a chapter pending review in bookTitle.
+func listPendingReview(o *OverflowState, bookTitle string) error {
+	pending, err := fetchPendingReview(o, bookTitle)
+	if err != nil {
+		return err
+	}
+	color.Red("Alexandria Contract - %s Pending Review", bookTitle)
+	if len(pending) == 0 {
+		color.Green("  nothing pending")
+		return nil
+	}
+	chapters := make([]string, 0, len(pending))
+	for chapter := range pending {
+		chapters = append(chapters, chapter)
+	}
+	sort.Strings(chapters)
+	for _, chapter := range chapters {
+		for _, librarian := range pending[chapter] {
+			line := fmt.Sprintf("  %-28s %s", chapter, librarian)
+			if submission, err := fetchSubmission(o, bookTitle, chapter, librarian); err == nil && submission != nil {
+				line += fmt.Sprintf("   index %d, %d paragraphs", submission.Index, len(submission.Paragraphs))
+			}
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
+
+// reviewDiff prints a paragraph-level diff of a submission against the chapter it would
+// replace: the current on-chain chapter, or the local section with the same title.
+func reviewDiff(o *OverflowState, bookTitle string, sections []chapterFile, submission pipeline.OnChainChapter, against string) error {
+	var base []string
+	source := ""
+	if against == "chain" || against == "auto" {
+		if current, err := fetchChapter(o, bookTitle, submission.ChapterTitle); err == nil && len(current) > 0 {
+			base, source = current, "on-chain chapter"
+		} else if against == "chain" {
+			return fmt.Errorf("%s has no content on-chain to compare with", submission.ChapterTitle)
+		}
+	}
+	if source == "" {
+		for _, section := range sections {
+			if section.Title != submission.ChapterTitle {
+				continue
+			}
+			plain, err := readParagraphs(section.Path)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %w", section.Path, err)
+			}
+			base, source = plain, section.Path
+		}
+	}
+	if source == "" {
+		return fmt.Errorf("%s has no on-chain content and no local section to compare with", submission.ChapterTitle)
+	}
+
+	edits := pipeline.DiffParagraphs(base, submission.Paragraphs)
+	equal, deleted, inserted := pipeline.DiffStats(edits)
+	color.Cyan("%s: submission (index %d) against %s", submission.ChapterTitle, submission.Index, source)
+	for _, edit := range edits {
+		switch edit.Op {
+		case pipeline.DiffDelete:
+			color.Red("- [%d] %s", edit.OldIndex, edit.Text)
+		case pipeline.DiffInsert:
+			color.Green("+ [%d] %s", edit.NewIndex, edit.Text)
+		}
+	}
+	color.Cyan("%d unchanged, %d removed, %d added paragraphs", equal, deleted, inserted)
+	return nil
+}
+
+// reviewDecide approves or rejects a submission with Admin/approve_chapter or
+// Admin/reject_chapter, and records the reviewer's decision in the ledger. An approved
+// chapter replaces the stored one, so its metadata is set again.
+func reviewDecide(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, ledger *pipeline.Ledger, submission pipeline.OnChainChapter, librarian, decision, note string) error {
+	action := "Admin/" + decision + "_chapter"
+	librarianArg, err := pipeline.AddressArg(librarian)
+	if err != nil {
+		return err
+	}
+	transactions := 1
+	if decision == "approve" {
+		transactions++
+	}
+	if err := guardWrite(settings, book.Title, pipeline.FeeEstimate(transactions)); err != nil {
+		return err
+	}
+	color.Yellow("%s %s submitted by %s (%d paragraphs)", action, submission.ChapterTitle, librarian, len(submission.Paragraphs))
+	result := o.Tx(action,
+		WithSigner(book.Signer),
+		WithArg("bookTitle", pipeline.StringArg(book.Title)),
+		WithArg("chapterTitle", pipeline.StringArg(submission.ChapterTitle)),
+		WithArg("librarian", librarianArg),
+	)
+	err = recordTx(o, settings, ledger, pipeline.LedgerEntry{
+		Network:     settings.Network,
+		Book:        book.Title,
+		Action:      action,
+		Chapter:     submission.ChapterTitle,
+		Index:       submission.Index,
+		ContentHash: hashOnChain(submission.Paragraphs),
+		Paragraphs:  len(submission.Paragraphs),
+		Librarian:   librarian,
+		Reviewer:    book.Signer,
+		Note:        note,
+	}, result)
+	result.Print()
+	if err != nil {
+		return fmt.Errorf("could not %s %s: %w", decision, submission.ChapterTitle, err)
+	}
+	if decision == "approve" {
+		return resetChapterMetadata(o, settings, ledger, book.Signer, book.Title, submission.ChapterTitle, submission.Index, submission.Paragraphs)
+	}
+	return nil
+}
+
+// fetchPendingReview reads the librarians with a chapter pending review, by chapter title.
+func fetchPendingReview(o *OverflowState, bookTitle string) (map[string][]string, error) {
+	result := o.Script("get_pending_review", WithArg("bookTitle", pipeline.StringArg(bookTitle)))
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	pending := map[string][]string{}
+	if err := result.MarshalAs(&pending); err != nil {
+		return nil, fmt.Errorf("failed to decode pending review: %w", err)
+	}
+	return pending, nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// uploadSettings are the run-wide settings shared by every book.
+type uploadSettings struct {
+	Network      string
+	Profile      pipeline.NetworkProfile
+	BooksFolder  string
+	LedgerFolder string
+	// OfflineFolder holds the bundles of the offline workflow; see runOffline.
+	OfflineFolder string
+	DryRun        bool
+	// CreateGenre allows a new book's genre to be created with Admin/add_genre.
+	CreateGenre bool
+	// AllowMainnet and ConfirmTokens unlock writes to a permanent network; see guardWrite.
+	AllowMainnet  bool
+	ConfirmTokens []string
+	// Log receives a JSON line per transaction and progress update; nil discards them.
+	Log *pipeline.JSONLog
+	// FlowConfig is flow.json; KeystorePath is the encrypted keystore whose keys
+	// override its accounts' keys. See newOverflow.
+	FlowConfig   string
+	KeystorePath string
+	// AllowPlaintextKeys lets tasks run with world-readable plaintext keys.
+	AllowPlaintextKeys bool
+}
+
+// loadSections finds a book's section files and gives each its chapter title.
+func loadSections(booksFolder string, book pipeline.BookManifest) ([]chapterFile, error) {
+	sections, err := findSections(booksFolder, book.SectionFileRegex, book.StartIndex)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sections {
+		sections[i].Title = chapterTitleFor(sections[i].Index, book.ChapterTitles)
+	}
+	return sections, nil
+}
+
+// uploadBook runs the upload of one book: create it if needed, check the cost, then add
+// every chapter the ledger does not already have sealed. sendLock is held while sending
+// transactions, so books that share a signer never race on its key's sequence number.
+func uploadBook(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, sections []chapterFile, ledger *pipeline.Ledger, sendLock sync.Locker) pipeline.BookReport {
+	started := time.Now()
+	report := pipeline.BookReport{Title: book.Title, Chapters: len(sections)}
+	fail := func(err error) pipeline.BookReport {
+		report.Status = pipeline.BookFailed
+		report.Error = err.Error()
+		report.Duration = time.Since(started)
+		return report
+	}
+	network, signer := settings.Network, book.Signer
+	defer func() {
+		settings.Log.Write(pipeline.LogRecord{
+			Event:   "book",
+			Network: network,
+			Book:    book.Title,
+			Status:  report.Status,
+			Error:   report.Error,
+		})
+	}()
+
+	color.Red("Alexandria Contract - %s Upload", book.Title)
+	color.Red("")
+
+	preflight := preflightBook(o, settings, book, sections, ledger)
+	printPreflight(preflight)
+	if err := preflight.Err(); err != nil {
+		color.Red("Refusing to start: %v", err)
+		return fail(err)
+	}
+	fmt.Println()
+
+	steps, err := planSteps(o, settings, book, sections)
+	if err != nil {
+		color.Red("Refusing to start: %v", err)
+		return fail(err)
+	}
+
+	estimate, err := planUpload(ledger, network, book, sections, steps)
+	if err != nil {
+		return fail(fmt.Errorf("error planning upload: %w", err))
+	}
+	report.StorageBytes = estimate.StorageBytes
+	if len(estimate.Transactions) == 0 {
+		color.Green("Ledger: every chapter of %s is already sealed on %s. Nothing to do.", book.Title, network)
+		report.Status = pipeline.BookComplete
+		report.Duration = time.Since(started)
+		return report
+	}
+	color.Cyan("\nCost estimate for %s on %s:", book.Title, network)
+	cost, err := checkCost(o, settings, signer, estimate, settings.DryRun)
+	if err != nil {
+		color.Red("Refusing to start: %v", err)
+		return fail(err)
+	}
+	if settings.DryRun {
+		color.Green("\nDry run complete. No transactions were sent.")
+		report.Status = pipeline.BookPlanned
+		report.Transactions = len(estimate.Transactions)
+		report.Duration = time.Since(started)
+		return report
+	}
+	if err := guardWrite(settings, book.Title, cost); err != nil {
+		color.Red("Refusing to start: %v", err)
+		return fail(err)
+	}
+
+	sendLock.Lock()
+	defer sendLock.Unlock()
+
+	// The loop below sends the planned transactions in order, so each one sent (or
+	// skipped) advances the progress by the next planned payload.
+	planned := estimate.Transactions
+	chapters := 0
+	for _, tx := range planned {
+		if tx.Name == "Admin/add_chapter" {
+			chapters++
+		}
+	}
+	progress := pipeline.NewProgress(chapters, estimate.PayloadBytes, time.Now())
+	advance := func() {
+		if len(planned) > 0 {
+			progress.BytesSent += planned[0].PayloadBytes
+			planned = planned[1:]
+		}
+	}
+	send := func(entry pipeline.LedgerEntry, result *OverflowResult) error {
+		report.Transactions++
+		advance()
+		err := recordTx(o, settings, ledger, entry, result)
+		if err != nil {
+			report.Failed++
+		}
+		result.Print()
+		return err
+	}
+
+	if steps.CreateGenre {
+		color.Yellow("Creating genre: %s", book.Genre)
+		result := o.Tx("Admin/add_genre",
+			WithSigner(signer),
+			WithArg("genre", pipeline.StringArg(book.Genre)),
+		)
+		err := send(pipeline.LedgerEntry{
+			Network: network,
+			Book:    book.Title,
+			Action:  "Admin/add_genre",
+		}, result)
+		if err != nil {
+			return fail(fmt.Errorf("could not create genre %q: %w", book.Genre, err))
+		}
+	}
+
+	if steps.CreateBook {
+		color.Yellow("Book does not exist. Creating book: %s", book.Title)
+		result := o.Tx("Admin/add_book",
+			WithSigner(signer),
+			WithArg("title", pipeline.StringArg(book.Title)),
+			WithArg("author", pipeline.StringArg(book.Author)),
+			WithArg("genre", pipeline.StringArg(book.Genre)),
+			WithArg("edition", pipeline.StringArg(book.Edition)),
+			WithArg("summary", pipeline.StringArg(book.Summary)),
+		)
+		if result.Err != nil && strings.Contains(result.Err.Error(), "already in the Library") {
+			color.Green("Book already exists (detected during creation). Skipping.")
+			advance()
+		} else {
+			err := send(pipeline.LedgerEntry{
+				Network: network,
+				Book:    book.Title,
+				Action:  "Admin/add_book",
+			}, result)
+			if err != nil {
+				return fail(fmt.Errorf("could not create book %q: %w", book.Title, err))
+			}
+			color.Green("Book created successfully!")
+		}
+	} else {
+		color.Green("Book already exists. Skipping book creation.")
+	}
+
+	if steps.SetKeeper {
+		color.Yellow("Assigning keeper %s", book.Keeper)
+		report.Transactions++
+		advance()
+		if err := assignKeeper(o, settings, ledger, signer, book.Title, book.Keeper); err != nil {
+			report.Failed++
+			return fail(fmt.Errorf("could not assign keeper %s: %w", book.Keeper, err))
+		}
+	}
+
+	if len(steps.BookMetadata) > 0 {
+		color.Yellow("Setting book metadata: %s", metadataNote(steps.BookMetadata))
+		send(pipeline.LedgerEntry{
+			Network: network,
+			Book:    book.Title,
+			Action:  "Admin/set_book_metadata",
+			Note:    metadataNote(steps.BookMetadata),
+		}, bookMetadataTx(o, signer, book.Title, steps.BookMetadata))
+	}
+
+	fmt.Printf("\nFound %d section files:\n", len(sections))
+	for _, section := range sections {
+		fmt.Printf("  - %s (index %d)\n", section.Path, section.Index)
+	}
+
+	for _, section := range sections {
+		sectionTitle := section.Title
+		color.Cyan("\nProcessing %s (index %d)", sectionTitle, section.Index)
+		paragraphs, err := readParagraphs(section.Path)
+		if err != nil {
+			return fail(fmt.Errorf("error reading %s: %w", section.Path, err))
+		}
+		contentHash := pipeline.HashParagraphs(paragraphs)
+		fmt.Printf("Successfully loaded %d paragraphs from %s\n", len(paragraphs), section.Path)
+
+		entry := pipeline.LedgerEntry{
+			Network:     network,
+			Book:        book.Title,
+			Chapter:     sectionTitle,
+			Index:       section.Index,
+			ContentHash: contentHash,
+			Paragraphs:  len(paragraphs),
+		}
+		// Resume: skip chapters the ledger already has sealed with the same content
+		if ledger.ContentSealed(network, sectionTitle, contentHash) {
+			color.Green("Ledger: %s already sealed with this content. Skipping.", sectionTitle)
+			continue
+		}
+		if ledger.Sealed(network, "Admin/add_chapter_name", sectionTitle, "") {
+			color.Green("Ledger: section name %s already on-chain. Skipping name.", sectionTitle)
+		} else if steps.ChapterNames[sectionTitle] {
+			color.Green("Section name %s already on-chain, not in the ledger. Skipping name.", sectionTitle)
+		} else {
+			color.Yellow("Adding section name on-chain: %s", sectionTitle)
+			entry.Action = "Admin/add_chapter_name"
+			err := send(entry, o.Tx("Admin/add_chapter_name",
+				WithSigner(signer),
+				WithArg("bookTitle", pipeline.StringArg(book.Title)),
+				WithArg("chapterTitle", pipeline.StringArg(sectionTitle)),
+			))
+			// The chapter cannot be stored without its name, so a failed name stops the
+			// upload like a failed page stops an image upload; a rerun resumes here.
+			if err != nil {
+				return fail(fmt.Errorf("could not add chapter name %q: %w", sectionTitle, err))
+			}
+		}
+		color.Yellow("Adding section content on-chain: %s (index %d)", sectionTitle, section.Index)
+		entry.Action = "Admin/add_chapter"
+		err = send(entry, o.Tx("Admin/add_chapter",
+			WithSigner(signer),
+			WithArg("bookTitle", pipeline.StringArg(book.Title)),
+			WithArg("chapterTitle", pipeline.StringArg(sectionTitle)),
+			WithArg("index", pipeline.IntArg(section.Index)),
+			WithArg("paragraphs", pipeline.StringArrayArg(paragraphs)),
+		))
+		// Admin/add_chapter stores a new Chapter, so its metadata is always set again.
+		if err != nil {
+			advance()
+		} else {
+			chapterMetadata := chapterMetadataFor(paragraphs)
+			send(pipeline.LedgerEntry{
+				Network: network,
+				Book:    book.Title,
+				Action:  "Admin/set_chapter_metadata",
+				Chapter: sectionTitle,
+				Index:   section.Index,
+				Note:    metadataNote(chapterMetadata),
+			}, chapterMetadataTx(o, signer, book.Title, sectionTitle, chapterMetadata))
+		}
+		progress.ChaptersDone++
+		now := time.Now()
+		color.Cyan("%s", progress.Line(now))
+		settings.Log.Write(progress.Record(network, book.Title, now))
+	}
+
+	report.Duration = time.Since(started)
+	if report.Failed > 0 {
+		report.Status = pipeline.BookFailed
+		report.Error = fmt.Sprintf("%d of %d transactions failed", report.Failed, report.Transactions)
+		return report
+	}
+	report.Status = pipeline.BookUploaded
+	color.Green("\nFinished uploading %s sections.", book.Title)
+	return report
+}
+
+// planSteps reads the chain to find the book-level steps an upload of book takes:
+// whether its genre and the book must be created, its keeper assigned, and which of
+// its metadata keys set, and the chapter names it already has.
+func planSteps(o *OverflowState, settings uploadSettings, book pipeline.BookManifest, sections []chapterFile) (uploadSteps, error) {
+	color.Cyan("Checking if book already exists...")
+	bookExists := false
+	bookResult := o.Script("get_book", WithArg("bookTitle", pipeline.StringArg(book.Title)))
+	if bookResult != nil && bookResult.Err == nil {
+		bookExists = true
+	}
+
+	steps := uploadSteps{CreateBook: !bookExists, ChapterNames: map[string]bool{}}
+	if !bookExists {
+		var err error
+		if steps.CreateGenre, err = checkGenre(o, book.Genre, settings.CreateGenre); err != nil {
+			return steps, err
+		}
+	} else {
+		titles, err := fetchChapterTitles(o, book.Title)
+		if err != nil {
+			return steps, fmt.Errorf("could not read the chapter names of %s: %w", book.Title, err)
+		}
+		for _, title := range titles {
+			steps.ChapterNames[title] = true
+		}
+	}
+
+	if book.Keeper != "" {
+		current := ""
+		if bookExists {
+			var err error
+			if current, err = fetchKeeper(o, book.Title); err != nil {
+				return steps, fmt.Errorf("could not read the keeper of %s: %w", book.Title, err)
+			}
+		}
+		switch {
+		case current == book.Keeper:
+			color.Green("Keeper %s already assigned.", book.Keeper)
+		case current != "":
+			color.Yellow("Keeper will change from %s to %s.", current, book.Keeper)
+			steps.SetKeeper = true
+		default:
+			steps.SetKeeper = true
+		}
+	}
+
+	metadata, err := bookMetadataFor(settings, book, sections)
+	if err != nil {
+		return steps, fmt.Errorf("error reading book metadata: %w", err)
+	}
+	steps.BookMetadata = pipeline.MetadataFields(metadata)
+	if bookExists {
+		onChain, err := fetchMetadata(o, book.Title)
+		if err != nil {
+			return steps, fmt.Errorf("could not read the metadata of %s: %w", book.Title, err)
+		}
+		var current pipeline.BookMetadata
+		if err := pipeline.DecodeMetadata(onChain.Book, &current); err != nil {
+			return steps, fmt.Errorf("%s: %w", book.Title, err)
+		}
+		steps.BookMetadata = steps.BookMetadata.Changed(pipeline.MetadataFields(current))
+	}
+	return steps, nil
+}
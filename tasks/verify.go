@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"alexandria/overflow/tasks/pipeline"
+
+	. "github.com/bjartek/overflow/v2"
+	"github.com/fatih/color"
+)
+
+// Sections larger than this are read back paragraph by paragraph,
+// since a whole chapter may not fit in one script response.
+const largeChapterBytes = 1_000_000
+
+// runVerify reads every chapter back from the chain and compares it with the local section files.
+// Returns the number of chapters that are missing or differ.
+func runVerify(o *OverflowState, ledger *pipeline.Ledger, network, bookTitle string, sections []chapterFile) int {
+	color.Red("Alexandria Contract - %s Verification (%s)", bookTitle, network)
+	uploaded := ledger.Latest(network, "Admin/add_chapter")
+
+	mismatches := 0
+	for _, section := range sections {
+		local, err := readParagraphs(section.Path)
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", section.Path, err)
+			os.Exit(1)
+		}
+
+		onChain, err := fetchChapterParagraphs(o, bookTitle, section.Title, section.Path)
+		if err != nil {
+			color.Red("✗ %s (index %d): missing on-chain: %v", section.Title, section.Index, err)
+			mismatches++
+			continue
+		}
+
+		diff := pipeline.CompareParagraphs(local, onChain)
+		if entry, ok := uploaded[section.Title]; ok && entry.ContentHash != "" && !ledger.ContentSealed(network, section.Title, diff.LocalHash) {
+			color.Yellow("  %s: local section changed since it was uploaded (ledger hash %.12s, local %.12s)",
+				section.Title, entry.ContentHash, diff.LocalHash)
+		}
+		if diff.Match() {
+			color.Green("✓ %s (index %d): %d paragraphs, sha256 %.12s", section.Title, section.Index, diff.LocalParagraphs, diff.LocalHash)
+			continue
+		}
+		if pipeline.CompareParagraphs(local, pipeline.LegacyUnescapeAll(onChain)).Match() {
+			color.Yellow("✓ %s (index %d): %d paragraphs, stored with the old escaped encoding; patch re-stores it exactly",
+				section.Title, section.Index, diff.LocalParagraphs)
+			continue
+		}
+
+		mismatches++
+		color.Red("✗ %s (index %d): content differs", section.Title, section.Index)
+		if diff.LocalParagraphs != diff.OnChainParagraphs {
+			fmt.Printf("  paragraph count: local %d, on-chain %d\n", diff.LocalParagraphs, diff.OnChainParagraphs)
+		}
+		fmt.Printf("  first differing paragraph: %d\n", diff.FirstDiff)
+		fmt.Printf("    local:    %q\n", diff.LocalText)
+		fmt.Printf("    on-chain: %q\n", diff.OnChainText)
+	}
+	return mismatches
+}
+
+// fetchChapterParagraphs reads a chapter's paragraphs exactly as stored.
+// Small chapters are read in one get_book_chapter call; large ones, or chapters that
+// fail to read in one call, are read one paragraph at a time with get_book_paragraph.
+func fetchChapterParagraphs(o *OverflowState, bookTitle, chapterTitle, localPath string) ([]string, error) {
+	var paragraphs []string
+	info, err := os.Stat(localPath)
+	if err == nil && info.Size() <= largeChapterBytes {
+		paragraphs, err = fetchChapter(o, bookTitle, chapterTitle)
+	}
+	if err != nil || paragraphs == nil {
+		paragraphs, err = fetchParagraphs(o, bookTitle, chapterTitle)
+	}
+	return paragraphs, err
+}
+
+// fetchChapter reads a whole chapter with the get_book_chapter script.
+func fetchChapter(o *OverflowState, bookTitle, chapterTitle string) ([]string, error) {
+	result := o.Script("get_book_chapter",
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+	)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	if result.Output == nil {
+		return nil, fmt.Errorf("chapter %q not found", chapterTitle)
+	}
+	var chapter pipeline.OnChainChapter
+	if err := result.MarshalAs(&chapter); err != nil {
+		return nil, fmt.Errorf("failed to decode chapter %q: %w", chapterTitle, err)
+	}
+	if chapter.Paragraphs == nil {
+		chapter.Paragraphs = []string{}
+	}
+	return chapter.Paragraphs, nil
+}
+
+// fetchChapterLength reads how many paragraphs a chapter holds with get_chapter_length.
+func fetchChapterLength(o *OverflowState, bookTitle, chapterTitle string) (int, error) {
+	result := o.Script("get_chapter_length",
+		WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+		WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+	)
+	if result.Err != nil {
+		return 0, result.Err
+	}
+	var length int
+	if err := result.MarshalAs(&length); err != nil {
+		return 0, fmt.Errorf("failed to decode length of %q: %w", chapterTitle, err)
+	}
+	return length, nil
+}
+
+// fetchParagraphs reads a chapter one paragraph at a time with get_book_paragraph.
+func fetchParagraphs(o *OverflowState, bookTitle, chapterTitle string) ([]string, error) {
+	length, err := fetchChapterLength(o, bookTitle, chapterTitle)
+	if err != nil {
+		return nil, err
+	}
+
+	paragraphs := make([]string, 0, length)
+	for i := 0; i < length; i++ {
+		result := o.Script("get_book_paragraph",
+			WithArg("bookTitle", pipeline.StringArg(bookTitle)),
+			WithArg("chapterTitle", pipeline.StringArg(chapterTitle)),
+			WithArg("paragraphIndex", pipeline.IntArg(i)),
+		)
+		if result.Err != nil {
+			return nil, fmt.Errorf("paragraph %d: %w", i, result.Err)
+		}
+		var paragraph string
+		if err := result.MarshalAs(&paragraph); err != nil {
+			return nil, fmt.Errorf("failed to decode paragraph %d: %w", i, err)
+		}
+		paragraphs = append(paragraphs, paragraph)
+	}
+	return paragraphs, nil
+}